@@ -6,7 +6,11 @@ toolchain go1.23.2
 
 require (
 	github.com/google/uuid v1.5.0
+	github.com/gorilla/sessions v1.4.0
 	github.com/gorilla/websocket v1.5.1
+	github.com/joho/godotenv v1.5.1
+	github.com/markbates/goth v1.80.0
+	github.com/rs/zerolog v1.33.0
 	go.mongodb.org/mongo-driver v1.13.1
 	golang.org/x/crypto v0.21.0
 )
@@ -29,12 +33,8 @@ require (
 	github.com/gorilla/context v1.1.1 // indirect
 	github.com/gorilla/mux v1.6.2 // indirect
 	github.com/gorilla/securecookie v1.1.2 // indirect
-	github.com/gorilla/sessions v1.4.0 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
-	github.com/markbates/goth v1.80.0 // indirect
 	github.com/mattn/go-colorable v0.1.14 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/rs/zerolog v1.33.0 // indirect
 	golang.org/x/net v0.21.0 // indirect
 	golang.org/x/oauth2 v0.23.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
@@ -78,7 +78,7 @@ func (player *Player) activatePower() {
 	tile.updateAll(soundTriggerByName("explosion"))
 
 	playerHighlights := highlightMapToSlice(player)
-	fatalities := damageAndIndicate(playerHighlights, player, 50)
+	fatalities := damageAndIndicate(playerHighlights, player, 50, nil)
 	checkFatalityAccomplishments(player, fatalities)
 	updateOne(sliceOfTileToHighlightBoxes(playerHighlights, ""), player)
 
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const AUDIT_LOG_LIMIT = 200 // Entries kept in memory for the admin page
+
+var errPlayerNotFound = errors.New("player not found")
+
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Remote string    `json:"remote"`
+	Action string    `json:"action"`
+	Target string    `json:"target"`
+	Detail string    `json:"detail"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Appended to as json lines when path is set, the most recent entries are also kept in memory
+type AuditLog struct {
+	sync.Mutex
+	entries []AuditEntry
+	path    string
+}
+
+type BanRecord struct {
+	Username string    `bson:"username" json:"username"`
+	Reason   string    `bson:"reason" json:"reason"`
+	Created  time.Time `bson:"created" json:"created"`
+}
+
+// Checked on every join so kept in memory, saved through storage so that bans outlive a restart
+type BanList struct {
+	sync.Mutex
+	reasons map[string]string // By username
+	db      BanStore
+}
+
+// Returns who or what was acted on and a description for the audit log
+type AdminAction func(world *World, form url.Values) (target string, detail string, err error)
+
+var adminActions = map[string]AdminAction{
+	"kick":           adminKick,
+	"ban":            adminBan,
+	"unban":          adminUnban,
+	"teleport":       adminTeleport,
+	"team":           adminTeam,
+	"hat":            adminHat,
+	"accomplishment": adminAccomplishment,
+	"reset-scores":   adminResetScores,
+	"broadcast":      adminBroadcast,
+}
+
+type AdminPlayerView struct {
+	Username  string `json:"username"`
+	Team      string `json:"team"`
+	Stage     string `json:"stage"`
+	Y         int    `json:"y"`
+	X         int    `json:"x"`
+	Health    int64  `json:"health"`
+	Money     int64  `json:"money"`
+	Streak    int64  `json:"streak"`
+	Connected bool   `json:"connected"`
+}
+
+type AdminStageView struct {
+	Name    string `json:"name"`
+	Players int    `json:"players"`
+}
+
+type AdminBanView struct {
+	Username string `json:"username"`
+	Reason   string `json:"reason"`
+}
+
+type AdminPage struct {
+	ServerName      string
+	Teams           []string
+	Hats            []string
+	Accomplishments []string
+	GameModes       []string
+	Areas           []string
+}
+
+////////////////////////////////////////////////////////////
+// Authorization
+
+// Browsers are prompted for basic auth, scripts may send the secret in X-Admin-Secret instead
+func adminAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	if os.Getenv("ADMIN_PASSWORD") == "" {
+		logger.Warn().Msg("Admin is disabled - but has been requested.")
+		http.Error(w, "Disabled", http.StatusNotFound)
+		return false
+	}
+	password, ok := r.Header.Get("X-Admin-Secret"), true
+	if password == "" {
+		_, password, ok = r.BasicAuth()
+	}
+	if !ok || !secretMatches(password, "ADMIN_PASSWORD") {
+		logger.Warn().Msg("Unauthorized admin request from: " + clientIP(r))
+		w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && !adminSameOrigin(r) {
+		logger.Warn().Msg("Cross origin admin request from: " + clientIP(r))
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// Constant time, an unset password matches nothing
+func secretMatches(password, envName string) bool {
+	secret := os.Getenv(envName)
+	return secret != "" && subtle.ConstantTimeCompare([]byte(password), []byte(secret)) == 1
+}
+
+// Browsers resend basic auth to any page that posts here, so changes must come from this host.
+// Another site cannot set X-Admin-Secret without the password.
+func adminSameOrigin(r *http.Request) bool {
+	if r.Header.Get("X-Admin-Secret") != "" {
+		return true
+	}
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	parsed, err := url.Parse(source)
+	return source != "" && err == nil && parsed.Host == r.Host
+}
+
+////////////////////////////////////////////////////////////
+// Handlers
+
+func (world *World) adminPageHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r) {
+		return
+	}
+	page := AdminPage{
+		ServerName:      world.config.serverName,
+		Teams:           teams.names(),
+		Hats:            sortedKeys(HAT_NAME_TO_TRIM),
+		Accomplishments: everyAccomplishment,
+		GameModes:       sortedKeys(world.gameModes),
+		Areas:           areaNames(),
+	}
+	tmpl.ExecuteTemplate(w, "admin", page)
+}
+
+// GET /admin/{players,stages,bans,audit,heatmap} and POST /admin/{action}
+func (world *World) adminHandler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r) {
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/admin/")
+	if r.Method == http.MethodGet {
+		world.adminView(w, r, name)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	action, ok := adminActions[name]
+	if !ok {
+		http.Error(w, "Unknown action", http.StatusNotFound)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	target, detail, err := action(world, r.PostForm)
+	entry := world.audit.record(clientIP(r), name, target, detail, err)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	writeAdminResponse(w, r, "admin-result", entry)
+}
+
+func (world *World) adminView(w http.ResponseWriter, r *http.Request, name string) {
+	switch name {
+	case "players":
+		writeAdminResponse(w, r, "admin-players", world.adminPlayers())
+	case "stages":
+		writeAdminResponse(w, r, "admin-stages", world.adminStages())
+	case "bans":
+		writeAdminResponse(w, r, "admin-bans", world.bans.list())
+	case "audit":
+		writeAdminResponse(w, r, "admin-audit", world.audit.recent())
+	case "heatmap":
+		world.adminHeatmap(w, r)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// Htmx gets an html fragment, everything else gets json
+func writeAdminResponse(w http.ResponseWriter, r *http.Request, templateName string, data any) {
+	if r.Header.Get("HX-Request") == "true" {
+		var buf bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buf, templateName, data); err != nil {
+			logger.Error().Err(err).Msg("Failed to render " + templateName)
+			http.Error(w, "Render failed", http.StatusInternalServerError)
+			return
+		}
+		w.Write(buf.Bytes())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+////////////////////////////////////////////////////////////
+// Views
+
+func (world *World) adminPlayers() []AdminPlayerView {
+	out := make([]AdminPlayerView, 0)
+	for _, player := range world.copyOfPlayers() {
+		view := AdminPlayerView{
+			Username:  player.username,
+			Team:      player.getTeamNameSync(),
+			Health:    player.health.Load(),
+			Money:     player.money.Load(),
+			Streak:    player.killstreak.Load(),
+			Connected: player.connected.Load(),
+		}
+		if tile := player.getTileSync(); tile != nil && tile.stage != nil {
+			view.Stage, view.Y, view.X = tile.stage.name, tile.y, tile.x
+		}
+		out = append(out, view)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Username < out[j].Username })
+	return out
+}
+
+func (world *World) adminStages() []AdminStageView {
+	counts := make(map[string]int)
+	for _, player := range world.copyOfPlayers() {
+		if tile := player.getTileSync(); tile != nil && tile.stage != nil {
+			counts[tile.stage.name]++
+		}
+	}
+	world.wStageMutex.Lock()
+	for name := range world.worldStages {
+		if _, ok := counts[name]; !ok {
+			counts[name] = 0
+		}
+	}
+	world.wStageMutex.Unlock()
+
+	out := make([]AdminStageView, 0, len(counts))
+	for _, name := range sortedKeys(counts) {
+		out = append(out, AdminStageView{Name: name, Players: counts[name]})
+	}
+	return out
+}
+
+////////////////////////////////////////////////////////////
+// Actions
+
+func adminKick(world *World, form url.Values) (string, string, error) {
+	username := form.Get("username")
+	return username, "", world.kick(username)
+}
+
+func adminBan(world *World, form url.Values) (string, string, error) {
+	username, reason := form.Get("username"), form.Get("reason")
+	if username == "" {
+		return username, reason, errors.New("username required")
+	}
+	if err := world.bans.add(username, reason); err != nil {
+		return username, reason, err
+	}
+	if err := world.kick(username); err != nil && !errors.Is(err, errPlayerNotFound) {
+		return username, reason, err
+	}
+	return username, reason, nil
+}
+
+func adminUnban(world *World, form url.Values) (string, string, error) {
+	username := form.Get("username")
+	removed, err := world.bans.remove(username)
+	if err == nil && !removed {
+		err = errors.New("not banned")
+	}
+	return username, "", err
+}
+
+func adminTeleport(world *World, form url.Values) (string, string, error) {
+	username, stagename := form.Get("username"), form.Get("stage")
+	detail := fmt.Sprintf("%s %s,%s", stagename, form.Get("y"), form.Get("x"))
+	y, errY := strconv.Atoi(form.Get("y"))
+	x, errX := strconv.Atoi(form.Get("x"))
+	if errY != nil || errX != nil {
+		return username, detail, errors.New("invalid coordinates")
+	}
+	player := world.getPlayerByUsername(username)
+	if player == nil {
+		return username, detail, errPlayerNotFound
+	}
+	return username, detail, teleportPlayer(player, stagename, y, x)
+}
+
+func adminTeam(world *World, form url.Values) (string, string, error) {
+	username, team := form.Get("username"), form.Get("team")
+	player := world.getPlayerByUsername(username)
+	if player == nil {
+		return username, team, errPlayerNotFound
+	}
+	return username, team, world.changeTeam(player, team)
+}
+
+func adminHat(world *World, form url.Values) (string, string, error) {
+	username, hat := form.Get("username"), form.Get("hat")
+	if _, ok := HAT_NAME_TO_TRIM[hat]; !ok {
+		return username, hat, errors.New("unknown hat")
+	}
+	player := world.getPlayerByUsername(username)
+	if player == nil {
+		return username, hat, errPlayerNotFound
+	}
+	player.setHatByName(hat)
+	return username, hat, nil
+}
+
+func adminAccomplishment(world *World, form url.Values) (string, string, error) {
+	username, name := form.Get("username"), form.Get("accomplishment")
+	known := false
+	for _, accomplishment := range everyAccomplishment {
+		known = known || accomplishment == name
+	}
+	if !known {
+		return username, name, errors.New("unknown accomplishment")
+	}
+	player := world.getPlayerByUsername(username)
+	if player == nil {
+		return username, name, errPlayerNotFound
+	}
+	player.addAccomplishmentByName(name)
+	return username, name, nil
+}
+
+// Every mode unless one is named
+func adminResetScores(world *World, form url.Values) (string, string, error) {
+	name := form.Get("mode")
+	if name == "" {
+		for _, mode := range world.gameModes {
+			mode.getScoreboard().ResetAll()
+		}
+		return "all", "", nil
+	}
+	mode, ok := world.gameModes[name]
+	if !ok {
+		return name, "", errors.New("unknown game mode")
+	}
+	mode.getScoreboard().ResetAll()
+	return name, "", nil
+}
+
+// Color markup such as @[text|red] is allowed, html is not
+func adminBroadcast(world *World, form url.Values) (string, string, error) {
+	message := strings.TrimSpace(form.Get("message"))
+	if message == "" {
+		return "all", message, errors.New("message required")
+	}
+	broadcastBottomText(world, html.EscapeString(message))
+	return "all", message, nil
+}
+
+////////////////////////////////////////////////////////////
+// World management
+
+// Parked players are logged out directly, connected players are logged out by their read loop
+func (world *World) kick(username string) error {
+	if parked := world.unparkByUsername(username); parked != nil {
+		initiateLogout(parked.player)
+		return nil
+	}
+	player := world.getPlayerByUsername(username)
+	if player == nil {
+		return errPlayerNotFound
+	}
+	player.quitting.Store(true) // Not parked
+	return player.closeConnectionSync()
+}
+
+func teleportPlayer(player *Player, stagename string, y, x int) error {
+	player.tangibilityLock.Lock()
+	defer player.tangibilityLock.Unlock()
+	if !player.tangible {
+		return errors.New("player is not in the world")
+	}
+	if !validCoordinate(y, x, player.fetchStageSync(stagename)) {
+		return fmt.Errorf("invalid destination: %s %d,%d", stagename, y, x)
+	}
+	applyTeleport(player, &Teleport{destStage: stagename, destY: y, destX: x})
+	return nil
+}
+
+func (world *World) changeTeam(player *Player, team string) error {
+	if !validTeam(team) {
+		return fmt.Errorf("unknown team: %s", team)
+	}
+	world.wPlayerMutex.Lock()
+	player.viewLock.Lock()
+	previous := player.team
+	player.team = team
+	player.viewLock.Unlock()
+	world.teamQuantities[previous]--
+	world.teamQuantities[team]++
+	world.wPlayerMutex.Unlock()
+
+	updateIconForAllIfTangible(player)
+	go world.db.updateTeamForPlayer(player.username, team)
+	return nil
+}
+
+////////////////////////////////////////////////////////////
+// Bans
+
+func createBanList(db BanStore) *BanList {
+	bans := &BanList{reasons: make(map[string]string), db: db}
+	records, err := db.getBans(context.TODO())
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to load bans")
+	}
+	for _, record := range records {
+		bans.reasons[record.Username] = record.Reason
+	}
+	return bans
+}
+
+// Saved first, a ban that failed to save is not applied
+func (bans *BanList) add(username, reason string) error {
+	bans.Lock()
+	defer bans.Unlock()
+	if err := bans.db.saveBan(context.TODO(), BanRecord{Username: username, Reason: reason, Created: time.Now()}); err != nil {
+		return err
+	}
+	bans.reasons[username] = reason
+	return nil
+}
+
+func (bans *BanList) remove(username string) (bool, error) {
+	bans.Lock()
+	defer bans.Unlock()
+	if _, ok := bans.reasons[username]; !ok {
+		return false, nil
+	}
+	if err := bans.db.deleteBan(context.TODO(), username); err != nil {
+		return false, err
+	}
+	delete(bans.reasons, username)
+	return true, nil
+}
+
+func (bans *BanList) isBanned(username string) bool {
+	bans.Lock()
+	defer bans.Unlock()
+	_, ok := bans.reasons[username]
+	return ok
+}
+
+func (bans *BanList) list() []AdminBanView {
+	bans.Lock()
+	defer bans.Unlock()
+	out := make([]AdminBanView, 0, len(bans.reasons))
+	for _, username := range sortedKeys(bans.reasons) {
+		out = append(out, AdminBanView{Username: username, Reason: bans.reasons[username]})
+	}
+	return out
+}
+
+////////////////////////////////////////////////////////////
+// Audit
+
+func createAuditLog(path string) *AuditLog {
+	return &AuditLog{entries: make([]AuditEntry, 0), path: path}
+}
+
+func (audit *AuditLog) record(remote, action, target, detail string, err error) AuditEntry {
+	entry := AuditEntry{Time: time.Now().UTC(), Remote: remote, Action: action, Target: target, Detail: detail}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	logger.Info().Str("remote", remote).Str("target", target).Str("detail", detail).Str("error", entry.Error).Msg("Admin: " + action)
+
+	audit.Lock()
+	defer audit.Unlock()
+	audit.entries = append(audit.entries, entry)
+	if len(audit.entries) > AUDIT_LOG_LIMIT {
+		audit.entries = audit.entries[len(audit.entries)-AUDIT_LOG_LIMIT:]
+	}
+	if audit.path != "" {
+		audit.append(entry)
+	}
+	return entry
+}
+
+func (audit *AuditLog) append(entry AuditEntry) {
+	file, err := os.OpenFile(audit.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to open audit log")
+		return
+	}
+	defer file.Close()
+	line, _ := json.Marshal(entry)
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		logger.Error().Err(err).Msg("Failed to write audit log")
+	}
+}
+
+// Newest first
+func (audit *AuditLog) recent() []AuditEntry {
+	audit.Lock()
+	defer audit.Unlock()
+	out := make([]AuditEntry, len(audit.entries))
+	for i, entry := range audit.entries {
+		out[len(out)-1-i] = entry
+	}
+	return out
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func createAdminTestingWorld(t *testing.T) *World {
+	t.Setenv("ADMIN_PASSWORD", "secret")
+	return createWorldWithAreasForTesting(t, &testingConfig,
+		Area{Name: "test-admin", SpawnStrategy: "none", Tiles: walkableTilesForTesting(2, 4)},
+		Area{Name: "test-admin-other", SpawnStrategy: "none", Tiles: walkableTilesForTesting(2, 4)},
+	)
+}
+
+func joinAdminTestingPlayer(t *testing.T, world *World, username string) *Player {
+	record := PlayerRecord{Username: username, Team: "fuchsia", StageName: "test-admin", Y: 0, X: 0, Health: 100}
+	return joinPlayerForTesting(t, world, record, &MockConn{})
+}
+
+func adminRequest(world *World, method, path string, form url.Values, htmx bool) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("admin", "secret")
+	r.Header.Set("Origin", "http://"+r.Host)
+	if htmx {
+		r.Header.Set("HX-Request", "true")
+	}
+	w := httptest.NewRecorder()
+	world.adminHandler(w, r)
+	return w
+}
+
+func TestAdminRequiresPassword(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	r := httptest.NewRequest(http.MethodGet, "/admin/players", nil)
+	r.SetBasicAuth("admin", "wrong")
+	w := httptest.NewRecorder()
+	world.adminHandler(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized, got %d", w.Code)
+	}
+
+	t.Setenv("ADMIN_PASSWORD", "")
+	w = adminRequest(world, http.MethodGet, "/admin/players", nil, false)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected admin to be disabled, got %d", w.Code)
+	}
+}
+
+func TestAdminChangesMustComeFromTheAdminPage(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	joinAdminTestingPlayer(t, world, "target")
+	form := url.Values{"username": {"target"}, "team": {"sky-blue"}}
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/team", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("admin", "secret")
+	r.Header.Set("Origin", "https://elsewhere.example")
+	w := httptest.NewRecorder()
+	world.adminHandler(w, r)
+	if w.Code != http.StatusForbidden || len(world.audit.recent()) != 0 {
+		t.Errorf("cross origin posts should be rejected, got %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/admin/team", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Admin-Secret", "secret")
+	w = httptest.NewRecorder()
+	world.adminHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("scripts sending the secret header need no origin, got %d", w.Code)
+	}
+}
+
+func TestAdminListsPlayersAndStages(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	joinAdminTestingPlayer(t, world, "listed")
+
+	var players []AdminPlayerView
+	json.NewDecoder(adminRequest(world, http.MethodGet, "/admin/players", nil, false).Body).Decode(&players)
+	if len(players) != 1 || players[0].Username != "listed" || players[0].Stage != "test-admin" || players[0].Team != "fuchsia" {
+		t.Errorf("unexpected players %+v", players)
+	}
+	var stages []AdminStageView
+	json.NewDecoder(adminRequest(world, http.MethodGet, "/admin/stages", nil, false).Body).Decode(&stages)
+	found := false
+	for _, stage := range stages {
+		found = found || stage.Name == "test-admin" && stage.Players == 1
+	}
+	if !found {
+		t.Errorf("stage with player not listed: %+v", stages)
+	}
+	if body := adminRequest(world, http.MethodGet, "/admin/players", nil, true).Body.String(); !strings.Contains(body, "<td>listed</td>") {
+		t.Error("htmx should receive an html fragment")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	r.SetBasicAuth("admin", "secret")
+	w := httptest.NewRecorder()
+	world.adminPageHandler(w, r)
+	if !strings.Contains(w.Body.String(), `hx-get="/admin/players"`) {
+		t.Error("admin page should poll the player list")
+	}
+}
+
+func TestAdminActionsAreAudited(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	player := joinAdminTestingPlayer(t, world, "target")
+
+	w := adminRequest(world, http.MethodPost, "/admin/team", url.Values{"username": {"target"}, "team": {"sky-blue"}}, false)
+	if w.Code != http.StatusOK || player.getTeamNameSync() != "sky-blue" {
+		t.Fatalf("team change failed: %s", w.Body.String())
+	}
+	if world.teamQuantities["sky-blue"] != 1 || world.teamQuantities["fuchsia"] != 0 {
+		t.Errorf("team counts not moved: %v", world.teamQuantities)
+	}
+
+	w = adminRequest(world, http.MethodPost, "/admin/teleport", url.Values{"username": {"target"}, "stage": {"test-admin-other"}, "y": {"1"}, "x": {"2"}}, false)
+	tile := player.getTileSync()
+	if w.Code != http.StatusOK || tile.stage.name != "test-admin-other" || tile.y != 1 || tile.x != 2 {
+		t.Errorf("teleport failed: %s", w.Body.String())
+	}
+
+	w = adminRequest(world, http.MethodPost, "/admin/hat", url.Values{"username": {"target"}, "hat": {"not-a-hat"}}, false)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown hat should be rejected, got %d", w.Code)
+	}
+
+	entries := world.audit.recent()
+	if len(entries) != 3 || entries[0].Action != "hat" || entries[0].Error == "" || entries[2].Action != "team" || entries[2].Detail != "sky-blue" {
+		t.Errorf("unexpected audit log %+v", entries)
+	}
+}
+
+func TestBannedPlayersAreKickedAndCannotJoin(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	player := joinAdminTestingPlayer(t, world, "banned")
+
+	w := adminRequest(world, http.MethodPost, "/admin/ban", url.Values{"username": {"banned"}, "reason": {"griefing"}}, true)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "griefing") {
+		t.Fatalf("ban failed: %s", w.Body.String())
+	}
+	if !player.quitting.Load() {
+		t.Error("banned player should be kicked without parking")
+	}
+
+	world.removePlayer(player)
+	record := PlayerRecord{Username: "banned", Team: "fuchsia", StageName: "test-admin"}
+	if world.join(createLoginRequest(record), &MockConn{}) != nil {
+		t.Error("banned player should not be able to join")
+	}
+
+	if !createGameWorld(world.db, &testingConfig).bans.isBanned("banned") {
+		t.Error("bans should outlive a restart")
+	}
+
+	adminRequest(world, http.MethodPost, "/admin/unban", url.Values{"username": {"banned"}}, false)
+	if world.bans.isBanned("banned") || createGameWorld(world.db, &testingConfig).bans.isBanned("banned") {
+		t.Error("unban should lift the ban")
+	}
+}
+
+func TestAdminResetsScoreboards(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	world.gameModes["ctf"].getScoreboard().Add("fuchsia", 3)
+	world.gameModes["money-race"].getScoreboard().Add("fuchsia", 3)
+
+	adminRequest(world, http.MethodPost, "/admin/reset-scores", url.Values{"mode": {"ctf"}}, false)
+	if world.gameModes["ctf"].getScoreboard().GetScore("fuchsia") != 0 || world.gameModes["money-race"].getScoreboard().GetScore("fuchsia") != 3 {
+		t.Error("only the named mode should be reset")
+	}
+	adminRequest(world, http.MethodPost, "/admin/reset-scores", url.Values{}, false)
+	if world.gameModes["money-race"].getScoreboard().GetScore("fuchsia") != 0 {
+		t.Error("every mode should be reset")
+	}
+}
+
+func TestDebugEndpointsUseAdminAuthorization(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	r := httptest.NewRequest(http.MethodPost, "/scheduler", strings.NewReader("secret=secret&stagename=test-admin&action=step"))
+	w := httptest.NewRecorder()
+	world.postScheduler(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("a posted secret should no longer authorize, got %d", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/scheduler", strings.NewReader("stagename=nowhere&action=step"))
+	r.Header.Set("X-Admin-Secret", "secret")
+	w = httptest.NewRecorder()
+	world.postScheduler(w, r)
+	entries := world.audit.recent()
+	if w.Code != http.StatusNotFound || len(entries) != 1 || entries[0].Action != "scheduler" || entries[0].Target != "nowhere" {
+		t.Errorf("expected an audited scheduler request, got %d %+v", w.Code, entries)
+	}
+}
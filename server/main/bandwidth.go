@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Gorilla does not expose compressed sizes, so every nth compressed message is also deflated here
+const DEFLATE_SAMPLE_RATE = 16
+
+type BandwidthStats struct {
+	written    atomic.Int64 // Bytes handed to websockets, before compression
+	compressed atomic.Int64 // Portion of written sent over a compressed connection
+	coalesced  atomic.Int64 // Bytes removed by coalescing swaps
+	messages   atomic.Int64
+	sampledIn  atomic.Int64
+	sampledOut atomic.Int64
+}
+
+////////////////////////////////////////////////////////////
+// Coalescing
+
+// Only the last swap of each element in a batch is kept. View changes are cumulative so they are always kept.
+func coalesceSwaps(batch []byte) []byte {
+	matches := findSwapTokens(batch)
+	if len(matches) < 2 {
+		return batch
+	}
+	keys := make([]string, len(matches))
+	last := make(map[string]int, len(matches))
+	for i, match := range matches {
+		id := string(batch[match[2]:match[3]])
+		if id == "set" || id == "shift" {
+			continue
+		}
+		keys[i] = string(batch[match[2]:match[7]]) // id, y and x
+		last[keys[i]] = i
+	}
+	if len(last) == len(matches) {
+		return batch
+	}
+
+	var out bytes.Buffer
+	previous := 0
+	for i, match := range matches {
+		if keys[i] == "" || last[keys[i]] == i {
+			continue
+		}
+		out.Write(batch[previous:match[0]])
+		previous = match[1]
+	}
+	out.Write(batch[previous:])
+	return out.Bytes()
+}
+
+func (stats *BandwidthStats) coalesce(batch []byte) []byte {
+	out := coalesceSwaps(batch)
+	stats.coalesced.Add(int64(len(batch) - len(out)))
+	return out
+}
+
+////////////////////////////////////////////////////////////
+// Compression
+
+func compressionNegotiated(r *http.Request) bool {
+	return upgrader.EnableCompression && strings.Contains(r.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+}
+
+// Counts what is written, wraps the websocket itself so that any protocol translation is included
+type MeteredConnection struct {
+	WebsocketConnection
+	stats      *BandwidthStats
+	compressed bool
+}
+
+func meterConnection(conn WebsocketConnection, stats *BandwidthStats, compressed bool) WebsocketConnection {
+	return &MeteredConnection{WebsocketConnection: conn, stats: stats, compressed: compressed}
+}
+
+func (conn *MeteredConnection) WriteMessage(messageType int, data []byte) error {
+	err := conn.WebsocketConnection.WriteMessage(messageType, data)
+	if err == nil {
+		conn.stats.record(data, conn.compressed)
+	}
+	return err
+}
+
+func (stats *BandwidthStats) record(data []byte, compressed bool) {
+	stats.written.Add(int64(len(data)))
+	if !compressed {
+		return
+	}
+	stats.compressed.Add(int64(len(data)))
+	if stats.messages.Add(1)%DEFLATE_SAMPLE_RATE == 0 {
+		stats.sampledIn.Add(int64(len(data)))
+		stats.sampledOut.Add(int64(deflatedSize(data)))
+	}
+}
+
+// Gorilla deflates at BestSpeed
+func deflatedSize(data []byte) int {
+	var out bytes.Buffer
+	writer, err := flate.NewWriter(&out, flate.BestSpeed)
+	if err != nil {
+		return len(data)
+	}
+	writer.Write(data)
+	writer.Flush()
+	return out.Len()
+}
+
+func (stats *BandwidthStats) estimatedDeflateSavings() int64 {
+	in, out := stats.sampledIn.Load(), stats.sampledOut.Load()
+	if in == 0 {
+		return 0
+	}
+	return int64(float64(stats.compressed.Load()) * float64(in-out) / float64(in))
+}
+
+func (stats *BandwidthStats) summary() string {
+	return fmt.Sprintf("Bytes written: %d, saved by coalescing: %d, saved by compression (est.): %d\n", stats.written.Load(), stats.coalesced.Load(), stats.estimatedDeflateSavings())
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCoalesceSwapsKeepsLastSwapPerElement(t *testing.T) {
+	shift := `[~ id="shift" y="1" x="0" class=""]`
+	batch := playerBoxSpecifc(1, 2, "a") + soundTriggerByName("clink") + shift + playerBoxSpecifc(1, 3, "b") + shift + playerBoxSpecifc(1, 2, "c")
+	expected := soundTriggerByName("clink") + shift + playerBoxSpecifc(1, 3, "b") + shift + playerBoxSpecifc(1, 2, "c")
+
+	stats := &BandwidthStats{}
+	out := string(stats.coalesce([]byte(batch)))
+	if out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+	if stats.coalesced.Load() != int64(len(batch)-len(expected)) {
+		t.Errorf("unexpected bytes saved %d", stats.coalesced.Load())
+	}
+
+	unique := playerBoxSpecifc(1, 2, "a") + interactableBoxSpecific(1, 2, nil)
+	if string(coalesceSwaps([]byte(unique))) != unique {
+		t.Error("distinct elements should be kept")
+	}
+}
+
+func TestMeteredConnectionEstimatesCompression(t *testing.T) {
+	stats := &BandwidthStats{}
+	conn := meterConnection(&MockConn{}, stats, true)
+	message := []byte(strings.Repeat(playerBoxSpecifc(1, 2, "fuchsia"), 20))
+	for range DEFLATE_SAMPLE_RATE {
+		conn.WriteMessage(1, message)
+	}
+	if stats.written.Load() != int64(DEFLATE_SAMPLE_RATE*len(message)) {
+		t.Errorf("unexpected bytes written %d", stats.written.Load())
+	}
+	if saved := stats.estimatedDeflateSavings(); saved <= 0 || saved >= stats.written.Load() {
+		t.Errorf("expected repetitive swaps to compress, estimated %d saved", saved)
+	}
+
+	uncompressed := &BandwidthStats{}
+	meterConnection(&MockConn{}, uncompressed, false).WriteMessage(1, message)
+	if uncompressed.estimatedDeflateSavings() != 0 || uncompressed.written.Load() != int64(len(message)) {
+		t.Error("uncompressed connections save nothing")
+	}
+}
@@ -1,18 +1,40 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
 const VIEW_HEIGHT = 16
 const VIEW_WIDTH = 16
 
+// Distinct swaps held for a client which is behind before it is resynced instead
+const BACKLOG_LIMIT = 4 * VIEW_HEIGHT * VIEW_WIDTH
+
+// Bytes of everything other than swaps, e.g. sounds, held before resyncing
+const BACKLOG_OTHER_LIMIT = 64 * 1024
+
 type Camera struct {
 	height, width, padding int
 	positionLock           sync.Mutex
 	topLeft                *Tile
 	outgoing               chan<- []byte // Send only: is == player.updates
+	events                 atomic.Bool   // Typed events rather than swaps, see JsonConnection
+	backlog                Backlog
+}
+
+// Zone updates which could not be queued without blocking
+type Backlog struct {
+	sync.Mutex
+	swaps   map[string]string // Latest swap by element id and position
+	order   []string
+	other   []byte // Everything else, kept in order
+	pending int    // Updates being parsed outside the lock, later ones must wait behind them
+	resync  bool
+	drops   atomic.Int64 // Updates which were coalesced or discarded
+	resyncs atomic.Int64
 }
 
 func (camera *Camera) setView(posY, posX int, stage *Stage) []*Tile {
@@ -27,9 +49,9 @@ func (camera *Camera) setView(posY, posX int, stage *Stage) []*Tile {
 	y, x := topLeft(len(stage.tiles), len(stage.tiles[0]), camera.height, camera.width, posY, posX)
 	region := getRegion(stage.tiles, Rect{y, y + camera.height - 1, x, x + camera.width - 1})
 
-	camera.outgoing <- []byte(fmt.Sprintf(`[~ id="set" y="%d" x="%d" class=""]`, y, x))
+	camera.outgoing <- camera.viewUpdate("set", y, x)
 	for _, tile := range region {
-		camera.outgoing <- []byte(swapsForTileNoHighlight(tile))
+		camera.outgoing <- camera.tileUpdate(tile)
 	}
 
 	newTopLeft := region[0]
@@ -45,7 +67,11 @@ func (player *Player) tryTrack() {
 }
 
 func (camera *Camera) track(character Character) []*Tile {
-	focus := character.getTileSync()
+	return camera.trackTile(character.getTileSync())
+}
+
+// Shifts the view only once focus is within padding of an edge
+func (camera *Camera) trackTile(focus *Tile) []*Tile {
 	stageH, stageW := len(focus.stage.tiles), len(focus.stage.tiles[0])
 	camera.positionLock.Lock()
 	defer camera.positionLock.Unlock()
@@ -62,7 +88,7 @@ func (camera *Camera) track(character Character) []*Tile {
 		return nil
 	}
 
-	camera.outgoing <- []byte(fmt.Sprintf(`[~ id="shift" y="%d" x="%d" class=""]`, dy, dx))
+	camera.outgoing <- camera.viewUpdate("shift", dy, dx)
 
 	return updateTiles(camera, newY, newX)
 }
@@ -102,13 +128,200 @@ func updateTiles(camera *Camera, newY, newX int) []*Tile {
 			}
 			if y < oldY0 || y > oldY1 || x < oldX0 || x > oldX1 {
 				newTiles = append(newTiles, stage.tiles[y][x])
-				camera.outgoing <- []byte(swapsForTileNoHighlight(stage.tiles[y][x]))
+				camera.outgoing <- camera.tileUpdate(stage.tiles[y][x])
 			}
 		}
 	}
 	return newTiles
 }
 
+func (camera *Camera) viewUpdate(op string, y, x int) []byte {
+	if camera.events.Load() {
+		return eventRecord(viewEvent(op, y, x))
+	}
+	return []byte(fmt.Sprintf(`[~ id="%s" y="%d" x="%d" class=""]`, op, y, x))
+}
+
+func (camera *Camera) tileUpdate(tile *Tile) []byte {
+	if camera.events.Load() {
+		return eventRecord(tileEvents(tile)...)
+	}
+	return []byte(swapsForTileNoHighlight(tile))
+}
+
+////////////////////////////////////////////////////////////
+// Backpressure
+
+// Shared by every camera in a zone so that it is parsed at most once, by the first camera which is behind
+type ZoneUpdate struct {
+	raw   []byte
+	parse sync.Once
+	swaps []BacklogSwap
+	other []byte
+}
+
+func newZoneUpdate(raw []byte) *ZoneUpdate {
+	return &ZoneUpdate{raw: raw}
+}
+
+func (update *ZoneUpdate) split() ([]BacklogSwap, []byte) {
+	update.parse.Do(func() {
+		update.swaps, update.other = splitSwaps(update.raw)
+	})
+	return update.swaps, update.other
+}
+
+// Never blocks. Once behind, every update waits in the backlog so that the latest swap wins.
+// Updates are parsed outside the lock.
+func (camera *Camera) deliver(update *ZoneUpdate) {
+	backlog := &camera.backlog
+	if backlog.trySend(camera.outgoing, update.raw) {
+		return
+	}
+	backlog.drops.Add(1)
+	metrics.backlogDrops.Add(1)
+	swaps, other := update.split()
+	backlog.add(swaps, other)
+}
+
+// Otherwise the update is pending until added
+func (backlog *Backlog) trySend(outgoing chan<- []byte, update []byte) bool {
+	backlog.Lock()
+	defer backlog.Unlock()
+	if len(backlog.order) == 0 && len(backlog.other) == 0 && backlog.pending == 0 && !backlog.resync {
+		select {
+		case outgoing <- update:
+			return true
+		default:
+		}
+	}
+	backlog.pending++
+	return false
+}
+
+type BacklogSwap struct {
+	key, swap string
+}
+
+// Swaps keyed by element id and position, the rest of the update as it came
+func splitSwaps(update []byte) ([]BacklogSwap, []byte) {
+	matches := findSwapTokens(update)
+	swaps := make([]BacklogSwap, 0, len(matches))
+	var other []byte
+	last := 0
+	for _, match := range matches {
+		other = append(other, update[last:match[0]]...)
+		key := string(update[match[2]:match[3]]) + "-" + string(update[match[4]:match[5]]) + "-" + string(update[match[6]:match[7]])
+		swaps = append(swaps, BacklogSwap{key: key, swap: string(update[match[0]:match[1]])})
+		last = match[1]
+	}
+	other = append(other, update[last:]...)
+	if len(bytes.TrimSpace(other)) == 0 {
+		other = nil
+	}
+	return swaps, other
+}
+
+func (backlog *Backlog) add(swaps []BacklogSwap, other []byte) {
+	backlog.Lock()
+	defer backlog.Unlock()
+	backlog.pending--
+	if backlog.resync {
+		return
+	}
+	if backlog.swaps == nil {
+		backlog.swaps = make(map[string]string)
+	}
+	for _, swap := range swaps {
+		if _, ok := backlog.swaps[swap.key]; !ok {
+			backlog.order = append(backlog.order, swap.key)
+		}
+		backlog.swaps[swap.key] = swap.swap
+	}
+	backlog.other = append(backlog.other, other...)
+	if len(backlog.order) > BACKLOG_LIMIT || len(backlog.other) > BACKLOG_OTHER_LIMIT {
+		backlog.requestResyncLocked()
+	}
+}
+
+func (backlog *Backlog) requestResync() {
+	backlog.Lock()
+	defer backlog.Unlock()
+	backlog.requestResyncLocked()
+}
+
+func (backlog *Backlog) requestResyncLocked() {
+	if !backlog.resync {
+		backlog.resyncs.Add(1)
+		metrics.backlogResyncs.Add(1)
+	}
+	backlog.resync = true
+	backlog.swaps = nil
+	backlog.order = nil
+	backlog.other = nil
+}
+
+func (backlog *Backlog) resynced() {
+	backlog.Lock()
+	defer backlog.Unlock()
+	backlog.resync = false
+}
+
+// Everything other than swaps comes first, then the latest swaps
+func (backlog *Backlog) take() (updates []byte, resync bool) {
+	backlog.Lock()
+	defer backlog.Unlock()
+	if backlog.resync {
+		return nil, true // Until resynced
+	}
+	buffer := bytes.NewBuffer(backlog.other)
+	for _, key := range backlog.order {
+		buffer.WriteString(backlog.swaps[key])
+	}
+	backlog.swaps = nil
+	backlog.order = nil
+	backlog.other = nil
+	return buffer.Bytes(), false
+}
+
+// Queued updates are older than the backlog so they are drained first
+func (camera *Camera) collect(updates <-chan []byte, buffer *bytes.Buffer) (resync, open bool) {
+	for queued := true; queued; {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				return false, false
+			}
+			buffer.Write(update)
+		default:
+			queued = false
+		}
+	}
+	swaps, resync := camera.backlog.take()
+	buffer.Write(swaps)
+	return resync, true
+}
+
+// Not ok while the camera is moving, the caller should retry
+func (camera *Camera) setToken() ([]byte, bool) {
+	if !camera.positionLock.TryLock() {
+		return nil, false
+	}
+	defer camera.positionLock.Unlock()
+	if camera.topLeft == nil {
+		return nil, true
+	}
+	return camera.viewUpdate("set", camera.topLeft.y, camera.topLeft.x), true
+}
+
+func (camera *Camera) drops() int64 {
+	return camera.backlog.drops.Load()
+}
+
+func (camera *Camera) resyncs() int64 {
+	return camera.backlog.resyncs.Load()
+}
+
 func (camera *Camera) drop() {
 	camera.positionLock.Lock()
 	defer camera.positionLock.Unlock()
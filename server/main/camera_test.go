@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBacklogKeepsLatestSwapPerElement(t *testing.T) {
+	camera := newCamera(make(chan []byte)) // Nobody receives
+	camera.deliver(newZoneUpdate([]byte(playerBoxSpecifc(1, 2, "old") + soundTriggerByName("clink"))))
+	camera.deliver(newZoneUpdate([]byte(interactableBoxSpecific(1, 2, nil))))
+	camera.deliver(newZoneUpdate([]byte(playerBoxSpecifc(1, 2, "new"))))
+
+	swaps, resync := camera.backlog.take()
+	if resync {
+		t.Fatal("small backlog should not need a resync")
+	}
+	expected := soundTriggerByName("clink") + playerBoxSpecifc(1, 2, "new") + interactableBoxSpecific(1, 2, nil)
+	if string(swaps) != expected {
+		t.Errorf("expected %q, got %q", expected, swaps)
+	}
+	if camera.drops() != 3 || camera.resyncs() != 0 {
+		t.Errorf("unexpected counters drops %d resyncs %d", camera.drops(), camera.resyncs())
+	}
+}
+
+func TestBacklogResyncsOnceOtherUpdatesPileUp(t *testing.T) {
+	camera := newCamera(make(chan []byte))
+	sound := []byte(soundTriggerByName("clink"))
+	for i := 0; i <= BACKLOG_OTHER_LIMIT/len(sound); i++ {
+		camera.deliver(newZoneUpdate(sound))
+	}
+	if _, resync := camera.backlog.take(); !resync {
+		t.Error("a client this far behind should be resynced rather than lose updates")
+	}
+}
+
+func TestBacklogResyncsOnceFull(t *testing.T) {
+	camera := newCamera(make(chan []byte))
+	for i := 0; i <= BACKLOG_LIMIT; i++ {
+		camera.deliver(newZoneUpdate([]byte(playerBoxSpecifc(i, 0, ""))))
+	}
+	camera.deliver(newZoneUpdate([]byte(playerBoxSpecifc(0, 0, ""))))
+	if _, resync := camera.backlog.take(); !resync {
+		t.Fatal("full backlog should resync")
+	}
+	if _, resync := camera.backlog.take(); !resync {
+		t.Error("resync should be pending until resynced")
+	}
+	camera.backlog.resynced()
+	if swaps, resync := camera.backlog.take(); resync || len(swaps) != 0 {
+		t.Error("nothing should remain after a resync")
+	}
+	if camera.resyncs() != 1 {
+		t.Errorf("expected one resync, got %d", camera.resyncs())
+	}
+}
+
+func TestZoneUpdateDoesNotWaitForSlowCamera(t *testing.T) {
+	stalled := newCamera(make(chan []byte))
+	updates := make(chan []byte, 1)
+	healthy := newCamera(updates)
+	zone := &CameraZone{activeCameras: map[*Camera]struct{}{stalled: {}, healthy: {}}}
+
+	done := make(chan struct{})
+	go func() {
+		zone.updateAll(playerBoxSpecifc(0, 0, "a"))
+		zone.updateAll(playerBoxSpecifc(0, 0, "b"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("zone update blocked on a slow camera")
+	}
+
+	var buffer bytes.Buffer
+	resync, open := healthy.collect(updates, &buffer)
+	if resync || !open {
+		t.Fatal("unexpected resync")
+	}
+	if !strings.HasSuffix(buffer.String(), playerBoxSpecifc(0, 0, "b")) {
+		t.Errorf("backlog should follow queued updates, got %q", buffer.String())
+	}
+	if stalled.drops() != 2 || healthy.drops() != 1 {
+		t.Errorf("unexpected drops stalled %d healthy %d", stalled.drops(), healthy.drops())
+	}
+}
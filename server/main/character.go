@@ -171,11 +171,13 @@ func (player *Player) fetchStageSync(stagename string) *Stage {
 	defer player.world.wStageMutex.Unlock()
 	stage, ok := player.world.worldStages[stagename]
 	if ok && stage != nil {
+		stage.touch()
 		return stage
 	}
 	teamStageName := stagename + ":" + player.getTeamNameSync()
 	stage, ok = player.world.worldStages[teamStageName]
 	if ok && stage != nil {
+		stage.touch()
 		return stage
 	}
 	// stagename + prompt for / provide group code
@@ -184,6 +186,7 @@ func (player *Player) fetchStageSync(stagename string) *Stage {
 	defer player.pStageMutex.Unlock()
 	stage, ok = player.playerStages[stagename]
 	if ok && stage != nil {
+		stage.touch()
 		return stage
 	}
 
@@ -194,12 +197,13 @@ func (player *Player) fetchStageSync(stagename string) *Stage {
 
 	stage = createStageFromArea(area) // can create empty stage
 	if area.LoadStrategy == "" {
-		player.world.worldStages[stagename] = stage
+		player.world.registerStage(stagename, stage)
 	}
 	if area.LoadStrategy == "Team" {
-		player.world.worldStages[teamStageName] = stage
+		player.world.registerStage(teamStageName, stage)
 	}
 	if area.LoadStrategy == "Personal" {
+		restoreStageSnapshot(stage, player.evictedStages.take(stagename))
 		player.playerStages[stagename] = stage
 	}
 	if area.LoadStrategy == "Individual" {
@@ -212,12 +216,12 @@ func (player *Player) fetchStageSync(stagename string) *Stage {
 func (p *Player) transferBetween(source, dest *Tile) {
 	if source.stage == dest.stage {
 		if transferPlayerWithinStage(p, source, dest) {
-			updateAllAfterMovement(dest, source)
+			updateAllAfterMovement(nil, dest, source)
 			updatePlayerHighlights(p)
 		}
 	} else {
 		if transferPlayerAcrossStages(p, source, dest) {
-			updateAllAfterMovement(dest, source)
+			updateAllAfterMovement(nil, dest, source)
 			updatePlayerAfterStageChange(p)
 			spawnItemsFor(p, dest.stage)
 		}
@@ -253,9 +257,9 @@ func transferPlayerAcrossStages(p *Player, source, dest *Tile) bool {
 	return true
 }
 
-func updateAllAfterMovement(current, previous *Tile) {
-	previous.updateAll(characterBox(previous))
-	current.updateAll(characterBox(current))
+func updateAllAfterMovement(batch *UpdateBatch, current, previous *Tile) {
+	previous.updateAllIn(batch, characterBox(previous))
+	current.updateAllIn(batch, characterBox(current))
 }
 
 func (p *Player) push(tile *Tile, incoming *Interactable, yOff, xOff int) bool { // Returns if given interacable successfully pushed
@@ -298,7 +302,7 @@ func (p *Player) push(tile *Tile, incoming *Interactable, yOff, xOff int) bool {
 
 func (target *Player) takeDamageFrom(initiator Character, dmg int) bool {
 	location := target.getTileSync()
-	if safe(location, target, initiator) {
+	if target.isParked() || safe(location, target, initiator) {
 		return false
 	}
 
@@ -307,6 +311,7 @@ func (target *Player) takeDamageFrom(initiator Character, dmg int) bool {
 		initiator.incrementKillCount()
 		initiator.incrementKillStreak()
 		initiator.updateRecord()
+		target.world.getGameModeSync().onKill(initiator, target)
 
 		go target.world.db.saveKillEvent(location, initiator, target)
 	}
@@ -342,6 +347,9 @@ type NonPlayer struct {
 	killCount    atomic.Int64
 	killCountNpc atomic.Int64
 	killStreak   atomic.Int64
+	seed         int64
+	rng          *rand.Rand                  // Used only by the npc's own actions
+	batch        atomic.Pointer[UpdateBatch] // Of the tick running the npc's action, nil otherwise
 }
 
 func (npc *NonPlayer) getName() string {
@@ -372,6 +380,7 @@ func (npc *NonPlayer) fetchStageSync(stagename string) *Stage {
 	defer npc.world.wStageMutex.Unlock()
 	stage, ok := npc.world.worldStages[stagename]
 	if ok && stage != nil {
+		stage.touch()
 		return stage
 	}
 
@@ -382,7 +391,7 @@ func (npc *NonPlayer) fetchStageSync(stagename string) *Stage {
 
 	stage = createStageFromArea(area) // can create empty stage
 	if area.LoadStrategy == "" {
-		npc.world.worldStages[stagename] = stage
+		npc.world.registerStage(stagename, stage)
 	}
 	if area.LoadStrategy == "Personal" {
 		// npc does not have personal stages
@@ -398,7 +407,7 @@ func (npc *NonPlayer) fetchStageSync(stagename string) *Stage {
 
 func (npc *NonPlayer) transferBetween(source, dest *Tile) {
 	if transferNPCBetweenTiles(npc, source, dest) {
-		updateAllAfterMovement(dest, source)
+		updateAllAfterMovement(npc.batch.Load(), dest, source)
 	}
 }
 
@@ -517,11 +526,19 @@ func spawnNewNPCDoingAction(ref *Player, team string, interval, duration int, ac
 		addNPCAndNotifyOthers(npc, tile)
 	}
 
+	ref.world.recorder.recordNpcSpawn(npc)
 	if action != nil {
-		go doAtIntervalUntilTermination(npc, ctx, interval, action)
+		if ref.world.recorder != nil {
+			action = recordingNpcMoves(action)
+		}
+		scheduleNpcAction(npc, ctx, time.Duration(interval)*time.Millisecond, action)
 	}
 
-	go removeAfterWaiting(npc, duration) // Remove after 7.5 min
+	var stage *Stage
+	if tile := npc.getTileSync(); tile != nil {
+		stage = tile.stage
+	}
+	scheduleAfter(stage, time.Duration(duration)*time.Second, func(*UpdateBatch) { removeNpc(npc) }) // Remove after 7.5 min
 
 	return npc
 }
@@ -529,6 +546,7 @@ func spawnNewNPCDoingAction(ref *Player, team string, interval, duration int, ac
 func createNewNPC(world *World, team string) (*NonPlayer, context.Context) {
 	username := uuid.New().String()
 	ctx, cancel := context.WithCancel(context.Background())
+	seed := rand.Int63()
 	npc := &NonPlayer{
 		id:        username,
 		terminate: cancel,
@@ -536,6 +554,8 @@ func createNewNPC(world *World, team string) (*NonPlayer, context.Context) {
 		team:      team,
 		icon:      "red-b thick r0",
 		iconLow:   "dark-red-b thick r0",
+		seed:      seed,
+		rng:       rand.New(rand.NewSource(seed)),
 	}
 	npc.health.Store(int64(100))
 	npc.money.Store(int64(20))
@@ -562,15 +582,14 @@ func doAtIntervalUntilTermination(npc *NonPlayer, ctx context.Context, interval
 	}
 }
 
-func removeAfterWaiting(npc *NonPlayer, seconds int) {
-	time.Sleep(time.Duration(seconds) * time.Second)
-
+func removeNpc(npc *NonPlayer) {
+	npc.world.recorder.recordNpcRemove(npc)
 	removeNpcFromTile(npc)
 	npc.terminate()
 }
 
 func moveRandomlyAndActivatePower(npc *NonPlayer) {
-	randn := rand.Intn(5000)
+	randn := npc.rng.Intn(5000)
 	if randn%4 == 0 {
 		moveNorth(npc)
 	}
@@ -602,7 +621,7 @@ func moveAgressiveRand(shapes [][][2]int) func(*NonPlayer) {
 }
 
 func moveAggressively(npc *NonPlayer, shapes [][][2]int, offenceDirection int) {
-	randn := rand.Intn(5000)
+	randn := npc.rng.Intn(5000)
 	direction := randn % 4
 	if direction == 0 {
 		moveNorth(npc)
@@ -622,7 +641,7 @@ func moveAggressively(npc *NonPlayer, shapes [][][2]int, offenceDirection int) {
 }
 
 func moveRandomly(npc *NonPlayer) {
-	randn := rand.Intn(4)
+	randn := npc.rng.Intn(4)
 	if randn%4 == 0 {
 		moveNorth(npc)
 	}
@@ -641,9 +660,14 @@ var shapesNpc = [][][2]int{grid7x7, grid5x5, longCross(4), jumpCross()}
 
 func activatePower(npc *NonPlayer, shapes [][][2]int) {
 	// list should belong to npc?
+	shape := shapes[npc.rng.Intn(len(shapes))]
+	npc.world.recorder.recordNpcPower(npc, shape)
+	activatePowerShape(npc, shape)
+}
+
+func activatePowerShape(npc *NonPlayer, shape [][2]int) {
 	currentTile := npc.getTileSync()
-	rand := rand.Intn(len(shapes))
-	absCoordinatePairs := applyRelativeDistance(currentTile.y, currentTile.x, shapes[rand])
+	absCoordinatePairs := applyRelativeDistance(currentTile.y, currentTile.x, shape)
 	tiles := make([]*Tile, 0)
 	for _, pair := range absCoordinatePairs {
 		if validCoordinate(pair[0], pair[1], currentTile.stage) {
@@ -651,7 +675,7 @@ func activatePower(npc *NonPlayer, shapes [][][2]int) {
 			tiles = append(tiles, tile)
 		}
 	}
-	damageAndIndicate(tiles, npc, 50)
+	damageAndIndicate(tiles, npc, 50, npc.batch.Load())
 }
 
 //////////////////////////////////////////////////////////////////////
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CHAT_MAX_LENGTH = 200
+	CHAT_BURST      = 5                // Messages allowed back to back
+	CHAT_WINDOW     = 10 * time.Second // Window for CHAT_BURST
+	PROFANITY_FILE  = "./data/profanity.txt"
+)
+
+const (
+	chatTeam  = "team"
+	chatStage = "stage"
+	chatWorld = "world"
+)
+
+type ChatState struct {
+	sync.Mutex
+	sent  []time.Time     // Within CHAT_WINDOW
+	mutes map[string]bool // By username
+}
+
+// One word per line, replaced by asterisks. Loaded once at startup.
+var profanityRegex = loadProfanityRegex(PROFANITY_FILE)
+
+func loadProfanityRegex(path string) *regexp.Regexp {
+	words := []string{"fuck", "shit", "bitch", "cunt", "asshole"}
+	if file, err := os.Open(path); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if word := strings.TrimSpace(scanner.Text()); word != "" && !strings.HasPrefix(word, "#") {
+				words = append(words, regexp.QuoteMeta(strings.ToLower(word)))
+			}
+		}
+	}
+	return regexp.MustCompile(`(?i)\b(` + strings.Join(words, "|") + `)\b`)
+}
+
+func filterProfanity(message string) string {
+	return profanityRegex.ReplaceAllStringFunc(message, func(word string) string {
+		return strings.Repeat("*", len(word))
+	})
+}
+
+////////////////////////////////////////////////////////////
+// Events
+
+func (player *Player) handleChat(channel, message string) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return
+	}
+	if command, name, ok := strings.Cut(message, " "); ok && (command == "/mute" || command == "/unmute") {
+		player.setMuted(strings.TrimSpace(name), command == "/mute")
+		return
+	}
+	if !player.chat.allow(time.Now()) {
+		sendChatNotice(player, "You are sending messages too quickly.")
+		return
+	}
+	if runes := []rune(message); len(runes) > CHAT_MAX_LENGTH {
+		message = string(runes[:CHAT_MAX_LENGTH])
+	}
+
+	line := chatLine(channel, player.username, player.getTeamNameSync(), message)
+	event := ChatEvent{Type: "chat", Channel: channel, From: player.username, Text: stripColors(filterProfanity(message))}
+	for _, recipient := range chatRecipients(player, channel) {
+		if recipient == player || !recipient.chat.isMuted(player.username) {
+			recipient.updates <- recipient.render(line, event)
+		}
+	}
+}
+
+func chatRecipients(player *Player, channel string) []*Player {
+	recipients := make([]*Player, 0)
+	var stage *Stage
+	if tile := player.getTileSync(); tile != nil {
+		stage = tile.stage
+	}
+	for _, other := range player.world.copyOfPlayers() {
+		switch channel {
+		case chatTeam:
+			if other.getTeamNameSync() != player.getTeamNameSync() {
+				continue
+			}
+		case chatStage:
+			if tile := other.getTileSync(); stage == nil || tile == nil || tile.stage != stage {
+				continue
+			}
+		}
+		recipients = append(recipients, other)
+	}
+	if len(recipients) == 0 {
+		recipients = append(recipients, player) // Mid transfer
+	}
+	return recipients
+}
+
+func (player *Player) setMuted(username string, muted bool) {
+	if username == "" || username == player.username {
+		return
+	}
+	player.chat.Lock()
+	if player.chat.mutes == nil {
+		player.chat.mutes = make(map[string]bool)
+	}
+	if muted {
+		player.chat.mutes[username] = true
+	} else {
+		delete(player.chat.mutes, username)
+	}
+	player.chat.Unlock()
+
+	if muted {
+		sendChatNotice(player, "Muted "+username+".")
+	} else {
+		sendChatNotice(player, "Unmuted "+username+".")
+	}
+}
+
+func (chat *ChatState) isMuted(username string) bool {
+	chat.Lock()
+	defer chat.Unlock()
+	return chat.mutes[username]
+}
+
+func (chat *ChatState) allow(now time.Time) bool {
+	chat.Lock()
+	defer chat.Unlock()
+	recent := chat.sent[:0]
+	for _, sent := range chat.sent {
+		if now.Sub(sent) < CHAT_WINDOW {
+			recent = append(recent, sent)
+		}
+	}
+	chat.sent = recent
+	if len(chat.sent) >= CHAT_BURST {
+		return false
+	}
+	chat.sent = append(chat.sent, now)
+	return true
+}
+
+////////////////////////////////////////////////////////////
+// Html
+
+const chatLineTemplate = `
+<div hx-swap-oob="beforeend:#chat_log">
+	<p class="chat-line" data-channel="%s" data-from="%s"><strong class="%s-t">%s</strong> [%s]: %s</p>
+</div>`
+
+// Player text is escaped before markup so that only @[text|color] and *[color] produce html
+func chatLine(channel, username, team, message string) string {
+	text := processStringForColors(html.EscapeString(filterProfanity(message)))
+	name := html.EscapeString(username)
+	return fmt.Sprintf(chatLineTemplate, channel, name, html.EscapeString(team), name, channel, text)
+}
+
+const chatNoticeTemplate = `
+<div hx-swap-oob="beforeend:#chat_log">
+	<p class="chat-line" data-channel="notice" data-from=""><em>%s</em></p>
+</div>`
+
+func sendChatNotice(player *Player, notice string) {
+	line := fmt.Sprintf(chatNoticeTemplate, html.EscapeString(notice))
+	player.updates <- player.render(line, ChatEvent{Type: "chat", Channel: "notice", Text: notice})
+}
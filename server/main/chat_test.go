@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func createChatTestingWorld(t *testing.T) *World {
+	return createWorldWithAreasForTesting(t, &testingConfig,
+		Area{Name: "test-chat", SpawnStrategy: "none", Tiles: walkableTilesForTesting(1, 4)},
+		Area{Name: "test-chat-other", SpawnStrategy: "none", Tiles: walkableTilesForTesting(1, 4)},
+	)
+}
+
+func joinChatTestingPlayer(t *testing.T, world *World, username, team, stagename string, x int) (*Player, *CapturingConn) {
+	conn := &CapturingConn{}
+	record := PlayerRecord{Username: username, Team: team, StageName: stagename, Y: 0, X: x, Health: 100}
+	return joinPlayerForTesting(t, world, record, conn), conn
+}
+
+func chatReceived(conn *CapturingConn, text string) bool {
+	time.Sleep(60 * time.Millisecond)
+	return strings.Contains(conn.written(), text)
+}
+
+func TestChatChannelsReachTheirScope(t *testing.T) {
+	world := createChatTestingWorld(t)
+	sender, _ := joinChatTestingPlayer(t, world, "sender", "fuchsia", "test-chat", 0)
+	_, teammate := joinChatTestingPlayer(t, world, "teammate", "fuchsia", "test-chat-other", 1)
+	_, neighbor := joinChatTestingPlayer(t, world, "neighbor", "sky-blue", "test-chat", 2)
+
+	sender.handlePress(&PlayerSocketEvent{Name: "chat-team", Arg0: "team hello"}, "")
+	if !chatReceived(teammate, "team hello") || chatReceived(neighbor, "team hello") {
+		t.Error("team chat should only reach the team")
+	}
+	sender.handlePress(&PlayerSocketEvent{Name: "chat-stage", Arg0: "stage hello"}, "")
+	if !chatReceived(neighbor, "stage hello") || chatReceived(teammate, "stage hello") {
+		t.Error("stage chat should only reach the stage")
+	}
+	sender.handlePress(&PlayerSocketEvent{Name: "chat-world", Arg0: "world hello"}, "")
+	if !chatReceived(neighbor, "world hello") || !chatReceived(teammate, "world hello") {
+		t.Error("world chat should reach everyone")
+	}
+}
+
+func TestMutedPlayersAreNotHeard(t *testing.T) {
+	world := createChatTestingWorld(t)
+	sender, _ := joinChatTestingPlayer(t, world, "loud", "fuchsia", "test-chat", 0)
+	listener, conn := joinChatTestingPlayer(t, world, "listener", "fuchsia", "test-chat", 1)
+
+	listener.handlePress(&PlayerSocketEvent{Name: "chat-world", Arg0: "/mute loud"}, "")
+	sender.handlePress(&PlayerSocketEvent{Name: "chat-world", Arg0: "muted hello"}, "")
+	if chatReceived(conn, "muted hello") {
+		t.Error("muted player should not be heard")
+	}
+	listener.handlePress(&PlayerSocketEvent{Name: "unmute", Arg0: "loud"}, "")
+	sender.handlePress(&PlayerSocketEvent{Name: "chat-world", Arg0: "unmuted hello"}, "")
+	if !chatReceived(conn, "unmuted hello") {
+		t.Error("unmuted player should be heard")
+	}
+}
+
+func TestChatRateLimit(t *testing.T) {
+	var chat ChatState
+	now := time.Now()
+	for i := range CHAT_BURST {
+		if !chat.allow(now) {
+			t.Fatalf("message %d should be allowed", i)
+		}
+	}
+	if chat.allow(now) {
+		t.Error("burst should be limited")
+	}
+	if !chat.allow(now.Add(CHAT_WINDOW)) {
+		t.Error("limit should lift after the window")
+	}
+}
+
+func TestChatLineEscapesAndFilters(t *testing.T) {
+	line := chatLine(chatWorld, "<b>", "fuchsia", "<script>shit</script> @[hi|red]")
+	if strings.Contains(line, "<script>") || strings.Contains(line, "<b>") {
+		t.Error("player text should be escaped")
+	}
+	if !strings.Contains(line, "****") || strings.Contains(line, "shit") {
+		t.Error("profanity should be filtered")
+	}
+	if !strings.Contains(line, `<strong class="red-t">hi</strong>`) {
+		t.Error("color markup should be rendered")
+	}
+
+}
+
+func TestChatReachesJsonClientsAsEvents(t *testing.T) {
+	world := createChatTestingWorld(t)
+	sender, _ := joinChatTestingPlayer(t, world, "sender", "fuchsia", "test-chat", 0)
+	capture := &CapturingConn{}
+	conn, _ := negotiateProtocol(capture, PROTOCOL_JSON)
+	joinPlayerForTesting(t, world, PlayerRecord{Username: "reader", Team: "fuchsia", StageName: "test-chat", X: 1, Health: 100}, conn)
+
+	sender.handlePress(&PlayerSocketEvent{Name: "chat-stage", Arg0: "<script>shit</script> @[hi|red]"}, "")
+	time.Sleep(60 * time.Millisecond)
+	capture.Lock()
+	defer capture.Unlock()
+	for _, message := range capture.messages {
+		for _, event := range decodeEvents(t, message) {
+			if event["type"] != "chat" {
+				continue
+			}
+			if event["channel"] != chatStage || event["from"] != "sender" || event["text"] != "<script>****</script> hi" {
+				t.Errorf("unexpected chat event %v", event)
+			}
+			return
+		}
+	}
+	t.Error("expected a chat event")
+}
@@ -0,0 +1,754 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	USERS_FILE     = "users.json"
+	PLAYERS_DIR    = "players" // One file per record
+	SNAPSHOTS_FILE = "snapshots.json"
+	DAILY_FILE     = "daily_events.json"
+	SEASONS_FILE   = "seasons.json"
+	BANS_FILE      = "bans.json"
+	SESSIONS_FILE  = "sessions.jsonl" // Append only
+	EVENTS_FILE    = "events.jsonl"   // Append only
+)
+
+// Embedded storage for development and small servers. Everything is held in memory, keyed
+// collections are rewritten on change, players one record at a time, and logs are appended to.
+// An empty dir writes nothing.
+type FileStore struct {
+	sync.Mutex
+	dir       string
+	users     map[string]UserRecord          // By identifier
+	players   map[string]PlayerRecord        // By username
+	snapshots map[string]StageSnapshotRecord // By server and key
+	daily     map[string]DailyEventRecord    // By DailyEventRecord.key
+	seasons   map[int]SeasonStandingsRecord  // Archived, by season
+	bans      map[string]BanRecord           // By username
+	sessions  []SessionDataRecord
+	events    []EventRecord
+}
+
+func createMemoryStore() *FileStore {
+	return &FileStore{
+		users:     make(map[string]UserRecord),
+		players:   make(map[string]PlayerRecord),
+		snapshots: make(map[string]StageSnapshotRecord),
+		daily:     make(map[string]DailyEventRecord),
+		seasons:   make(map[int]SeasonStandingsRecord),
+		bans:      make(map[string]BanRecord),
+		sessions:  make([]SessionDataRecord, 0),
+		events:    make([]EventRecord, 0),
+	}
+}
+
+func openFileStore(dir string) (*FileStore, error) {
+	store := createMemoryStore()
+	store.dir = dir
+	if dir == "" {
+		return store, nil
+	}
+	if err := os.MkdirAll(store.path(PLAYERS_DIR), 0o755); err != nil {
+		return nil, err
+	}
+	loaders := []error{
+		readJsonFile(store.path(USERS_FILE), &store.users),
+		readPlayerFiles(store.path(PLAYERS_DIR), store.players),
+		readJsonFile(store.path(SNAPSHOTS_FILE), &store.snapshots),
+		readJsonFile(store.path(DAILY_FILE), &store.daily),
+		readJsonFile(store.path(SEASONS_FILE), &store.seasons),
+		readJsonFile(store.path(BANS_FILE), &store.bans),
+		readJsonLines(store.path(SESSIONS_FILE), func(line []byte) error {
+			var record SessionDataRecord
+			if err := json.Unmarshal(line, &record); err != nil {
+				return err
+			}
+			store.sessions = append(store.sessions, record)
+			return nil
+		}),
+		readJsonLines(store.path(EVENTS_FILE), func(line []byte) error {
+			var record EventRecord
+			if err := json.Unmarshal(line, &record); err != nil {
+				return err
+			}
+			store.events = append(store.events, record)
+			return nil
+		}),
+	}
+	if err := errors.Join(loaders...); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (store *FileStore) path(name string) string {
+	return filepath.Join(store.dir, name)
+}
+
+////////////////////////////////////////////////////////////
+// Users
+
+func (store *FileStore) getAuthorizedUserById(identifier string) *UserRecord {
+	store.Lock()
+	defer store.Unlock()
+	user, ok := store.users[identifier]
+	if !ok {
+		return nil
+	}
+	return &user
+}
+
+func (store *FileStore) insertAuthorizedUser(user UserRecord) error {
+	store.Lock()
+	defer store.Unlock()
+	if _, ok := store.users[user.Identifier]; ok {
+		return fmt.Errorf("duplicate user: %s", user.Identifier)
+	}
+	store.users[user.Identifier] = user
+	return store.saveLocked(USERS_FILE, store.users)
+}
+
+// Only a user without a username may be given one
+func (store *FileStore) updateUsernameForUserWithId(identifier, username string) bool {
+	store.Lock()
+	defer store.Unlock()
+	user, ok := store.users[identifier]
+	if !ok || user.Username != "" {
+		return false
+	}
+	user.Username = username
+	store.users[identifier] = user
+	return store.saveLocked(USERS_FILE, store.users) == nil
+}
+
+// Both collections are only saved once every check has passed
+func (store *FileStore) linkGuestToUser(identifier, guest, username string) (string, error) {
+	store.Lock()
+	defer store.Unlock()
+	user, ok := store.users[identifier]
+	if !ok {
+		return "", errRecordNotFound
+	}
+	guestRecord, ok := store.players[guest]
+	if !ok {
+		return "", errRecordNotFound
+	}
+	if !idBelongsToGuest(guest) || guestRecord.GuestCreateTime == nil {
+		return "", errNotAGuest
+	}
+	if playerOnline(guestRecord) {
+		return "", errPlayerOnline
+	}
+	if user.Username == "" {
+		if _, ok := store.players[username]; ok {
+			return "", errUsernameTaken
+		}
+		store.players[username] = adoptGuestRecord(guestRecord, username)
+		user.Username = username
+		store.users[identifier] = user
+	} else {
+		target, ok := store.players[user.Username]
+		if !ok {
+			return "", errRecordNotFound
+		}
+		if playerOnline(target) {
+			return "", errPlayerOnline
+		}
+		mergeGuestRecord(&target, guestRecord)
+		store.players[user.Username] = target
+	}
+	delete(store.players, guest)
+	return user.Username, errors.Join(store.savePlayerLocked(user.Username), store.savePlayerLocked(guest), store.saveLocked(USERS_FILE, store.users))
+}
+
+////////////////////////////////////////////////////////////
+// Players
+
+func (store *FileStore) InsertPlayerRecord(player PlayerRecord) error {
+	store.Lock()
+	defer store.Unlock()
+	if _, ok := store.players[player.Username]; ok {
+		return fmt.Errorf("duplicate player: %s", player.Username)
+	}
+	store.players[player.Username] = player
+	return store.savePlayerLocked(player.Username)
+}
+
+func (store *FileStore) getPlayerRecord(username string) (PlayerRecord, error) {
+	store.Lock()
+	defer store.Unlock()
+	record, ok := store.players[username]
+	if !ok {
+		return PlayerRecord{}, errRecordNotFound
+	}
+	return record, nil
+}
+
+func (store *FileStore) foundUsername(username string) bool {
+	_, err := store.getPlayerRecord(username)
+	return err == nil
+}
+
+func (store *FileStore) updateRecordForPlayer(p *Player, pTile *Tile) error {
+	return store.updatePlayer(p.username, func(record *PlayerRecord) {
+		applyPlayerSnapshot(record, p, pTile)
+	})
+}
+
+func (store *FileStore) updateLoginForPlayer(p *Player) error {
+	return store.updatePlayer(p.username, func(record *PlayerRecord) {
+		record.LastLogin = time.Now()
+	})
+}
+
+func (store *FileStore) updatePlayerRecordOnLogout(p *Player, pTile *Tile) error {
+	return store.updatePlayer(p.username, func(record *PlayerRecord) {
+		applyPlayerSnapshot(record, p, pTile)
+		record.LastLogout = time.Now()
+	})
+}
+
+func (store *FileStore) updateTeamForPlayer(username, team string) error {
+	return store.updatePlayer(username, func(record *PlayerRecord) {
+		record.Team = team
+	})
+}
+
+func (store *FileStore) addAccomplishmentToPlayer(username string, key string, value Accomplishment) error {
+	return store.updatePlayer(username, func(record *PlayerRecord) {
+		if record.Accomplishments == nil {
+			record.Accomplishments = make(map[string]Accomplishment)
+		}
+		record.Accomplishments[key] = value
+	})
+}
+
+func (store *FileStore) updateInventoryForPlayer(username string, inventory InventoryRecord) error {
+	return store.updatePlayer(username, func(record *PlayerRecord) {
+		record.Inventory = inventory
+	})
+}
+
+// Like an update without upsert, unknown players are ignored
+func (store *FileStore) updatePlayer(username string, update func(record *PlayerRecord)) error {
+	store.Lock()
+	defer store.Unlock()
+	record, ok := store.players[username]
+	if !ok {
+		return nil
+	}
+	update(&record)
+	store.players[username] = record
+	return store.savePlayerLocked(username)
+}
+
+// Same fields as createPlayerSnapShot
+func applyPlayerSnapshot(record *PlayerRecord, p *Player, pTile *Tile) {
+	record.X = pTile.x
+	record.Y = pTile.y
+	record.Health = p.health.Load()
+	record.StageName = pTile.stage.name
+	record.Money = p.money.Load()
+	record.Stats = statsRecordFromPlayerStats(&p.PlayerStats)
+	record.Inventory = p.inventory.record()
+}
+
+////////////////////////////////////////////////////////////
+// Events
+
+func (store *FileStore) saveKillEvent(tile *Tile, initiator Character, defeated *Player) error {
+	_, isPlayer := initiator.(*Player)
+	return store.appendEvent(EventRecord{
+		Owner:     initiator.getName(),
+		Secondary: defeated.username,
+		Type:      EVENT_KILL,
+		Created:   time.Now(),
+		StageName: tile.stage.name,
+		X:         tile.x,
+		Y:         tile.y,
+		Team:      initiator.getTeamNameSync(),
+		Npc:       !isPlayer,
+	})
+}
+
+func (store *FileStore) saveScoreEvent(tile *Tile, initiator *Player, message string) error {
+	return store.appendEvent(EventRecord{
+		Owner:     initiator.username,
+		Type:      EVENT_SCORE,
+		Created:   time.Now(),
+		StageName: tile.stage.name,
+		X:         tile.x,
+		Y:         tile.y,
+		Details:   message,
+		Team:      initiator.getTeamNameSync(),
+	})
+}
+
+func (store *FileStore) savePurchaseEvent(tile *Tile, buyer *Player, itemId string, price int64) error {
+	return store.appendEvent(EventRecord{
+		Owner:     buyer.username,
+		Type:      EVENT_PURCHASE,
+		Created:   time.Now(),
+		StageName: tile.stage.name,
+		X:         tile.x,
+		Y:         tile.y,
+		Details:   itemId,
+		Amount:    price,
+	})
+}
+
+func (store *FileStore) appendEvent(event EventRecord) error {
+	store.Lock()
+	defer store.Unlock()
+	store.events = append(store.events, event)
+	return store.appendLocked(EVENTS_FILE, event)
+}
+
+func (store *FileStore) countEventsByTile(ctx context.Context, stageName, eventType string, from, to time.Time) ([]HeatmapCell, error) {
+	store.Lock()
+	defer store.Unlock()
+	counts := make(map[[2]int]int)
+	for _, event := range store.events {
+		if event.StageName != stageName || event.Type != eventType || event.Created.Before(from) || !event.Created.Before(to) {
+			continue
+		}
+		counts[[2]int{event.Y, event.X}]++
+	}
+	out := make([]HeatmapCell, 0, len(counts))
+	for position, count := range counts {
+		out = append(out, HeatmapCell{Y: position[0], X: position[1], Count: count})
+	}
+	return out, nil
+}
+
+////////////////////////////////////////////////////////////
+// Session data
+
+func (store *FileStore) getMostRecentSessionData(ctx context.Context, serverName string) (*SessionDataRecord, error) {
+	store.Lock()
+	defer store.Unlock()
+	var latest *SessionDataRecord
+	for i := range store.sessions {
+		record := &store.sessions[i]
+		if record.ServerName == serverName && (latest == nil || record.Timestamp.After(latest.Timestamp)) {
+			latest = record
+		}
+	}
+	if latest == nil {
+		return nil, errRecordNotFound
+	}
+	out := *latest
+	return &out, nil
+}
+
+func (store *FileStore) saveGameStatus(ctx context.Context, status SessionDataRecord) error {
+	store.Lock()
+	defer store.Unlock()
+	store.sessions = append(store.sessions, status)
+	return store.appendLocked(SESSIONS_FILE, status)
+}
+
+func (store *FileStore) getStageSnapshots(ctx context.Context, serverName string) ([]StageSnapshotRecord, error) {
+	store.Lock()
+	defer store.Unlock()
+	out := make([]StageSnapshotRecord, 0)
+	for _, record := range store.snapshots {
+		if record.ServerName == serverName {
+			out = append(out, record)
+		}
+	}
+	return out, nil
+}
+
+func (store *FileStore) upsertStageSnapshot(ctx context.Context, record StageSnapshotRecord) error {
+	store.Lock()
+	defer store.Unlock()
+	store.snapshots[record.ServerName+"/"+record.Key] = record
+	return store.saveLocked(SNAPSHOTS_FILE, store.snapshots)
+}
+
+////////////////////////////////////////////////////////////
+// Rankings
+
+func (store *FileStore) getTopNPlayersByField(field string, n int) ([]PlayerRecord, error) {
+	store.Lock()
+	defer store.Unlock()
+	out := make([]PlayerRecord, 0, len(store.players))
+	for _, record := range store.players {
+		if _, ok := playerRecordField(record, field); !ok {
+			return nil, fmt.Errorf("unknown field: %s", field)
+		}
+		out = append(out, record)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, _ := playerRecordField(out[i], field)
+		b, _ := playerRecordField(out[j], field)
+		if a != b {
+			return a > b
+		}
+		return out[i].Username < out[j].Username
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out, nil
+}
+
+func (store *FileStore) rankEventsBy(ctx context.Context, eventType, groupBy string, from, to time.Time, n int) ([]RankedCount, error) {
+	if groupBy != RANK_BY_OWNER && groupBy != RANK_BY_TEAM {
+		return nil, fmt.Errorf("unknown grouping: %s", groupBy)
+	}
+	store.Lock()
+	defer store.Unlock()
+	counts := make(map[string]int64)
+	for _, event := range store.events {
+		if event.Type != eventType || event.Npc || event.Created.Before(from) || !event.Created.Before(to) {
+			continue
+		}
+		name := event.Owner
+		if groupBy == RANK_BY_TEAM {
+			name = event.Team
+		}
+		counts[name]++
+	}
+	fromDay, toDay := rollupDay(from), rollupDay(to)
+	for _, rollup := range store.daily {
+		if rollup.Type != eventType || rollup.Npc || rollup.Day < fromDay || rollup.Day >= toDay {
+			continue
+		}
+		name := rollup.Owner
+		if groupBy == RANK_BY_TEAM {
+			name = rollup.Team
+		}
+		counts[name] += rollup.Count
+	}
+	delete(counts, "") // Events from before teams were recorded
+
+	out := make([]RankedCount, 0, len(counts))
+	for name, count := range counts {
+		out = append(out, RankedCount{Name: name, Count: count})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Name < out[j].Name
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out, nil
+}
+
+func (store *FileStore) getSeasonStandings(ctx context.Context, season int) (*SeasonStandingsRecord, error) {
+	store.Lock()
+	defer store.Unlock()
+	record, ok := store.seasons[season]
+	if !ok {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (store *FileStore) saveSeasonStandings(ctx context.Context, record SeasonStandingsRecord) error {
+	store.Lock()
+	defer store.Unlock()
+	store.seasons[record.Season] = record
+	return store.saveLocked(SEASONS_FILE, store.seasons)
+}
+
+// Mongo field paths as used by the hub
+func playerRecordField(record PlayerRecord, field string) (int64, bool) {
+	switch field {
+	case "money":
+		return record.Money, true
+	case "health":
+		return record.Health, true
+	case "stats.killCount":
+		return record.Stats.KillCount, true
+	case "stats.killCountNpc":
+		return record.Stats.KillCountNpc, true
+	case "stats.peakKillStreak":
+		return record.Stats.PeakKillStreak, true
+	case "stats.deathCount":
+		return record.Stats.DeathCount, true
+	case "stats.goalsScored":
+		return record.Stats.GoalsScored, true
+	case "stats.peakWealth":
+		return record.Stats.PeakWealth, true
+	}
+	return 0, false
+}
+
+////////////////////////////////////////////////////////////
+// Retention
+
+func (store *FileStore) countInactiveGuests(ctx context.Context, before time.Time) (int64, error) {
+	store.Lock()
+	defer store.Unlock()
+	var count int64
+	for _, record := range store.players {
+		if inactiveGuest(record, before) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (store *FileStore) deleteInactiveGuests(ctx context.Context, before time.Time) (int64, error) {
+	store.Lock()
+	defer store.Unlock()
+	var count int64
+	var errs []error
+	for username, record := range store.players {
+		if inactiveGuest(record, before) {
+			delete(store.players, username)
+			errs = append(errs, store.savePlayerLocked(username))
+			count++
+		}
+	}
+	return count, errors.Join(errs...)
+}
+
+func (store *FileStore) rollupEventsBefore(ctx context.Context, before time.Time) ([]DailyEventRecord, error) {
+	store.Lock()
+	defer store.Unlock()
+	return store.rollupEventsLocked(func(event EventRecord) bool { return event.Created.Before(before) }), nil
+}
+
+// Marks are kept in memory, events are written without them
+func (store *FileStore) expireEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	store.Lock()
+	defer store.Unlock()
+	expired := int64(0)
+	for i := range store.events {
+		if store.events[i].Created.Before(before) && !store.events[i].Expired {
+			store.events[i].Expired = true
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+func (store *FileStore) rollupExpiredEvents(ctx context.Context) ([]DailyEventRecord, error) {
+	store.Lock()
+	defer store.Unlock()
+	return store.rollupEventsLocked(func(event EventRecord) bool { return event.Expired }), nil
+}
+
+func (store *FileStore) rollupEventsLocked(include func(EventRecord) bool) []DailyEventRecord {
+	rollups := make(map[string]DailyEventRecord)
+	for _, event := range store.events {
+		if !include(event) {
+			continue
+		}
+		rollup := DailyEventRecord{Day: rollupDay(event.Created), Type: event.Type, Owner: event.Owner, StageName: event.StageName, Team: event.Team, Npc: event.Npc}
+		key := rollup.key()
+		if existing, ok := rollups[key]; ok {
+			rollup = existing
+		}
+		rollup.Count++
+		rollup.Amount += event.Amount
+		rollups[key] = rollup
+	}
+	out := make([]DailyEventRecord, 0, len(rollups))
+	for _, key := range sortedKeys(rollups) {
+		out = append(out, rollups[key])
+	}
+	return out
+}
+
+func (store *FileStore) saveDailyEvents(ctx context.Context, records []DailyEventRecord) error {
+	store.Lock()
+	defer store.Unlock()
+	for _, record := range records {
+		existing := store.daily[record.key()]
+		record.Count += existing.Count
+		record.Amount += existing.Amount
+		store.daily[record.key()] = record
+	}
+	return store.saveLocked(DAILY_FILE, store.daily)
+}
+
+// The append only log is rewritten without the removed events
+func (store *FileStore) deleteExpiredEvents(ctx context.Context) (int64, error) {
+	store.Lock()
+	defer store.Unlock()
+	kept := make([]EventRecord, 0, len(store.events))
+	for _, event := range store.events {
+		if !event.Expired {
+			kept = append(kept, event)
+		}
+	}
+	removed := int64(len(store.events) - len(kept))
+	if removed == 0 {
+		return 0, nil
+	}
+	store.events = kept
+	return removed, store.rewriteEventsLocked(kept)
+}
+
+////////////////////////////////////////////////////////////
+// Bans
+
+func (store *FileStore) getBans(ctx context.Context) ([]BanRecord, error) {
+	store.Lock()
+	defer store.Unlock()
+	out := make([]BanRecord, 0, len(store.bans))
+	for _, username := range sortedKeys(store.bans) {
+		out = append(out, store.bans[username])
+	}
+	return out, nil
+}
+
+func (store *FileStore) saveBan(ctx context.Context, ban BanRecord) error {
+	store.Lock()
+	defer store.Unlock()
+	store.bans[ban.Username] = ban
+	return store.saveLocked(BANS_FILE, store.bans)
+}
+
+func (store *FileStore) deleteBan(ctx context.Context, username string) error {
+	store.Lock()
+	defer store.Unlock()
+	delete(store.bans, username)
+	return store.saveLocked(BANS_FILE, store.bans)
+}
+
+////////////////////////////////////////////////////////////
+// Files
+
+// Written to a temporary file first so that a crash never leaves a partial collection
+func (store *FileStore) saveLocked(name string, value any) error {
+	if store.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	temp := store.path(name + ".tmp")
+	if err := os.WriteFile(temp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temp, store.path(name))
+}
+
+// Only the changed record is written, a removed player's file is deleted
+func (store *FileStore) savePlayerLocked(username string) error {
+	if store.dir == "" {
+		return nil
+	}
+	path := filepath.Join(store.path(PLAYERS_DIR), url.PathEscape(username)+".json")
+	record, ok := store.players[username]
+	if !ok {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (store *FileStore) appendLocked(name string, value any) error {
+	if store.dir == "" {
+		return nil
+	}
+	line, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(store.path(name), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func (store *FileStore) rewriteEventsLocked(events []EventRecord) error {
+	if store.dir == "" {
+		return nil
+	}
+	var buffer []byte
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		buffer = append(append(buffer, line...), '\n')
+	}
+	temp := store.path(EVENTS_FILE + ".tmp")
+	if err := os.WriteFile(temp, buffer, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temp, store.path(EVENTS_FILE))
+}
+
+func readJsonFile(path string, value any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+func readPlayerFiles(dir string, players map[string]PlayerRecord) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		var record PlayerRecord
+		if err := readJsonFile(path, &record); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		players[record.Username] = record
+	}
+	return nil
+}
+
+func readJsonLines(path string, handle func(line []byte) error) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := handle(scanner.Bytes()); err != nil {
+			logger.Warn().Err(err).Msg("Skipping unreadable line in " + path) // e.g. cut short by a crash
+		}
+	}
+	return scanner.Err()
+}
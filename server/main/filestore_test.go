@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStorePersistsAcrossReopen(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.insertAuthorizedUser(UserRecord{Identifier: "id-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if !store.updateUsernameForUserWithId("id-1", "alice") {
+		t.Error("a user without a username should be given one")
+	}
+	if store.updateUsernameForUserWithId("id-1", "bob") {
+		t.Error("a username should only be set once")
+	}
+	if err := store.InsertPlayerRecord(PlayerRecord{Username: "alice", Team: "fuchsia", Money: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if store.InsertPlayerRecord(PlayerRecord{Username: "alice"}) == nil {
+		t.Error("duplicate players should be rejected")
+	}
+	store.updateTeamForPlayer("alice", "sky-blue")
+	store.addAccomplishmentToPlayer("alice", "first", Accomplishment{Name: "first"})
+	store.saveGameStatus(context.Background(), SessionDataRecord{ServerName: "test", Timestamp: time.Now(), TotalSessionLogins: 3})
+	store.upsertStageSnapshot(context.Background(), StageSnapshotRecord{ServerName: "test", Key: "stage", AreaHash: "a"})
+	store.upsertStageSnapshot(context.Background(), StageSnapshotRecord{ServerName: "test", Key: "stage", AreaHash: "b"})
+
+	reopened, err := openFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user := reopened.getAuthorizedUserById("id-1"); user == nil || user.Username != "alice" {
+		t.Errorf("user not persisted: %v", user)
+	}
+	record, err := reopened.getPlayerRecord("alice")
+	if err != nil || record.Team != "sky-blue" || record.Money != 5 || record.Accomplishments["first"].Name != "first" {
+		t.Errorf("player not persisted: %v %v", record, err)
+	}
+	status, err := reopened.getMostRecentSessionData(context.Background(), "test")
+	if err != nil || status.TotalSessionLogins != 3 {
+		t.Errorf("session not persisted: %v %v", status, err)
+	}
+	snapshots, _ := reopened.getStageSnapshots(context.Background(), "test")
+	if len(snapshots) != 1 || snapshots[0].AreaHash != "b" {
+		t.Errorf("expected one upserted snapshot, got %v", snapshots)
+	}
+}
+
+func TestFileStoreWritesOnePlayerAtATime(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	store.InsertPlayerRecord(PlayerRecord{Username: "alice"})
+	store.InsertPlayerRecord(PlayerRecord{Username: "guest:a/b", GuestCreateTime: &old})
+	alice := filepath.Join(dir, PLAYERS_DIR, "alice.json")
+	before, _ := os.Stat(alice)
+
+	store.updateTeamForPlayer("guest:a/b", "fuchsia")
+	if after, _ := os.Stat(alice); !after.ModTime().Equal(before.ModTime()) {
+		t.Error("updating one player should not rewrite the others")
+	}
+	reopened, _ := openFileStore(dir)
+	if record, err := reopened.getPlayerRecord("guest:a/b"); err != nil || record.Team != "fuchsia" {
+		t.Errorf("expected the guest's update to be persisted, got %v %v", record, err)
+	}
+
+	reopened.deleteInactiveGuests(context.Background(), time.Now())
+	reopened, _ = openFileStore(dir)
+	if reopened.foundUsername("guest:a/b") || !reopened.foundUsername("alice") {
+		t.Error("only the removed guest's file should be deleted")
+	}
+}
+
+func TestFileStoreMissingRecords(t *testing.T) {
+	store := createMemoryStore()
+	if _, err := store.getPlayerRecord("nobody"); err != errRecordNotFound {
+		t.Error("expected errRecordNotFound")
+	}
+	if store.foundUsername("nobody") || store.getAuthorizedUserById("nobody") != nil {
+		t.Error("nothing should be found in an empty store")
+	}
+	if err := store.updateTeamForPlayer("nobody", "fuchsia"); err != nil || store.foundUsername("nobody") {
+		t.Error("updates should not create players")
+	}
+	if _, err := store.getMostRecentSessionData(context.Background(), "test"); err == nil {
+		t.Error("expected an error without any session")
+	}
+}
+
+func TestFileStoreMostRecentSessionByServer(t *testing.T) {
+	store := createMemoryStore()
+	now := time.Now()
+	store.saveGameStatus(context.Background(), SessionDataRecord{ServerName: "test", Timestamp: now, TotalSessionLogins: 2})
+	store.saveGameStatus(context.Background(), SessionDataRecord{ServerName: "test", Timestamp: now.Add(-time.Hour), TotalSessionLogins: 1})
+	store.saveGameStatus(context.Background(), SessionDataRecord{ServerName: "other", Timestamp: now.Add(time.Hour), TotalSessionLogins: 9})
+
+	status, err := store.getMostRecentSessionData(context.Background(), "test")
+	if err != nil || status.TotalSessionLogins != 2 {
+		t.Errorf("expected latest session for server, got %v %v", status, err)
+	}
+}
+
+func TestFileStoreTopNPlayers(t *testing.T) {
+	store := createMemoryStore()
+	store.InsertPlayerRecord(PlayerRecord{Username: "a", Stats: PlayerStatsRecord{KillCount: 1}})
+	store.InsertPlayerRecord(PlayerRecord{Username: "b", Stats: PlayerStatsRecord{KillCount: 7}})
+	store.InsertPlayerRecord(PlayerRecord{Username: "c", Stats: PlayerStatsRecord{KillCount: 7}})
+
+	top, err := store.getTopNPlayersByField("stats.killCount", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || top[0].Username != "b" || top[1].Username != "c" {
+		t.Errorf("unexpected ranking: %v", top)
+	}
+	if _, err := store.getTopNPlayersByField("stats.unknown", 2); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestFileStoreSkipsTruncatedLines(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := openFileStore(dir)
+	store.saveGameStatus(context.Background(), SessionDataRecord{ServerName: "test", Timestamp: time.Now(), TotalSessionLogins: 4})
+	file, _ := os.OpenFile(filepath.Join(dir, SESSIONS_FILE), os.O_APPEND|os.O_WRONLY, 0o644)
+	file.WriteString(`{"ServerName":"te`)
+	file.Close()
+
+	reopened, err := openFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := reopened.getMostRecentSessionData(context.Background(), "test"); status == nil || status.TotalSessionLogins != 4 {
+		t.Error("complete lines should survive a truncated last line")
+	}
+}
+
+func TestHeadlessWorldUsesMemoryStore(t *testing.T) {
+	world := createGameWorld(nil, &testingConfig)
+	if _, ok := world.db.(*FileStore); !ok {
+		t.Fatal("expected a memory store")
+	}
+	saveCurrentStatus(world)
+	if _, err := world.db.getMostRecentSessionData(context.Background(), world.config.serverName); err != nil {
+		t.Error("status should be saved to the memory store")
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const GAME_MODE_TICK_IN_MS = 1000
+
+// Hill time and round lengths can be configured, see Configuration
+const DEFAULT_HILL_TIME_TO_WIN = 5 * time.Minute
+
+// Modify in tests => not const
+var SCORE_TO_WIN = 100
+var KILLS_TO_WIN = 50
+var MONEY_TO_WIN = 20000
+
+type GameMode interface {
+	getName() string
+	getScoreboard() *Scoreboard
+	startRound(world *World)
+	onGoal(scorer *Player, team string) int // Score including the goal
+	onKill(initiator Character, target *Player)
+	onMoneyGained(player *Player, amount int)
+	onTick(world *World, now time.Time)
+	scoreMessage(team string) string
+}
+
+// Nil when the mode is unavailable, e.g. no area has a hill
+var gameModes = map[string]func(config *Configuration) GameMode{
+	"ctf":              createCaptureTheFlag,
+	"team-deathmatch":  createTeamDeathmatch,
+	"king-of-the-hill": createKingOfTheHillFromAreas,
+	"money-race":       createMoneyRace,
+}
+
+////////////////////////////////////////////////////////////
+// Round
+
+// Shared by all modes - Hooks not overridden by a mode are no-ops
+type Round struct {
+	name        string
+	scoreboard  *Scoreboard
+	scoreToWin  int
+	roundLength time.Duration // Zero for untimed rounds
+	startedAt   atomic.Int64
+	reset       func(world *World)
+}
+
+func (round *Round) getName() string {
+	return round.name
+}
+
+func (round *Round) getScoreboard() *Scoreboard {
+	return round.scoreboard
+}
+
+func (round *Round) startRound(world *World) {
+	round.scoreboard.ResetAll()
+	if round.reset != nil {
+		round.reset(world)
+	}
+	round.startedAt.Store(time.Now().UnixNano())
+}
+
+// The configured length applies to every timed mode
+func roundLength(config *Configuration, fallback time.Duration) time.Duration {
+	if config.roundLength > 0 {
+		return config.roundLength
+	}
+	return fallback
+}
+
+func (round *Round) onGoal(scorer *Player, team string) int     { return 0 }
+func (round *Round) onKill(initiator Character, target *Player) {}
+func (round *Round) onMoneyGained(player *Player, amount int)   {}
+
+func (round *Round) onTick(world *World, now time.Time) {
+	round.checkTimer(world, now)
+}
+
+func (round *Round) checkTimer(world *World, now time.Time) {
+	if round.roundLength == 0 {
+		return
+	}
+	started := time.Unix(0, round.startedAt.Load())
+	if now.Sub(started) < round.roundLength {
+		return
+	}
+	round.endRound(world, leadingTeam(round.scoreboard), nil)
+}
+
+func (round *Round) timeRemaining(now time.Time) time.Duration {
+	if round.roundLength == 0 {
+		return 0
+	}
+	remaining := round.roundLength - now.Sub(time.Unix(0, round.startedAt.Load()))
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Returns the new score and if the points won the round
+func (round *Round) addPoints(world *World, team string, points int, scorer *Player) (int, bool) {
+	score := round.scoreboard.Add(team, points)
+	if score < round.scoreToWin {
+		return score, false
+	}
+	round.endRound(world, team, scorer)
+	return score, true
+}
+
+// Empty winning team is a draw
+func (round *Round) endRound(world *World, team string, scorer *Player) {
+	if team == "" {
+		broadcastBottomText(world, "Time is up! The round ended in a draw.")
+	} else {
+		awardHatByTeam(world, team, "winning-team")
+		if scorer != nil {
+			scorer.addAccomplishmentByName(winningAGame)
+			broadcastBottomText(world, fmt.Sprintf("@[%s|%s] won the game for @[%s|%s]!", scorer.username, team, team, team))
+		} else {
+			broadcastBottomText(world, fmt.Sprintf("@[%s|%s] won the game!", team, team))
+		}
+	}
+	round.startRound(world)
+	saveCurrentStatus(world)
+	world.recorder.rotate(world) // One recording per round
+}
+
+func (round *Round) scoreMessage(team string) string {
+	message := "The score is - " + scoresStartingWith(round.scoreboard, team) + ". "
+	if round.roundLength != 0 {
+		message += fmt.Sprintf("(%s remaining)", round.timeRemaining(time.Now()).Round(time.Second))
+	}
+	return message
+}
+
+// e.g. @[fuchsia 3|fuchsia] to @[sky-blue 2|sky-blue]
+func scoresStartingWith(scoreboard *Scoreboard, team string) string {
+	out := fmt.Sprintf("@[%s %d|%s]", team, scoreboard.GetScore(team), team)
+	for _, other := range otherTeamNames(team) {
+		out += fmt.Sprintf(" to @[%s %d|%s]", other, scoreboard.GetScore(other), other)
+	}
+	return out
+}
+
+func leadingTeam(scoreboard *Scoreboard) string {
+	scores := scoreboard.Export()
+	teams := make([]string, 0, len(scores))
+	for team := range scores {
+		teams = append(teams, team)
+	}
+	sort.Strings(teams)
+	leader, best, tied := "", 0, false
+	for _, team := range teams {
+		if scores[team] > best {
+			leader, best, tied = team, scores[team], false
+		} else if scores[team] == best && best > 0 {
+			tied = true
+		}
+	}
+	if tied {
+		return ""
+	}
+	return leader
+}
+
+////////////////////////////////////////////////////////////
+// Capture the flag
+
+type CaptureTheFlag struct {
+	Round
+}
+
+func createCaptureTheFlag(_ *Configuration) GameMode {
+	return &CaptureTheFlag{Round: Round{name: "ctf", scoreboard: &Scoreboard{}, scoreToWin: SCORE_TO_WIN}}
+}
+
+func (mode *CaptureTheFlag) onGoal(scorer *Player, team string) int {
+	world := scorer.world
+	score, won := mode.addPoints(world, team, 1, scorer)
+	if won {
+		return score
+	}
+	message := fmt.Sprintf("@[%s|%s] scored a goal!<br /> The score is: %s", scorer.username, team, scoresStartingWith(mode.scoreboard, team))
+	broadcastBottomText(world, message)
+	saveCurrentStatus(world)
+	return score
+}
+
+////////////////////////////////////////////////////////////
+// Team Deathmatch
+
+type TeamDeathmatch struct {
+	Round
+}
+
+func createTeamDeathmatch(config *Configuration) GameMode {
+	return &TeamDeathmatch{Round: Round{name: "team-deathmatch", scoreboard: &Scoreboard{}, scoreToWin: KILLS_TO_WIN, roundLength: roundLength(config, 15*time.Minute)}}
+}
+
+func (mode *TeamDeathmatch) onKill(initiator Character, target *Player) {
+	scorer, ok := initiator.(*Player)
+	if !ok {
+		return // Npc kills do not score
+	}
+	team := scorer.getTeamNameSync()
+	if team == target.getTeamNameSync() {
+		return
+	}
+	mode.addPoints(target.world, team, 1, scorer)
+}
+
+////////////////////////////////////////////////////////////
+// King of the hill
+
+type HillRegion struct {
+	stagename      string
+	y0, x0, y1, x1 int
+}
+
+type KingOfTheHill struct {
+	Round
+	lock   sync.Mutex // Guards hill, which moves when areas are reloaded, and holder
+	hill   HillRegion
+	holder string
+}
+
+// The hill is read from the areas when the world is created and again on reload, see Area.Hill
+func createKingOfTheHillFromAreas(config *Configuration) GameMode {
+	hill, ok := hillFromAreas()
+	if !ok {
+		return nil
+	}
+	return createKingOfTheHill(hill, config)
+}
+
+// A point per tick held
+func createKingOfTheHill(hill HillRegion, config *Configuration) GameMode {
+	timeToWin := config.hillTimeToWin
+	if timeToWin <= 0 {
+		timeToWin = DEFAULT_HILL_TIME_TO_WIN
+	}
+	scoreToWin := int(timeToWin / (GAME_MODE_TICK_IN_MS * time.Millisecond))
+	mode := &KingOfTheHill{Round: Round{name: "king-of-the-hill", scoreboard: &Scoreboard{}, scoreToWin: scoreToWin, roundLength: roundLength(config, 10*time.Minute)}, hill: hill}
+	mode.reset = func(_ *World) {
+		mode.lock.Lock()
+		defer mode.lock.Unlock()
+		mode.holder = ""
+	}
+	return mode
+}
+
+func (mode *KingOfTheHill) onTick(world *World, now time.Time) {
+	mode.lock.Lock()
+	holder := mode.hill.soleTeam(world)
+	changed := holder != mode.holder
+	mode.holder = holder
+	mode.lock.Unlock()
+
+	if changed && holder != "" {
+		broadcastBottomText(world, fmt.Sprintf("@[%s|%s] has taken the hill!", holder, holder))
+	}
+	if holder != "" {
+		if _, won := mode.addPoints(world, holder, 1, nil); won {
+			return
+		}
+	}
+	mode.checkTimer(world, now)
+}
+
+// A hill no longer in the areas can not be held
+func (mode *KingOfTheHill) refreshHill() {
+	hill, _ := hillFromAreas()
+	mode.lock.Lock()
+	defer mode.lock.Unlock()
+	if hill != mode.hill {
+		mode.hill = hill
+		mode.holder = ""
+	}
+}
+
+func hillFromAreas() (HillRegion, bool) {
+	areasLock.RLock()
+	defer areasLock.RUnlock()
+	for _, area := range areas {
+		if area.Hill != nil {
+			return HillRegion{stagename: area.Name, y0: area.Hill.Y0, x0: area.Hill.X0, y1: area.Hill.Y1, x1: area.Hill.X1}, true
+		}
+	}
+	return HillRegion{}, false
+}
+
+// Contested and empty hills belong to no one. Does not create the stage.
+func (hill HillRegion) soleTeam(world *World) string {
+	world.wStageMutex.Lock()
+	stage := world.worldStages[hill.stagename]
+	world.wStageMutex.Unlock()
+	if stage == nil {
+		return ""
+	}
+	team := ""
+	for _, tile := range getOrderedRegion(stage, hill.y0, hill.x0, hill.y1-hill.y0+1, hill.x1-hill.x0+1) {
+		tile.CharacterMutex.Lock()
+		for _, character := range tile.characterMap {
+			if _, isPlayer := character.(*Player); !isPlayer {
+				continue
+			}
+			characterTeam := character.getTeamNameSync()
+			if team != "" && team != characterTeam {
+				tile.CharacterMutex.Unlock()
+				return ""
+			}
+			team = characterTeam
+		}
+		tile.CharacterMutex.Unlock()
+	}
+	return team
+}
+
+////////////////////////////////////////////////////////////
+// Money race
+
+type MoneyRace struct {
+	Round
+}
+
+func createMoneyRace(config *Configuration) GameMode {
+	return &MoneyRace{Round: Round{name: "money-race", scoreboard: &Scoreboard{}, scoreToWin: MONEY_TO_WIN, roundLength: roundLength(config, 10*time.Minute)}}
+}
+
+func (mode *MoneyRace) onMoneyGained(player *Player, amount int) {
+	if amount <= 0 {
+		return
+	}
+	mode.addPoints(player.world, player.getTeamNameSync(), amount, player)
+}
+
+////////////////////////////////////////////////////////////
+// World
+
+func createGameModes(config *Configuration) map[string]GameMode {
+	out := make(map[string]GameMode, len(gameModes))
+	for name, create := range gameModes {
+		if mode := create(config); mode != nil {
+			out[name] = mode
+		}
+	}
+	return out
+}
+
+func (world *World) getGameModeSync() GameMode {
+	world.gameModeLock.Lock()
+	defer world.gameModeLock.Unlock()
+	return world.gameMode
+}
+
+// Scoreboards of inactive modes are kept
+func (world *World) setGameMode(name string) bool {
+	mode, ok := world.gameModes[name]
+	if !ok {
+		return false
+	}
+	world.gameModeLock.Lock()
+	world.gameMode = mode
+	world.gameModeLock.Unlock()
+	mode.startRound(world)
+	return true
+}
+
+func runGameMode(world *World) {
+	ticker := time.NewTicker(GAME_MODE_TICK_IN_MS * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			world.getGameModeSync().onTick(world, now)
+		case <-world.stopped:
+			return
+		}
+	}
+}
+
+func (world *World) exportScoreboards() map[string]map[string]int {
+	out := make(map[string]map[string]int, len(world.gameModes))
+	for name, mode := range world.gameModes {
+		out[name] = mode.getScoreboard().Export()
+	}
+	return out
+}
+
+// Records from before game modes only have the capture the flag scoreboard
+func (world *World) importScoreboards(record *SessionDataRecord) {
+	if record.ModeScoreboards == nil {
+		world.gameModes["ctf"].getScoreboard().Import(record.Scoreboard)
+		return
+	}
+	for name, scores := range record.ModeScoreboards {
+		if mode, ok := world.gameModes[name]; ok {
+			mode.getScoreboard().Import(scores)
+		}
+	}
+}
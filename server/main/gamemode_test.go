@@ -0,0 +1,156 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func placeTestingPlayers(players ...*Player) {
+	walkable := Material{Walkable: true}
+	stage := createStageFromArea(Area{Name: "test-mode", SpawnStrategy: "none", Tiles: [][]Material{{walkable, walkable, walkable}}})
+	for i, player := range players {
+		placePlayerOnStageAt(player, stage, 0, i)
+	}
+}
+
+func TestTeamDeathmatchScoresKills(t *testing.T) {
+	world := createGameWorld(nil, &testingConfig)
+	if !world.setGameMode("team-deathmatch") {
+		t.Fatal("team-deathmatch should be registered")
+	}
+	killer := createTestingPlayer(world, "killer")
+	killer.team = "fuchsia"
+	target := createTestingPlayer(world, "target")
+	target.team = "sky-blue"
+	placeTestingPlayers(killer, target)
+
+	mode := world.getGameModeSync()
+	for i := 0; i < KILLS_TO_WIN-1; i++ {
+		mode.onKill(killer, target)
+	}
+	if score := mode.getScoreboard().GetScore("fuchsia"); score != KILLS_TO_WIN-1 {
+		t.Fatalf("expected %d, got %d", KILLS_TO_WIN-1, score)
+	}
+	mode.onKill(target, target) // Same team does not score
+	if score := mode.getScoreboard().GetScore("sky-blue"); score != 0 {
+		t.Errorf("same team kill should not score, got %d", score)
+	}
+
+	mode.onTick(world, time.Now().Add(time.Hour))
+	if score := mode.getScoreboard().GetScore("fuchsia"); score != 0 {
+		t.Errorf("scoreboard should reset after the round, got %d", score)
+	}
+	if world.gameModes["ctf"].getScoreboard() == mode.getScoreboard() {
+		t.Error("modes should not share a scoreboard")
+	}
+}
+
+func TestRoundTimerPicksLeader(t *testing.T) {
+	world := createGameWorld(nil, &testingConfig)
+	world.setGameMode("money-race")
+	mode := world.getGameModeSync()
+	player := createTestingPlayer(world, "rich")
+	player.team = "sky-blue"
+	placeTestingPlayers(player)
+
+	mode.onMoneyGained(player, 100)
+	if leadingTeam(mode.getScoreboard()) != "sky-blue" {
+		t.Error("sky-blue should lead")
+	}
+	mode.onTick(world, time.Now().Add(time.Hour))
+	if score := mode.getScoreboard().GetScore("sky-blue"); score != 0 {
+		t.Errorf("round should end when the timer expires, got %d", score)
+	}
+
+	mode.getScoreboard().Add("sky-blue", 5)
+	mode.getScoreboard().Add("fuchsia", 5)
+	if leadingTeam(mode.getScoreboard()) != "" {
+		t.Error("tied teams should draw")
+	}
+}
+
+func TestKingOfTheHillRequiresSoleTeam(t *testing.T) {
+	walkable := Material{Walkable: true}
+	hill := HillRegion{stagename: "test-hill", y0: 0, x0: 0, y1: 0, x1: 1}
+	stage := createStageFromArea(Area{Name: "test-hill", Tiles: [][]Material{{walkable, walkable}}})
+	world := createGameWorld(nil, &testingConfig)
+	world.worldStages["test-hill"] = stage
+
+	mode := createKingOfTheHill(hill, &testingConfig)
+	mode.startRound(world)
+	fuchsia := createTestingPlayer(world, "f")
+	fuchsia.team = "fuchsia"
+	skyBlue := createTestingPlayer(world, "s")
+	skyBlue.team = "sky-blue"
+
+	stage.tiles[0][0].characterMap[fuchsia.id] = fuchsia
+	mode.onTick(world, time.Now())
+	mode.onTick(world, time.Now())
+	if score := mode.getScoreboard().GetScore("fuchsia"); score != 2 {
+		t.Errorf("expected fuchsia to hold the hill for 2 ticks, got %d", score)
+	}
+
+	stage.tiles[0][1].characterMap[skyBlue.id] = skyBlue
+	mode.onTick(world, time.Now())
+	if score := mode.getScoreboard().GetScore("fuchsia"); score != 2 {
+		t.Errorf("contested hill should not score, got %d", score)
+	}
+}
+
+func TestReloadMovesTheHill(t *testing.T) {
+	clinic := Area{Name: "clinic", SpawnStrategy: "none", Tiles: walkableTilesForTesting(1, 1)}
+	withHill := func(hill *HillDescription) []Area {
+		return []Area{clinic, {Name: "test-hill", SpawnStrategy: "none", Tiles: walkableTilesForTesting(4, 4), Hill: hill}}
+	}
+	replaceAreasForTesting(t, withHill(&HillDescription{Y0: 0, X0: 0, Y1: 0, X1: 0}))
+	world := createGameWorld(nil, &testingConfig)
+	mode := world.gameModes["king-of-the-hill"].(*KingOfTheHill)
+
+	if _, err := world.reloadAreas(withHill(&HillDescription{Y0: 2, X0: 2, Y1: 3, X1: 3})); err != nil {
+		t.Fatal(err)
+	}
+	if mode.hill != (HillRegion{stagename: "test-hill", y0: 2, x0: 2, y1: 3, x1: 3}) {
+		t.Errorf("expected the moved hill, got %+v", mode.hill)
+	}
+	if _, err := world.reloadAreas(withHill(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if mode.hill != (HillRegion{}) {
+		t.Errorf("a removed hill should not be held, got %+v", mode.hill)
+	}
+}
+
+func TestGameModesAreConfigured(t *testing.T) {
+	replaceAreasForTesting(t, []Area{{Name: "test-no-hill", Tiles: walkableTilesForTesting(1, 1)}})
+	if _, ok := createGameModes(&testingConfig)["king-of-the-hill"]; ok {
+		t.Error("king of the hill needs an area with a hill")
+	}
+
+	addAreasForTesting(t, Area{Name: "test-hill", Tiles: walkableTilesForTesting(4, 4), Hill: &HillDescription{Y0: 1, X0: 1, Y1: 2, X1: 3}})
+	config := Configuration{roundLength: 3 * time.Minute, hillTimeToWin: 20 * time.Second}
+	modes := createGameModes(&config)
+	hill, ok := modes["king-of-the-hill"].(*KingOfTheHill)
+	if !ok || hill.hill != (HillRegion{stagename: "test-hill", y0: 1, x0: 1, y1: 2, x1: 3}) || hill.scoreToWin != 20 || hill.roundLength != 3*time.Minute {
+		t.Fatalf("expected the hill from the area and the configured lengths, got %+v", modes["king-of-the-hill"])
+	}
+	if race := modes["money-race"].(*MoneyRace); race.roundLength != 3*time.Minute {
+		t.Errorf("expected the configured round length, got %v", race.roundLength)
+	}
+	if deathmatch := createTeamDeathmatch(&testingConfig).(*TeamDeathmatch); deathmatch.roundLength != 15*time.Minute {
+		t.Errorf("expected the mode's own length by default, got %v", deathmatch.roundLength)
+	}
+}
+
+func TestImportLegacyScoreboard(t *testing.T) {
+	world := createGameWorld(nil, &testingConfig)
+	world.importScoreboards(&SessionDataRecord{Scoreboard: map[string]int{"fuchsia": 7}})
+	if score := world.gameModes["ctf"].getScoreboard().GetScore("fuchsia"); score != 7 {
+		t.Errorf("legacy scoreboard should load into ctf, got %d", score)
+	}
+
+	world.importScoreboards(&SessionDataRecord{ModeScoreboards: map[string]map[string]int{"money-race": {"sky-blue": 3}}})
+	exported := world.exportScoreboards()
+	if exported["money-race"]["sky-blue"] != 3 {
+		t.Error("per mode scoreboard was not imported")
+	}
+}
@@ -84,10 +84,7 @@ func (app *App) storeNewGuestSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	identifier := "guest:" + hexid
-	team := "sky-blue"
-	if rand.Intn(2) == 1 {
-		team = "fuchsia"
-	}
+	team := randomTeamName()
 
 	// Add Capcha check
 
@@ -6,4 +6,18 @@ var HAT_NAME_TO_TRIM map[string]string = map[string]string{
 	"most-dangerous": "red-b thick",
 	"puzzle-solve":   "lavender-b thick",
 	"contributor":    "gold-b thick",
+	"orange-trim":    "orange-b med", // Sold in the shop
+	"ice-trim":       "ice-b thick",
+}
+
+// Earning one of these also unlocks its hat, including accomplishments from before the wardrobe
+var ACCOMPLISHMENT_HATS map[string]string = map[string]string{
+	scoreAGoal: "score-a-goal",
+	puzzle0:    "puzzle-solve",
+}
+
+// Worn while the status lasts, these are never kept in the wardrobe
+var STATUS_HATS map[string]bool = map[string]bool{
+	"winning-team":   true,
+	"most-dangerous": true,
 }
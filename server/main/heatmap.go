@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HEATMAP_SCALE         = 8 // Pixels per tile
+	HEATMAP_DEFAULT_RANGE = 7 * 24 * time.Hour
+	HEATMAP_DATE_FORMAT   = "2006-01-02"
+)
+
+var heatmapEventTypes = map[string]string{
+	"kill":  EVENT_KILL,
+	"score": EVENT_SCORE,
+}
+
+var heatmapBackground = color.RGBA{R: 32, G: 32, B: 32, A: 255} // Stages without a map
+
+type HeatmapCell struct {
+	Y     int `bson:"y" json:"y"`
+	X     int `bson:"x" json:"x"`
+	Count int `bson:"count" json:"count"`
+}
+
+type Heatmap struct {
+	Stage  string        `json:"stage"`
+	Type   string        `json:"type"`
+	From   time.Time     `json:"from"`
+	To     time.Time     `json:"to"`
+	Height int           `json:"height"`
+	Width  int           `json:"width"`
+	Total  int           `json:"total"`
+	Max    int           `json:"max"`
+	Cells  []HeatmapCell `json:"cells"`
+}
+
+////////////////////////////////////////////////////////////
+// Handler
+
+// GET /admin/heatmap?stage=&type=kill|score&from=&to=[&format=json]
+func (world *World) adminHeatmap(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	area, ok := areaFromName(query.Get("stage"))
+	if !ok {
+		http.Error(w, "Unknown stage", http.StatusNotFound)
+		return
+	}
+	kind := strings.ToLower(query.Get("type"))
+	if kind == "" {
+		kind = "kill"
+	}
+	eventType, ok := heatmapEventTypes[kind]
+	if !ok {
+		http.Error(w, "Unknown type, expected kill or score", http.StatusBadRequest)
+		return
+	}
+	from, to, err := parseHeatmapRange(query.Get("from"), query.Get("to"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	heatmap, err := buildHeatmap(ctx, world.db, area, eventType, from, to)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to build heatmap for " + area.Name)
+		http.Error(w, "Failed to read events", http.StatusInternalServerError)
+		return
+	}
+
+	if query.Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(heatmap)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	if err := png.Encode(w, renderHeatmap(heatmap, loadStageMap(area))); err != nil {
+		logger.Error().Err(err).Msg("Failed to encode heatmap")
+	}
+}
+
+// Dates or RFC3339 times, a date for to is inclusive and from may also be a duration before now e.g. 72h
+func parseHeatmapRange(fromInput, toInput string, now time.Time) (time.Time, time.Time, error) {
+	to := now
+	if toInput != "" {
+		if parsed, err := time.Parse(HEATMAP_DATE_FORMAT, toInput); err == nil {
+			to = parsed.AddDate(0, 0, 1) // Through the end of that day
+		} else if parsed, err := time.Parse(time.RFC3339, toInput); err == nil {
+			to = parsed
+		} else {
+			return time.Time{}, time.Time{}, errors.New("invalid to: " + toInput)
+		}
+	}
+	from := to.Add(-HEATMAP_DEFAULT_RANGE)
+	if fromInput != "" {
+		if duration, err := time.ParseDuration(fromInput); err == nil {
+			from = now.Add(-duration)
+		} else if parsed, err := time.Parse(HEATMAP_DATE_FORMAT, fromInput); err == nil {
+			from = parsed
+		} else if parsed, err := time.Parse(time.RFC3339, fromInput); err == nil {
+			from = parsed
+		} else {
+			return time.Time{}, time.Time{}, errors.New("invalid from: " + fromInput)
+		}
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
+
+////////////////////////////////////////////////////////////
+// Aggregation
+
+// Events outside of the current layout, e.g. before a resize, are left out
+func buildHeatmap(ctx context.Context, db EventStore, area Area, eventType string, from, to time.Time) (*Heatmap, error) {
+	cells, err := db.countEventsByTile(ctx, area.Name, eventType, from, to)
+	if err != nil {
+		return nil, err
+	}
+	heatmap := &Heatmap{Stage: area.Name, Type: eventType, From: from, To: to, Height: len(area.Tiles), Cells: make([]HeatmapCell, 0, len(cells))}
+	if heatmap.Height > 0 {
+		heatmap.Width = len(area.Tiles[0])
+	}
+	for _, cell := range cells {
+		if cell.Y < 0 || cell.Y >= heatmap.Height || cell.X < 0 || cell.X >= heatmap.Width {
+			continue
+		}
+		heatmap.Cells = append(heatmap.Cells, cell)
+		heatmap.Total += cell.Count
+		heatmap.Max = max(heatmap.Max, cell.Count)
+	}
+	return heatmap, nil
+}
+
+////////////////////////////////////////////////////////////
+// Rendering
+
+// Map images cover the whole space at a pixel per tile, this stage is the region at its grid position
+func loadStageMap(area Area) image.Image {
+	if area.MapId == "" || len(area.Tiles) == 0 {
+		return nil
+	}
+	file, err := os.Open(imagePath(area.MapId))
+	if err != nil {
+		logger.Warn().Err(err).Msg("Missing map for " + area.Name)
+		return nil
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Unreadable map for " + area.Name)
+		return nil
+	}
+	return cropToStage(img, area)
+}
+
+func cropToStage(img image.Image, area Area) image.Image {
+	height, width := len(area.Tiles), len(area.Tiles[0])
+	bounds := img.Bounds()
+	if bounds.Dy() == height && bounds.Dx() == width {
+		return img
+	}
+	row, column, ok := gridPositionFromName(area.Name)
+	if !ok {
+		return nil
+	}
+	region := image.Rect(column*width, row*height, (column+1)*width, (row+1)*height).Add(bounds.Min)
+	if !region.In(bounds) {
+		return nil
+	}
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(region)
+	}
+	return nil
+}
+
+// Areas of a simply tiled space are named space:row-column
+func gridPositionFromName(name string) (int, int, bool) {
+	i := strings.LastIndex(name, ":")
+	if i == -1 {
+		return 0, 0, false
+	}
+	row, column, found := strings.Cut(name[i+1:], "-")
+	if !found {
+		return 0, 0, false
+	}
+	y, errY := strconv.Atoi(row)
+	x, errX := strconv.Atoi(column)
+	if errY != nil || errX != nil || y < 0 || x < 0 {
+		return 0, 0, false
+	}
+	return y, x, true
+}
+
+// The map is dimmed so that heat stands out, each tile is drawn as a HEATMAP_SCALE square
+func renderHeatmap(heatmap *Heatmap, base image.Image) *image.RGBA {
+	counts := make(map[[2]int]int, len(heatmap.Cells))
+	for _, cell := range heatmap.Cells {
+		counts[[2]int{cell.Y, cell.X}] = cell.Count
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, heatmap.Width*HEATMAP_SCALE, heatmap.Height*HEATMAP_SCALE))
+	for y := 0; y < heatmap.Height; y++ {
+		for x := 0; x < heatmap.Width; x++ {
+			tile := dim(baseColor(base, y, x))
+			if count := counts[[2]int{y, x}]; count > 0 && heatmap.Max > 0 {
+				intensity := math.Sqrt(float64(count) / float64(heatmap.Max)) // Keeps single events visible
+				tile = blend(tile, heatColor(intensity), 0.4+0.5*intensity)
+			}
+			for dy := 0; dy < HEATMAP_SCALE; dy++ {
+				for dx := 0; dx < HEATMAP_SCALE; dx++ {
+					out.SetRGBA(x*HEATMAP_SCALE+dx, y*HEATMAP_SCALE+dy, tile)
+				}
+			}
+		}
+	}
+	return out
+}
+
+func baseColor(base image.Image, y, x int) color.RGBA {
+	if base == nil {
+		return heatmapBackground
+	}
+	bounds := base.Bounds()
+	point := image.Pt(bounds.Min.X+x, bounds.Min.Y+y)
+	if !point.In(bounds) {
+		return heatmapBackground
+	}
+	return color.RGBAModel.Convert(base.At(point.X, point.Y)).(color.RGBA)
+}
+
+// Blue through yellow to red
+func heatColor(intensity float64) color.RGBA {
+	if intensity < 0.5 {
+		t := intensity * 2
+		return color.RGBA{R: uint8(255 * t), G: uint8(255 * t), B: uint8(255 * (1 - t)), A: 255}
+	}
+	t := (intensity - 0.5) * 2
+	return color.RGBA{R: 255, G: uint8(255 * (1 - t)), A: 255}
+}
+
+func dim(c color.RGBA) color.RGBA {
+	return color.RGBA{R: c.R / 2, G: c.G / 2, B: c.B / 2, A: 255}
+}
+
+func blend(under, over color.RGBA, alpha float64) color.RGBA {
+	mix := func(a, b uint8) uint8 {
+		return uint8(float64(a)*(1-alpha) + float64(b)*alpha)
+	}
+	return color.RGBA{R: mix(under.R, over.R), G: mix(under.G, over.G), B: mix(under.B, over.B), A: 255}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func addHeatmapTestingEvent(world *World, stage, eventType string, y, x int, created time.Time) {
+	world.db.(*FileStore).appendEvent(EventRecord{Owner: "tester", Type: eventType, StageName: stage, Y: y, X: x, Created: created})
+}
+
+func TestParseHeatmapRange(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	from, to, err := parseHeatmapRange("", "", now)
+	if err != nil || !to.Equal(now) || !from.Equal(now.Add(-HEATMAP_DEFAULT_RANGE)) {
+		t.Errorf("unexpected default range %v %v %v", from, to, err)
+	}
+	from, to, err = parseHeatmapRange("2024-06-01", "2024-06-02", now)
+	if err != nil || !from.Equal(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("dates should cover whole days, got %v %v %v", from, to, err)
+	}
+	from, _, err = parseHeatmapRange("72h", "", now)
+	if err != nil || !from.Equal(now.Add(-72*time.Hour)) {
+		t.Errorf("expected duration before now, got %v %v", from, err)
+	}
+	if _, _, err := parseHeatmapRange("2024-06-05", "2024-06-01", now); err == nil {
+		t.Error("expected an error when from is after to")
+	}
+	if _, _, err := parseHeatmapRange("yesterday", "", now); err == nil {
+		t.Error("expected an error for an invalid from")
+	}
+}
+
+func TestBuildHeatmapFiltersEvents(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	now := time.Now()
+	addHeatmapTestingEvent(world, "test-admin", EVENT_KILL, 1, 2, now)
+	addHeatmapTestingEvent(world, "test-admin", EVENT_KILL, 1, 2, now)
+	addHeatmapTestingEvent(world, "test-admin", EVENT_KILL, 0, 0, now)
+	addHeatmapTestingEvent(world, "test-admin", EVENT_KILL, 9, 9, now)                 // Out of bounds
+	addHeatmapTestingEvent(world, "test-admin", EVENT_KILL, 0, 1, now.Add(-time.Hour)) // Out of range
+	addHeatmapTestingEvent(world, "test-admin", EVENT_SCORE, 0, 1, now)
+	addHeatmapTestingEvent(world, "test-admin-other", EVENT_KILL, 0, 1, now)
+
+	area, _ := areaFromName("test-admin")
+	heatmap, err := buildHeatmap(context.Background(), world.db, area, EVENT_KILL, now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heatmap.Height != 2 || heatmap.Width != 4 || heatmap.Total != 3 || heatmap.Max != 2 || len(heatmap.Cells) != 2 {
+		t.Errorf("unexpected heatmap %+v", heatmap)
+	}
+}
+
+func TestAdminHeatmapRendersPng(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	addHeatmapTestingEvent(world, "test-admin", EVENT_SCORE, 1, 3, time.Now())
+
+	w := adminRequest(world, http.MethodGet, "/admin/heatmap?stage=test-admin&type=score", nil, false)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("expected a png, got %d %s", w.Code, w.Body.String())
+	}
+	img, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 4*HEATMAP_SCALE || bounds.Dy() != 2*HEATMAP_SCALE {
+		t.Errorf("unexpected size %v", bounds)
+	}
+	hot := color.RGBAModel.Convert(img.At(3*HEATMAP_SCALE, 1*HEATMAP_SCALE)).(color.RGBA)
+	cold := color.RGBAModel.Convert(img.At(0, 0)).(color.RGBA)
+	if hot.R <= cold.R {
+		t.Errorf("tile with events should be hotter: %v %v", hot, cold)
+	}
+
+	var heatmap Heatmap
+	json.NewDecoder(adminRequest(world, http.MethodGet, "/admin/heatmap?stage=test-admin&type=score&format=json", nil, false).Body).Decode(&heatmap)
+	if heatmap.Total != 1 || len(heatmap.Cells) != 1 || heatmap.Cells[0] != (HeatmapCell{Y: 1, X: 3, Count: 1}) {
+		t.Errorf("unexpected json heatmap %+v", heatmap)
+	}
+
+	if w := adminRequest(world, http.MethodGet, "/admin/heatmap?stage=missing", nil, false); w.Code != http.StatusNotFound {
+		t.Errorf("expected unknown stage to be not found, got %d", w.Code)
+	}
+	if w := adminRequest(world, http.MethodGet, "/admin/heatmap?stage=test-admin&type=deaths", nil, false); w.Code != http.StatusBadRequest {
+		t.Errorf("expected unknown type to be rejected, got %d", w.Code)
+	}
+}
+
+func TestCropToStageUsesGridPosition(t *testing.T) {
+	row := []Material{{}, {}}
+	area := Area{Name: "space:1-2", Tiles: [][]Material{row, row}}
+	space := image.NewRGBA(image.Rect(0, 0, 6, 4)) // Three across, two down
+	marker := color.RGBA{R: 200, A: 255}
+	space.SetRGBA(4, 2, marker)
+
+	stage := cropToStage(space, area)
+	if stage == nil {
+		t.Fatal("expected a region of the space")
+	}
+	if got := baseColor(stage, 0, 0); got != marker {
+		t.Errorf("expected the stage origin to be the marker, got %v", got)
+	}
+	if cropToStage(space, Area{Name: "space:5-5", Tiles: area.Tiles}) != nil {
+		t.Error("a position outside of the space should have no map")
+	}
+	if cropToStage(space, Area{Name: "unnamed", Tiles: area.Tiles}) != nil {
+		t.Error("an unknown position should have no map")
+	}
+}
@@ -129,6 +129,13 @@ func processStringForColors(input string) string {
 	return input
 }
 
+// As processStringForColors without the markup, for clients which color text themselves
+func stripColors(input string) string {
+	input = wordRegex.ReplaceAllString(input, `$1`)
+	input = phraseColorRegex.ReplaceAllString(input, `$1`)
+	return input
+}
+
 func divBottomInvalid(s string) string {
 	return `
 	<div id="bottom_text" hx-swap-oob="true">
@@ -146,11 +153,14 @@ func playerBoxSpecifc(y, x int, icon string) string {
 }
 
 func characterBox(tile *Tile) string {
-	characterIndicator := ""
+	return playerBoxSpecifc(tile.y, tile.x, characterIcon(tile))
+}
+
+func characterIcon(tile *Tile) string {
 	if ch := tile.getACharacter(); ch != nil {
-		characterIndicator = ch.getIconSync()
+		return ch.getIconSync()
 	}
-	return playerBoxSpecifc(tile.y, tile.x, characterIndicator)
+	return ""
 }
 
 func interactableBoxSpecific(y, x int, interactable *Interactable) string {
@@ -162,13 +172,16 @@ func interactableBoxSpecific(y, x int, interactable *Interactable) string {
 }
 
 func interactableBox(tile *Tile) string {
+	return fmt.Sprintf(`[~ id="Li1" y="%d" x="%d" class="box zi %s"]`, tile.y, tile.x, interactableClass(tile))
+}
+
+func interactableClass(tile *Tile) string {
 	tile.interactableMutex.Lock()
 	defer tile.interactableMutex.Unlock()
-	indicator := ""
 	if tile.interactable != nil {
-		indicator = tile.interactable.cssClass
+		return tile.interactable.cssClass
 	}
-	return fmt.Sprintf(`[~ id="Li1" y="%d" x="%d" class="box zi %s"]`, tile.y, tile.x, indicator)
+	return ""
 }
 
 func emptyWeatherBox(y, x int, weather string) string {
@@ -223,12 +236,15 @@ func weatherBox(tile *Tile, cssClass string) string {
 }
 
 func svgFromTile(tile *Tile) string {
+	template := `[~ id="Ls1" y="%d" x="%d" class="%s"]`
+	return fmt.Sprintf(template, tile.y, tile.x, "box zs "+itemClasses(tile))
+}
+
+func itemClasses(tile *Tile) string {
 	tile.itemMutex.Lock()
 	defer tile.itemMutex.Unlock()
 
-	template := `[~ id="Ls1" y="%d" x="%d" class="%s"]`
-
-	classes := "box zs "
+	classes := ""
 	if tile.powerUp != nil {
 		classes += "svgRed "
 	}
@@ -238,8 +254,7 @@ func svgFromTile(tile *Tile) string {
 	if tile.boosts != 0 {
 		classes += "svgBlue "
 	}
-
-	return fmt.Sprintf(template, tile.y, tile.x, classes)
+	return classes
 }
 
 ///////////////////////////////////////////
@@ -290,15 +305,15 @@ func divInputDisabled() string {
 `
 }
 
-func divLogOutResume(text, domain string) []byte {
+func divLogOutResume(player *Player, text string) []byte {
 	var buf bytes.Buffer
 	data := struct {
 		Text   string
 		Domain string
 	}{
 		Text:   text,
-		Domain: domain,
+		Domain: player.world.config.domainName,
 	}
 	tmpl.ExecuteTemplate(&buf, "log-out", data)
-	return buf.Bytes()
+	return player.render(buf.String(), MessageEvent{Type: "logout", Text: text})
 }
@@ -20,11 +20,15 @@ const STATUS_CHECK_INTERVAL_IN_SECONDS = 5
 // World Select and Status
 
 type WorldSelectBanner struct {
-	ServerName   string
-	DomainName   string
-	FuchsiaCount int
-	SkyBlueCount int
-	Vacancy      bool
+	ServerName string
+	DomainName string
+	Teams      []TeamCount
+	Vacancy    bool
+}
+
+type TeamCount struct {
+	Team
+	Count int
 }
 
 func createWorldSelectHandler(config *Configuration) func(w http.ResponseWriter, r *http.Request) {
@@ -69,16 +73,17 @@ func (world *World) getStatus(w http.ResponseWriter, r *http.Request) {
 	if isOverNSecondsAgo(world.teamPlayerStatus.lastStatusCheck, STATUS_CHECK_INTERVAL_IN_SECONDS) {
 		world.wPlayerMutex.Lock()
 		defer world.wPlayerMutex.Unlock()
-		world.teamPlayerStatus.fuchsiaPlayerCount = world.teamQuantities["fuchsia"]
-		world.teamPlayerStatus.skyBluePlayerCount = world.teamQuantities["sky-blue"]
+		world.teamPlayerStatus.playerCounts = make(map[string]int, len(world.teamQuantities))
+		for team, count := range world.teamQuantities {
+			world.teamPlayerStatus.playerCounts[team] = count
+		}
 		world.teamPlayerStatus.lastStatusCheck = time.Now()
 	}
 	statusDiv := WorldSelectBanner{
-		ServerName:   world.config.serverName,
-		DomainName:   world.config.domainName,
-		FuchsiaCount: world.teamPlayerStatus.fuchsiaPlayerCount,
-		SkyBlueCount: world.teamPlayerStatus.skyBluePlayerCount,
-		Vacancy:      vacancyOfLockedWorldStatus(&world.teamPlayerStatus),
+		ServerName: world.config.serverName,
+		DomainName: world.config.domainName,
+		Teams:      teamCountsOfLockedWorldStatus(&world.teamPlayerStatus),
+		Vacancy:    vacancyOfLockedWorldStatus(&world.teamPlayerStatus),
 	}
 	tmpl.ExecuteTemplate(w, "world-status", statusDiv)
 }
@@ -88,7 +93,20 @@ func idBelongsToGuest(id string) bool {
 }
 
 func vacancyOfLockedWorldStatus(status *TeamPlayerStatus) bool {
-	return status.fuchsiaPlayerCount < CAPACITY_PER_TEAM || status.skyBluePlayerCount < CAPACITY_PER_TEAM
+	for _, team := range teams.names() {
+		if status.playerCounts[team] < capacityOfTeam(team) {
+			return true
+		}
+	}
+	return false
+}
+
+func teamCountsOfLockedWorldStatus(status *TeamPlayerStatus) []TeamCount {
+	out := make([]TeamCount, 0)
+	for _, team := range teams.list() {
+		out = append(out, TeamCount{Team: team, Count: status.playerCounts[team.Name]})
+	}
+	return out
 }
 
 var unavailableMessage = `Server unavailable :( <a href="#" hx-get="/worlds" hx-target="#page"> Try again</a>`
@@ -117,6 +135,9 @@ func (world *World) playHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if r.Method == http.MethodPost {
+		if rejectWhileShuttingDown(world, w) {
+			return
+		}
 		world.postPlay(w, r)
 		return
 	}
@@ -146,9 +167,11 @@ func (world *World) postPlay(w http.ResponseWriter, r *http.Request) {
 		colorPage := struct {
 			DomainName        string
 			SuggestedUsername string
+			Teams             []Team
 		}{
 			DomainName:        world.config.domainName,
-			SuggestedUsername: world.db.UniqueName(),
+			SuggestedUsername: uniqueName(world.db),
+			Teams:             teams.list(),
 		}
 		tmpl.ExecuteTemplate(w, "choose-your-color", colorPage)
 	}
@@ -199,17 +222,21 @@ func (world *World) postPlayAsGuest(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, "Unable to sign in")
 		return
 	}
+	if record.LinkingTo != "" {
+		io.WriteString(w, "Progress is being kept, sign in instead")
+		return
+	}
 	receipt := world.initiateLogin(record)
 	tmpl.ExecuteTemplate(w, "player-page", receipt)
 }
 
-func (db *DB) postNew(w http.ResponseWriter, r *http.Request) {
+func (app *App) postNew(w http.ResponseWriter, r *http.Request) {
 	id, ok := getUserIdFromSession(r)
 	if !ok {
 		tmpl.ExecuteTemplate(w, "homepage", false)
 		return
 	}
-	userRecord := db.getAuthorizedUserById(id)
+	userRecord := app.db.getAuthorizedUserById(id)
 	if userRecord == nil {
 		// deeply confusing
 		// Could imply hacked cookie?
@@ -250,18 +277,18 @@ func (db *DB) postNew(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// not atomic
-	if db.foundUsername(username) {
+	if app.db.foundUsername(username) {
 		io.WriteString(w, divBottomInvalid("Username unavailable. Try again."))
 		return
 	}
 
 	record := createNewPlayerRecord(username, team)
-	err = db.InsertPlayerRecord(record)
+	err = app.db.InsertPlayerRecord(record)
 	if err != nil {
 		io.WriteString(w, divBottomInvalid("Error saving new player"))
 		return
 	}
-	ok = db.updateUsernameForUserWithId(id, username)
+	ok = app.db.updateUsernameForUserWithId(id, username)
 	if !ok {
 		io.WriteString(w, divBottomInvalid("Error, username not updated"))
 		return
@@ -301,16 +328,6 @@ func validUsername(username string) bool {
 	return true
 }
 
-func validTeam(team string) bool {
-	validTeams := []string{"fuchsia", "sky-blue"}
-	for i := range validTeams {
-		if validTeams[i] == team {
-			return true
-		}
-	}
-	return false
-}
-
 /////////////////////////////////////////////
 // Stats
 
@@ -321,6 +338,12 @@ func (world *World) getStats(w http.ResponseWriter, r *http.Request) {
 	for key, val := range world.teamQuantities {
 		out += fmt.Sprintf("%s: %d\n", key, val)
 	}
+	out += world.bandwidth.summary()
+	for _, player := range world.worldPlayers {
+		if player.camera != nil && (player.camera.drops() > 0 || player.camera.resyncs() > 0) {
+			out += fmt.Sprintf("%s - drops: %d resyncs: %d\n", player.username, player.camera.drops(), player.camera.resyncs())
+		}
+	}
 	io.WriteString(w, out)
 }
 
@@ -337,7 +360,7 @@ func auth(w http.ResponseWriter, r *http.Request) {
 	gothic.BeginAuthHandler(w, r)
 }
 
-func (db *DB) callback(w http.ResponseWriter, r *http.Request) {
+func (app *App) callback(w http.ResponseWriter, r *http.Request) {
 	user, err := gothic.CompleteUserAuth(w, r)
 	if err != nil {
 		logger.Error().Err(err).Msg("Callback error: ")
@@ -351,11 +374,11 @@ func (db *DB) callback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	identifier := user.Provider + ":" + user.UserID
-	userRecord := db.getAuthorizedUserById(identifier)
+	userRecord := app.db.getAuthorizedUserById(identifier)
 	if userRecord == nil {
 		logger.Info().Msg("Creating new user with identifier: " + identifier)
 		newUser := UserRecord{Identifier: identifier, Username: "", CreationEmail: user.Email, Created: time.Now(), LastLogin: time.Now()}
-		err := db.insertAuthorizedUser(newUser)
+		err := app.db.insertAuthorizedUser(newUser)
 		if err != nil {
 			logger.Warn().Msg("New User creation in mongo failed")
 			http.Redirect(w, r, "/", http.StatusFound)
@@ -367,6 +390,9 @@ func (db *DB) callback(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		logger.Warn().Msg("Error getting new session?")
 	}
+	if previous, ok := session.Values["identifier"].(string); ok && idBelongsToGuest(previous) {
+		session.Values[SESSION_GUEST_KEY] = previous // Offered to be merged from the home page
+	}
 	session.Values["identifier"] = identifier
 	err = session.Save(r, w)
 	if err != nil {
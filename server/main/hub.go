@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -18,6 +19,11 @@ const HIGHSCORE_CHECK_INTERVAL_IN_SECONDS = 15
 type Hub struct {
 	richest, deadliest, mvp *HighScoreListSync
 	db                      RankingProvider
+	seasons                 SeasonCalendar
+	periodsLock             sync.Mutex
+	periods                 map[string]*HighScoreListSync // By category, period and season
+	archiveLock             sync.Mutex
+	archived                map[int]*SeasonStandingsRecord
 }
 
 type HighScoreListSync struct {
@@ -29,7 +35,10 @@ type HighScoreListSync struct {
 type HighScoreList struct {
 	BorderColor string // unused
 	Category    string
+	Period      string // Empty for all-time
+	Season      int    // Of PERIOD_SEASON
 	Entries     []HighScoreEntry
+	Teams       []HighScoreEntry // Period lists only
 }
 
 type HighScoreEntry struct {
@@ -40,6 +49,10 @@ type HighScoreEntry struct {
 
 type RankingProvider interface {
 	getTopNPlayersByField(field string, n int) ([]PlayerRecord, error)
+	// Counts events and daily rollups by RANK_BY_OWNER or RANK_BY_TEAM, from and to are whole UTC days
+	rankEventsBy(ctx context.Context, eventType, groupBy string, from, to time.Time, n int) ([]RankedCount, error)
+	getSeasonStandings(ctx context.Context, season int) (*SeasonStandingsRecord, error) // Nil until archived
+	saveSeasonStandings(ctx context.Context, record SeasonStandingsRecord) error
 }
 
 // Used w/ Template methods to cycle through on site
@@ -51,7 +64,10 @@ var queryCategories = []string{
 
 func createDefaultHub(db RankingProvider) *Hub {
 	return &Hub{
-		db: db,
+		db:       db,
+		seasons:  createSeasonCalendar(DEFAULT_SEASON_LENGTH),
+		periods:  make(map[string]*HighScoreListSync),
+		archived: make(map[int]*SeasonStandingsRecord),
 		richest: &HighScoreListSync{
 			HighScoreList: HighScoreList{
 				Category:    "Richest",
@@ -80,8 +96,11 @@ func (app *App) homeHandler(w http.ResponseWriter, r *http.Request) {
 	logger.Info().Msg("Home page accessed.") // Replace with metric
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
-	_, identifierFound := getUserIdFromSession(r)
+	id, identifierFound := getUserIdFromSession(r)
 	if identifierFound {
+		if guest, ok := getGuestToLinkFromSession(r); ok && !idBelongsToGuest(id) && app.linkGuestPage(w, id, guest) {
+			return
+		}
 		tmpl.ExecuteTemplate(w, "homepage-signed-in", nil)
 		return
 	}
@@ -100,15 +119,25 @@ func (hub *Hub) highscoreHandler(w http.ResponseWriter, r *http.Request) {
 
 	queryValues := r.URL.Query()
 	category := strings.ToLower(queryValues.Get("category"))
+	period := periodFromQuery(queryValues.Get("period"))
+	season, _ := strconv.Atoi(queryValues.Get("season"))
 
 	var scores HighScoreList
 	switch category {
 	case "richest":
 		scores = generateRichestList(hub)
 	case "deadliest":
-		scores = generateDeadliestList(hub)
+		if period == PERIOD_ALL_TIME {
+			scores = generateDeadliestList(hub)
+		} else {
+			scores = generatePeriodList(hub, "Deadliest", period, season, time.Now())
+		}
 	case "mvp":
-		scores = generateMVPList(hub)
+		if period == PERIOD_ALL_TIME {
+			scores = generateMVPList(hub)
+		} else {
+			scores = generatePeriodList(hub, "MVP", period, season, time.Now())
+		}
 	default:
 		break
 	}
@@ -214,3 +243,57 @@ func (hs HighScoreList) PrevCategory() string {
 	}
 	return "prev-invalid"
 }
+
+// Periods are kept when changing category, categories without periods show all-time
+func (hs HighScoreList) HasPeriods() bool {
+	_, ok := periodEventTypes[hs.Category]
+	return ok
+}
+
+func (hs HighScoreList) CurrentPeriod() string {
+	if hs.Period == "" {
+		return PERIOD_ALL_TIME
+	}
+	return hs.Period
+}
+
+func (hs HighScoreList) PeriodTitle() string {
+	if hs.Period == PERIOD_SEASON {
+		return fmt.Sprintf("Season %d", hs.Season)
+	}
+	return hs.CurrentPeriod()
+}
+
+// All-time Deadliest is ranked by streak, the periods by kills
+func (hs HighScoreList) RankedBy() string {
+	if hs.CurrentPeriod() == PERIOD_ALL_TIME {
+		return allTimeStatNames[hs.Category]
+	}
+	return periodStatNames[hs.Category]
+}
+
+func (hs HighScoreList) NextPeriod() string {
+	for i := range queryPeriods {
+		if hs.CurrentPeriod() == queryPeriods[i] {
+			return queryPeriods[mod(i+1, len(queryPeriods))]
+		}
+	}
+	return "next-invalid"
+}
+
+func (hs HighScoreList) PrevPeriod() string {
+	for i := range queryPeriods {
+		if hs.CurrentPeriod() == queryPeriods[i] {
+			return queryPeriods[mod(i-1, len(queryPeriods))]
+		}
+	}
+	return "prev-invalid"
+}
+
+// Zero when there is no earlier season
+func (hs HighScoreList) PrevSeason() int {
+	if hs.Period != PERIOD_SEASON || hs.Season <= 1 {
+		return 0
+	}
+	return hs.Season - 1
+}
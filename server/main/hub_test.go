@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"testing"
 	"time"
 )
@@ -15,6 +16,18 @@ func (m *MockRankProvider) getTopNPlayersByField(field string, n int) ([]PlayerR
 	return m.players[field], nil
 }
 
+func (m *MockRankProvider) rankEventsBy(ctx context.Context, eventType, groupBy string, from, to time.Time, n int) ([]RankedCount, error) {
+	return nil, nil
+}
+
+func (m *MockRankProvider) getSeasonStandings(ctx context.Context, season int) (*SeasonStandingsRecord, error) {
+	return nil, nil
+}
+
+func (m *MockRankProvider) saveSeasonStandings(ctx context.Context, record SeasonStandingsRecord) error {
+	return nil
+}
+
 func TestGenerateRichestList(t *testing.T) {
 	mock := &MockRankProvider{
 		topNCalls: make(map[string]int),
@@ -6,6 +6,9 @@ import (
 	"strings"
 )
 
+// Map images generated by tools, named by area mapId
+const IMAGE_DIR = "./data/images/"
+
 func imageHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
 		getImage(w, r)
@@ -25,8 +28,9 @@ func getImage(w http.ResponseWriter, r *http.Request) {
 
 // DDOS risk?
 func serveImage(w http.ResponseWriter, r *http.Request, fileName string) {
-	dir := "./data/images/"
-	fileName += ".png"
-	filePath := filepath.Join(dir, fileName)
-	http.ServeFile(w, r, filePath)
+	http.ServeFile(w, r, imagePath(fileName))
+}
+
+func imagePath(id string) string {
+	return filepath.Join(IMAGE_DIR, id+".png")
 }
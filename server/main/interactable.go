@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"math/rand"
+	"strings"
 	"time"
 )
 
@@ -14,6 +15,7 @@ type Interactable struct {
 	fragile        bool
 	reactions      []InteractableReaction // Lowest index match wins
 	rejectTeleport bool
+	reactionsName  string // Key of reactions, retained for snapshots
 }
 
 type InteractableReaction struct {
@@ -27,20 +29,10 @@ func init() {
 	interactableReactions = map[string][]InteractableReaction{
 		// Capture the flag :
 		"black-hole": {
-			{ReactsWith: interactableHasName("ball-fuchsia"), Reaction: hideByTeam("fuchsia")},
-			{ReactsWith: interactableHasName("ball-sky-blue"), Reaction: hideByTeam("sky-blue")},
+			{ReactsWith: interactableIsATeamBall, Reaction: hideTeamBall},
 			{ReactsWith: everything, Reaction: eat},
 		},
-		"goal-sky-blue": {
-			{ReactsWith: playerTeamAndBallNameMatch("sky-blue"), Reaction: scoreGoalForTeam("sky-blue")},
-			{ReactsWith: PlayerAndTeamMatchButDifferentBall("sky-blue"), Reaction: pass},
-			{ReactsWith: interactableIsNil, Reaction: showScoreToPlayer("sky-blue")},
-		},
-		"goal-fuchsia": {
-			{ReactsWith: playerTeamAndBallNameMatch("fuchsia"), Reaction: scoreGoalForTeam("fuchsia")},
-			{ReactsWith: PlayerAndTeamMatchButDifferentBall("fuchsia"), Reaction: pass},
-			{ReactsWith: interactableIsNil, Reaction: showScoreToPlayer("fuchsia")},
-		},
+		// goal-<team> : see addTeamReactions
 
 		////////////////////////////////////////////////////////////////
 		// Tutorial :
@@ -48,14 +40,7 @@ func init() {
 			{ReactsWith: interactableIsABall, Reaction: tutorial2HideAndNotify},
 			{ReactsWith: everything, Reaction: eat},
 		},
-		"tutorial-goal-sky-blue": {
-			{ReactsWith: playerTeamAndBallNameMatch("sky-blue"), Reaction: finishTutorial},
-			{ReactsWith: PlayerAndTeamMatchButDifferentBall("sky-blue"), Reaction: notifyAndPass("Try using the matching ball.")},
-		},
-		"tutorial-goal-fuchsia": {
-			{ReactsWith: playerTeamAndBallNameMatch("fuchsia"), Reaction: finishTutorial},
-			{ReactsWith: PlayerAndTeamMatchButDifferentBall("fuchsia"), Reaction: notifyAndPass("Try using the matching ball.")},
-		},
+		// tutorial-goal-<team> : see addTeamReactions
 		"gold-target": {
 			{ReactsWith: interactableHasName("ball-gold"), Reaction: destroyInRangeSkipingSelf(5, 3, 10, 8)},
 		},
@@ -68,6 +53,9 @@ func init() {
 		"teleport-home": {
 			{ReactsWith: interactableIsNil, Reaction: teleportHomeInteraction},
 		},
+		"shop": {
+			{ReactsWith: interactableIsNil, Reaction: openShopInteraction},
+		},
 
 		////////////////////////////////////////////////////////////////
 		// machines :
@@ -128,6 +116,21 @@ func init() {
 		"airlock-open":  {{ReactsWith: interactableIsNil, Reaction: openAirlockDoors}},
 	}
 
+	for _, team := range teams.names() {
+		addTeamReactions(team)
+	}
+}
+
+func addTeamReactions(team string) {
+	interactableReactions["goal-"+team] = []InteractableReaction{
+		{ReactsWith: playerTeamAndBallNameMatch(team), Reaction: scoreGoalForTeam(team)},
+		{ReactsWith: PlayerAndTeamMatchButDifferentBall(team), Reaction: pass},
+		{ReactsWith: interactableIsNil, Reaction: showScoreToPlayer(team)},
+	}
+	interactableReactions["tutorial-goal-"+team] = []InteractableReaction{
+		{ReactsWith: playerTeamAndBallNameMatch(team), Reaction: finishTutorial},
+		{ReactsWith: PlayerAndTeamMatchButDifferentBall(team), Reaction: notifyAndPass("Try using the matching ball.")},
+	}
 }
 
 func (source *Interactable) React(incoming *Interactable, initiator *Player, location *Tile, yOff, xOff int) bool {
@@ -218,14 +221,17 @@ func interactableIsARing(i *Interactable, _ *Player) bool {
 	return i.name[0:5] == "ring-"
 }
 
-func oppositeTeamName(team string) string {
-	if team == "sky-blue" {
-		return "fuchsia"
-	}
-	if team == "fuchsia" {
-		return "sky-blue"
+func interactableIsATeamBall(i *Interactable, _ *Player) bool {
+	return interactableIsABall(i, nil) && validTeam(strings.TrimPrefix(i.name, "ball-"))
+}
+
+func playerIsNotOnTeam(team string) func(*Interactable, *Player) bool {
+	return func(_ *Interactable, p *Player) bool {
+		if p == nil {
+			return false
+		}
+		return p.getTeamNameSync() != team
 	}
-	return ""
 }
 
 func PlayerAndTeamMatchButDifferentBall(team string) func(*Interactable, *Player) bool {
@@ -270,7 +276,7 @@ func spawnMoney(amounts []int) func(*Interactable, *Player, *Tile) (*Interactabl
 			return nil, false
 		}
 		for i := range amounts {
-			randn := rand.Intn(count)
+			randn := t.stage.intn(count)
 			tiles[randn].addMoneyAndNotifyAll(amounts[i])
 		}
 		return nil, false
@@ -281,8 +287,7 @@ func finishTutorial(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
 	destroyEveryOtherInteractable(i, p, t)
 	p.goalsScored.CompareAndSwap(0, 1)
 	p.updateBottomText("You scored a goal! View stats in menu... ")
-	go func() {
-		time.Sleep(time.Millisecond * time.Duration(1600))
+	scheduleAfter(t.stage, 1600*time.Millisecond, func(*UpdateBatch) {
 		ownLock := p.tangibilityLock.TryLock()
 		if !ownLock {
 			return
@@ -292,7 +297,7 @@ func finishTutorial(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
 			return
 		}
 		openStatsMenu(p)
-	}()
+	})
 	return nil, false
 }
 
@@ -326,8 +331,6 @@ func destroyInRangeSkipingSelf(yMin, xMin, yMax, xMax int) func(*Interactable, *
 }
 
 // Capture the flag
-var SCORE_TO_WIN = 100
-
 func scoreGoalForTeam(team string) func(*Interactable, *Player, *Tile) (outgoing *Interactable, ok bool) {
 	return func(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
 		if team != p.getTeamNameSync() {
@@ -335,54 +338,32 @@ func scoreGoalForTeam(team string) func(*Interactable, *Player, *Tile) (outgoing
 			return nil, false
 		}
 
-		// Scoreboard
-		score := p.world.leaderBoard.scoreboard.Increment(team)
-		oppositeTeamName := oppositeTeamName(team)
-		scoreOpposing := p.world.leaderBoard.scoreboard.GetScore(oppositeTeamName)
-
 		// Award hat
 		p.incrementGoalsScored()
 		p.setHatByName("score-a-goal")
 		p.addAccomplishmentByName(scoreAGoal)
 
+		// Scoreboard and World Updates
+		broadcastUpdate(p.world, soundTriggerByName("huge-explosion"))
+		score := p.world.getGameModeSync().onGoal(p, team)
+
 		// Database
 		p.updateRecord()
 		p.world.db.saveScoreEvent(p.getTileSync(), p, fmt.Sprintf("Notes - Team: %s, Score %d", team, score))
 
-		// World Updates
-		broadcastUpdate(p.world, soundTriggerByName("huge-explosion"))
-		if score < SCORE_TO_WIN {
-			message := fmt.Sprintf("@[%s|%s] scored a goal!<br /> The score is: @[%s %d|%s] to @[%s %d|%s]", p.username, team, team, score, team, oppositeTeamName, scoreOpposing, oppositeTeamName)
-			broadcastBottomText(p.world, message)
-		} else {
-			// Awards
-			awardHatByTeam(p.world, team, "winning-team")
-			p.addAccomplishmentByName(winningAGame)
-
-			// Games won stat?
-
-			// Reset and notify
-			p.world.leaderBoard.scoreboard.ResetAll()
-			message := fmt.Sprintf("@[%s|%s] won the game for @[%s|%s]!", p.username, team, team, team)
-			broadcastBottomText(p.world, message)
-		}
-
-		saveCurrentStatus(p.world)
-
 		return hideByTeam(team)(i, p, t)
 	}
 }
 
+func hideTeamBall(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
+	return hideByTeam(strings.TrimPrefix(i.name, "ball-"))(i, p, t)
+}
+
 func hideByTeam(team string) func(*Interactable, *Player, *Tile) (*Interactable, bool) {
 	return func(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
-		lat := rand.Intn(8)
-		long := rand.Intn(8)
-		stagename := "arcade:0-2"
-		if team == "sky-blue" {
-			stagename = fmt.Sprintf("team-fuchsia:%d-%d", lat, long)
-		}
-		if team == "fuchsia" {
-			stagename = fmt.Sprintf("team-blue:%d-%d", lat, long)
+		stagename, ok := hidingStageForBallOf(team, t.stage.intn)
+		if !ok {
+			stagename = "arcade:0-2"
 		}
 		logger.Info().Msg("Ball is hidden on: " + stagename)
 		stage := p.fetchStageSync(stagename)
@@ -394,19 +375,16 @@ func hideByTeam(team string) func(*Interactable, *Player, *Tile) (*Interactable,
 
 func showScoreToPlayer(team string) func(*Interactable, *Player, *Tile) (outgoing *Interactable, ok bool) {
 	return func(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
-		// Get scores
-		score := p.world.leaderBoard.scoreboard.GetScore(team)
-		oppositeTeamName := oppositeTeamName(team)
-		scoreOpposing := p.world.leaderBoard.scoreboard.GetScore(oppositeTeamName)
+		mode := p.world.getGameModeSync()
 
 		// Add a sound?
 		//broadcastUpdate(p.world, soundTriggerByName("info?"))
 
-		message := fmt.Sprintf("The score is - @[%s %d|%s] to @[%s %d|%s]. ", team, score, team, oppositeTeamName, scoreOpposing, oppositeTeamName)
+		message := mode.scoreMessage(team)
 
 		playerTeam := p.getTeamNameSync()
 		rand := rand.Intn(2) // Displaying both messages is too much - especially on mobile
-		if team == playerTeam && rand > 0 {
+		if team == playerTeam && rand > 0 && mode.getName() == "ctf" {
 			message = fmt.Sprintf("...Find the @[Ball|%s] to score a point!", playerTeam)
 		}
 
@@ -430,7 +408,7 @@ func placeInteractableOnStagePriorityCovered(stage *Stage, interactable *Interac
 			tiles = append([]*Tile(nil), uncovered...)
 			tiles = append(tiles, covered...)
 		}
-		index := rand.Intn(len(tiles))
+		index := stage.intn(len(tiles))
 		if trySetInteractable(tiles[index], interactable) {
 			return
 		}
@@ -442,7 +420,7 @@ func tryPlaceInteractableOnStage(stage *Stage, interactable *Interactable) {
 	tiles, uncovered := sortWalkableTiles(stage.tiles)
 	tiles = append(tiles, uncovered...)
 	for i := 0; i < len(tiles); i++ {
-		index := rand.Intn(len(tiles))
+		index := stage.intn(len(tiles))
 		if trySetInteractable(tiles[index], interactable) {
 			return
 		}
@@ -492,7 +470,7 @@ func makeDangerousForOtherTeam(i *Interactable, p *Player, t *Tile) (*Interactab
 	}
 	newReactions := []InteractableReaction{
 		{
-			ReactsWith: playerHasTeam(oppositeTeamName(initiatorTeam)),
+			ReactsWith: playerIsNotOnTeam(initiatorTeam),
 			Reaction:   damageWithinRadiusAndReset(2, dmg, p.id),
 		},
 		{ReactsWith: interactableIsNil, Reaction: playSoundForAll("water-splash")},
@@ -515,8 +493,8 @@ func damageAndSpawn(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
 	}
 
 	// Find Epicenter
-	y := rand.Intn(len(t.stage.tiles))
-	x := rand.Intn(len(t.stage.tiles[y]))
+	y := t.stage.intn(len(t.stage.tiles))
+	x := t.stage.intn(len(t.stage.tiles[y]))
 	epicenter := t.stage.tiles[y][x]
 
 	// Damage
@@ -530,7 +508,7 @@ func damageAndSpawn(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
 
 	// Add power
 	for i := 0; i < powerToSpawn; i++ {
-		if rand.Intn(10) == 0 {
+		if t.stage.intn(10) == 0 {
 			spawnPowerupGreat(t.stage)
 			continue
 		}
@@ -540,8 +518,8 @@ func damageAndSpawn(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
 }
 
 func tutorialExchange(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
-	y := rand.Intn(len(t.stage.tiles))
-	x := rand.Intn(len(t.stage.tiles[y]))
+	y := t.stage.intn(len(t.stage.tiles))
+	x := t.stage.intn(len(t.stage.tiles[y]))
 	epicenter := t.stage.tiles[y][x]
 	dmg := 50
 	powerToSpawn := 2
@@ -568,20 +546,15 @@ func teleportHomeInteraction(i *Interactable, p *Player, t *Tile) (*Interactable
 }
 
 func makeHomeTeleport(p *Player) *Teleport {
-	team := p.getTeamNameSync()
-	stage := ""
-	switch team {
-	case "fuchsia":
-		stage = "team-fuchsia:4-3"
-	case "sky-blue":
-		stage = "team-blue:3-4"
-	default:
+	team, ok := teams.get(p.getTeamNameSync())
+	if !ok || team.Spawn.Stage == "" {
 		return nil
 	}
+	y, x := team.Spawn.coords()
 	return &Teleport{
-		destStage:          stage,
-		destY:              7,
-		destX:              7,
+		destStage:          team.Spawn.Stage,
+		destY:              y,
+		destX:              x,
 		confirmation:       true,
 		rejectInteractable: true,
 	}
@@ -589,12 +562,12 @@ func makeHomeTeleport(p *Player) *Teleport {
 
 func addMoneyToStage(stage *Stage, amount int) {
 	walkableTiles := walkableTiles(stage.tiles)
-	n := rand.Intn(len(walkableTiles))
+	n := stage.intn(len(walkableTiles))
 	walkableTiles[n].addMoneyAndNotifyAll(amount)
 }
 
-func createRing() *Interactable {
-	n := rand.Intn(10)
+func createRing(stage *Stage) *Interactable {
+	n := stage.intn(10)
 	if n == 0 {
 		bigring := Interactable{
 			name:     "ring-big",
@@ -617,7 +590,7 @@ func createRing() *Interactable {
 func damageWithinRadiusAndReset(radius, dmg int, ownerId string) func(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
 	return func(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
 		go damageWithinRadius(t, p.world, radius, dmg, ownerId) // damage can take interactable lock that is held by reacting tile
-		tryPlaceInteractableOnStage(t.stage, createRing())
+		tryPlaceInteractableOnStage(t.stage, createRing(t.stage))
 		t.interactable.cssClass = "white trsp20 r0"
 		t.interactable.reactions = interactableReactions["lily-pad"]
 		t.updateAll(interactableBoxSpecific(t.y, t.x, t.interactable) + soundTriggerByName("explosion"))
@@ -630,7 +603,7 @@ func damageWithinRadius(tile *Tile, world *World, radius, dmg int, ownerId strin
 	tiles := getTilesInRadius(tile, radius)
 	trapSetter := world.getPlayerById(ownerId)
 	if trapSetter != nil {
-		damageAndIndicate(tiles, trapSetter, dmg)
+		damageAndIndicate(tiles, trapSetter, dmg, nil)
 	}
 }
 
@@ -688,13 +661,13 @@ func notifyAndPass(notification string) func(*Interactable, *Player, *Tile) (*In
 
 func tutorial2HideAndNotify(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
 	stagenames := []string{"tutorial2:0-1", "tutorial2:0-2", "tutorial2:1-2", "tutorial2:2-0", "tutorial2:2-1"}
-	index := rand.Intn(5)
+	index := t.stage.intn(5)
 	stagename := stagenames[index]
 	stage := p.fetchStageSync(stagename)
 	tiles := walkableTiles(stage.tiles)
 	placed := false
 	for !placed {
-		index = rand.Intn(len(tiles))
+		index = stage.intn(len(tiles))
 		placed = trySetInteractable(tiles[index], i)
 	}
 	p.updateBottomText("black holes will absorb balls and spit them out elsewhere")
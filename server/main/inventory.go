@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+	"sync"
+)
+
+// Persisted with the player record
+type InventoryRecord struct {
+	Hats      []string       `bson:"hats,omitempty"`      // Owned, keys of HAT_NAME_TO_TRIM
+	ActiveHat string         `bson:"activeHat,omitempty"` // Chosen in the wardrobe, worn after death and on login
+	Items     map[string]int `bson:"items,omitempty"`     // Consumables and keys by name
+}
+
+// The zero value is an empty inventory
+type Inventory struct {
+	sync.Mutex
+	hats      map[string]struct{}
+	activeHat string
+	items     map[string]int
+}
+
+// Hats earned before the wardrobe existed are unlocked from accomplishments
+func (inventory *Inventory) load(record PlayerRecord) {
+	inventory.Lock()
+	defer inventory.Unlock()
+	inventory.hats = make(map[string]struct{})
+	inventory.activeHat = record.Inventory.ActiveHat
+	inventory.items = make(map[string]int)
+	for _, hat := range record.Inventory.Hats {
+		if !STATUS_HATS[hat] { // Saved before status hats were left out
+			inventory.hats[hat] = struct{}{}
+		}
+	}
+	for name := range record.Accomplishments {
+		if hat, ok := ACCOMPLISHMENT_HATS[name]; ok {
+			inventory.hats[hat] = struct{}{}
+		}
+	}
+	for name, count := range record.Inventory.Items {
+		if count > 0 {
+			inventory.items[name] = count
+		}
+	}
+	if _, ok := inventory.hats[inventory.activeHat]; !ok {
+		inventory.activeHat = ""
+	}
+}
+
+func (inventory *Inventory) record() InventoryRecord {
+	inventory.Lock()
+	defer inventory.Unlock()
+	out := InventoryRecord{Hats: sortedKeys(inventory.hats), ActiveHat: inventory.activeHat}
+	if len(inventory.items) > 0 {
+		out.Items = make(map[string]int, len(inventory.items))
+		for name, count := range inventory.items {
+			out.Items[name] = count
+		}
+	}
+	return out
+}
+
+// Returns false if already owned or a status hat
+func (inventory *Inventory) unlockHat(name string) bool {
+	inventory.Lock()
+	defer inventory.Unlock()
+	if _, ok := inventory.hats[name]; ok || STATUS_HATS[name] {
+		return false
+	}
+	if inventory.hats == nil {
+		inventory.hats = make(map[string]struct{})
+	}
+	inventory.hats[name] = struct{}{}
+	return true
+}
+
+// Undoes an unlock that could not be paid for
+func (inventory *Inventory) releaseHat(name string) {
+	inventory.Lock()
+	defer inventory.Unlock()
+	delete(inventory.hats, name)
+	if inventory.activeHat == name {
+		inventory.activeHat = ""
+	}
+}
+
+func (inventory *Inventory) ownsHat(name string) bool {
+	inventory.Lock()
+	defer inventory.Unlock()
+	_, ok := inventory.hats[name]
+	return ok
+}
+
+func (inventory *Inventory) ownedHats() []string {
+	inventory.Lock()
+	defer inventory.Unlock()
+	return sortedKeys(inventory.hats)
+}
+
+// An empty name takes the hat off
+func (inventory *Inventory) setActiveHat(name string) bool {
+	inventory.Lock()
+	defer inventory.Unlock()
+	if _, ok := inventory.hats[name]; !ok && name != "" {
+		return false
+	}
+	inventory.activeHat = name
+	return true
+}
+
+func (inventory *Inventory) getActiveHat() string {
+	inventory.Lock()
+	defer inventory.Unlock()
+	return inventory.activeHat
+}
+
+func (inventory *Inventory) addItem(name string, n int) int {
+	inventory.Lock()
+	defer inventory.Unlock()
+	if inventory.items == nil {
+		inventory.items = make(map[string]int)
+	}
+	inventory.items[name] += n
+	return inventory.items[name]
+}
+
+// All or nothing, a name listed twice is taken twice
+func (inventory *Inventory) removeItems(names []string) bool {
+	inventory.Lock()
+	defer inventory.Unlock()
+	needed := make(map[string]int, len(names))
+	for _, name := range names {
+		needed[name]++
+	}
+	for name, n := range needed {
+		if inventory.items[name] < n {
+			return false
+		}
+	}
+	for name, n := range needed {
+		inventory.items[name] -= n
+		if inventory.items[name] == 0 {
+			delete(inventory.items, name)
+		}
+	}
+	return true
+}
+
+func (inventory *Inventory) itemCount(name string) int {
+	inventory.Lock()
+	defer inventory.Unlock()
+	return inventory.items[name]
+}
+
+////////////////////////////////////////////////////////////
+// Player
+
+// Saved right away like accomplishments, the active hat is saved with the rest of the record
+func (player *Player) saveInventory() {
+	if err := player.world.db.updateInventoryForPlayer(player.username, player.inventory.record()); err != nil {
+		logger.Error().Err(err).Msg("Failed to save inventory for " + player.username)
+	}
+}
+
+func (player *Player) unlockHat(name string) {
+	if player.inventory.unlockHat(name) {
+		player.saveInventory()
+	}
+}
+
+// Chosen hats are worn until changed, awarded hats until death
+func (player *Player) equipHat(name string) bool {
+	if !player.inventory.setActiveHat(name) {
+		return false
+	}
+	player.setHat(HAT_NAME_TO_TRIM[name])
+	updateIconForAllIfTangible(player)
+	return true
+}
+
+func (player *Player) wearActiveHat() {
+	player.setHat(HAT_NAME_TO_TRIM[player.inventory.getActiveHat()])
+}
+
+func (player *Player) giveItem(name string, n int) {
+	player.inventory.addItem(name, n)
+	player.saveInventory()
+}
+
+func (player *Player) takeItems(names []string) bool {
+	if !player.inventory.removeItems(names) {
+		return false
+	}
+	if len(names) > 0 {
+		player.saveInventory()
+	}
+	return true
+}
+
+////////////////////////////////////////////////////////////
+// Wardrobe
+
+func openWardrobeMenu(p *Player) {
+	active := p.inventory.getActiveHat()
+	menu := Menu{
+		Name:     "wardrobe",
+		CssClass: "",
+		InfoHtml: createInventoryHtmlForPlayer(p),
+		Links:    []MenuLink{{Text: wardrobeLinkText("No hat", active == ""), eventHandler: equipAndReopen(""), auth: nil}},
+	}
+	for _, hat := range p.inventory.ownedHats() {
+		menu.Links = append(menu.Links, MenuLink{Text: wardrobeLinkText(hat, hat == active), eventHandler: equipAndReopen(hat), auth: nil})
+	}
+	menu.Links = append(menu.Links,
+		MenuLink{Text: "Back", eventHandler: openStatsMenu, auth: nil},
+		MenuLink{Text: "Close", eventHandler: turnMenuOff, auth: nil},
+	)
+	p.setMenu("wardrobe", menu)
+	sendMenu(p, menu)
+}
+
+func wardrobeLinkText(name string, active bool) string {
+	if active {
+		return "✔️ " + name
+	}
+	return name
+}
+
+func equipAndReopen(hat string) func(*Player) {
+	return func(p *Player) {
+		p.equipHat(hat)
+		openWardrobeMenu(p)
+	}
+}
+
+func createInventoryHtmlForPlayer(p *Player) template.HTML {
+	items := p.inventory.record().Items
+	if len(items) == 0 {
+		return `<h2>Wardrobe</h2>`
+	}
+	var sb strings.Builder
+	sb.WriteString(`<h2>Wardrobe</h2><div class="player-inventory">`)
+	for _, name := range sortedKeys(items) {
+		sb.WriteString(fmt.Sprintf(`<p>&#9656;%s: %d</p>`, template.HTMLEscapeString(name), items[name]))
+	}
+	sb.WriteString(`</div>`)
+	return template.HTML(sb.String())
+}
+
+////////////////////////////////////////////////////////////
+// Reactions
+//
+//	"locked-door": [
+//	    {"reactsWith": {"name": "all", "of": [{"name": "interactableIsNil"}, {"name": "playerHasItem", "args": ["gold-key"]}]},
+//	     "reaction": {"name": "openDoor", "args": ["gold-key"]}}
+//	]
+
+func playerHasItem(item string) func(*Interactable, *Player) bool {
+	return func(_ *Interactable, p *Player) bool {
+		if p == nil {
+			return false
+		}
+		return p.inventory.itemCount(item) > 0
+	}
+}
+
+func playerOwnsHat(hat string) func(*Interactable, *Player) bool {
+	return func(_ *Interactable, p *Player) bool {
+		if p == nil {
+			return false
+		}
+		return p.inventory.ownsHat(hat)
+	}
+}
+
+// Opens for everyone, the keys named in args are used up together.
+// An open door no longer reacts so walking through it takes nothing.
+func openDoor(keys []string) func(*Interactable, *Player, *Tile) (*Interactable, bool) {
+	return func(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
+		if !p.takeItems(keys) {
+			return nil, false
+		}
+		if t.interactable != nil {
+			t.interactable.walkable = true
+			t.interactable.cssClass = ""
+			t.interactable.reactions = nil
+			t.interactable.reactionsName = ""
+			t.updateAll(interactableBoxSpecific(t.y, t.x, t.interactable))
+		}
+		return nil, false
+	}
+}
+
+// The interactable is taken from the tile, e.g. a key lying on the ground
+func pickUpItem(item string, n int) func(*Interactable, *Player, *Tile) (*Interactable, bool) {
+	return func(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
+		p.giveItem(item, n)
+		sendSoundToPlayer(p, "money")
+		p.updateBottomText(fmt.Sprintf("Picked up %s", item))
+		setLockedInteractableAndUpdate(t, nil)
+		return nil, false
+	}
+}
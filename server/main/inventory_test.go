@@ -0,0 +1,191 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func joinInventoryTestingPlayer(t *testing.T, world *World, record PlayerRecord) *Player {
+	record.Team, record.StageName, record.Health = "fuchsia", "test-admin", 100
+	if err := world.db.InsertPlayerRecord(record); err != nil {
+		t.Fatal(err)
+	}
+	return joinPlayerForTesting(t, world, record, &MockConn{})
+}
+
+func TestInventoryUnlocksHatsFromAccomplishments(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	player := joinInventoryTestingPlayer(t, world, PlayerRecord{
+		Username:        "veteran",
+		Accomplishments: map[string]Accomplishment{puzzle0: {Name: puzzle0}, doubleKill: {Name: doubleKill}},
+		Inventory:       InventoryRecord{Hats: []string{"contributor"}, ActiveHat: "puzzle-solve"},
+	})
+
+	hats := player.inventory.ownedHats()
+	if len(hats) != 2 || hats[0] != "contributor" || hats[1] != "puzzle-solve" {
+		t.Errorf("unexpected hats %v", hats)
+	}
+	if player.getHatSync() != HAT_NAME_TO_TRIM["puzzle-solve"] {
+		t.Error("the active hat should be worn on login")
+	}
+}
+
+func TestInventoryIgnoresUnownedActiveHat(t *testing.T) {
+	var inventory Inventory
+	inventory.load(PlayerRecord{Inventory: InventoryRecord{ActiveHat: "contributor"}})
+	if inventory.getActiveHat() != "" {
+		t.Error("a hat that is not owned should not be active")
+	}
+}
+
+func TestEarnedHatsArePersisted(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	player := joinInventoryTestingPlayer(t, world, PlayerRecord{Username: "earner"})
+
+	player.setHatByName("score-a-goal")
+	player.addAccomplishmentByName(puzzle0)
+	record, _ := world.db.getPlayerRecord("earner")
+	if len(record.Inventory.Hats) != 2 || record.Inventory.Hats[0] != "puzzle-solve" || record.Inventory.Hats[1] != "score-a-goal" {
+		t.Errorf("earned hats should be saved, got %v", record.Inventory.Hats)
+	}
+
+	if player.equipHat("contributor") {
+		t.Error("a hat that is not owned should not be equipped")
+	}
+	if !player.equipHat("puzzle-solve") {
+		t.Fatal("an owned hat should be equipped")
+	}
+	player.setHatByName("score-a-goal")
+	player.wearActiveHat() // As on death
+	if player.getHatSync() != HAT_NAME_TO_TRIM["puzzle-solve"] {
+		t.Error("the chosen hat should be worn again after death")
+	}
+	world.db.updatePlayerRecordOnLogout(player, player.getTileSync())
+	record, _ = world.db.getPlayerRecord("earner")
+	if record.Inventory.ActiveHat != "puzzle-solve" {
+		t.Errorf("the chosen hat should be saved with the record, got %q", record.Inventory.ActiveHat)
+	}
+}
+
+func TestStatusHatsAreNotKept(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	player := joinInventoryTestingPlayer(t, world, PlayerRecord{
+		Username:        "champion",
+		Accomplishments: map[string]Accomplishment{becomeMostDangerous: {Name: becomeMostDangerous}},
+		Inventory:       InventoryRecord{Hats: []string{"winning-team"}, ActiveHat: "winning-team"},
+	})
+	if len(player.inventory.ownedHats()) != 0 || player.inventory.getActiveHat() != "" {
+		t.Errorf("status hats should not load into the wardrobe, got %v", player.inventory.ownedHats())
+	}
+
+	awardHatByTeam(world, "fuchsia", "winning-team")
+	if player.getHatSync() != HAT_NAME_TO_TRIM["winning-team"] {
+		t.Error("the winning team should wear the hat")
+	}
+	if player.inventory.ownsHat("winning-team") || player.equipHat("winning-team") {
+		t.Error("the hat should only last until death")
+	}
+	player.wearActiveHat()
+	if player.getHatSync() != "" {
+		t.Error("expected the status hat to come off")
+	}
+}
+
+func TestWardrobeMenuEquips(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	player := joinInventoryTestingPlayer(t, world, PlayerRecord{Username: "dresser", Inventory: InventoryRecord{Hats: []string{"ice-trim"}}})
+
+	openWardrobeMenu(player)
+	menu, ok := player.getMenu("wardrobe")
+	if !ok || len(menu.Links) != 4 {
+		t.Fatalf("expected no hat, one hat, back and close, got %+v", menu.Links)
+	}
+	menu.attemptClick(player, PlayerSocketEvent{MenuName: "wardrobe", Arg0: strconv.Itoa(1)})
+	if player.inventory.getActiveHat() != "ice-trim" || player.getHatSync() != HAT_NAME_TO_TRIM["ice-trim"] {
+		t.Error("expected the hat to be equipped from the wardrobe")
+	}
+	menu, _ = player.getMenu("wardrobe")
+	menu.attemptClick(player, PlayerSocketEvent{MenuName: "wardrobe", Arg0: strconv.Itoa(0)})
+	if player.inventory.getActiveHat() != "" || player.getHatSync() != "" {
+		t.Error("expected the hat to be taken off")
+	}
+}
+
+func TestLockedDoorUsesKey(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	player := joinInventoryTestingPlayer(t, world, PlayerRecord{Username: "keyholder"})
+	reactions, err := compileReactions([]ReactionDescription{
+		{
+			ReactsWith: PredicateDescription{Name: "all", Of: []PredicateDescription{{Name: "interactableIsNil"}, {Name: "playerHasItem", Args: []string{"gold-key"}}}},
+			Reaction:   ActionDescription{Name: "openDoor", Args: []string{"gold-key"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tile := player.getTileSync().stage.tiles[1][3]
+	tile.interactable = &Interactable{name: "door", cssClass: "door", reactions: reactions}
+
+	if tile.interactable.React(nil, player, tile, 0, 1) || tile.interactable.walkable {
+		t.Error("the door should stay shut without a key")
+	}
+	player.giveItem("gold-key", 1)
+	if !tile.interactable.React(nil, player, tile, 0, 1) || !tile.interactable.walkable {
+		t.Error("the door should open with a key")
+	}
+	if player.inventory.itemCount("gold-key") != 0 {
+		t.Error("the key should be used up")
+	}
+	record, _ := world.db.getPlayerRecord("keyholder")
+	if len(record.Inventory.Items) != 0 {
+		t.Errorf("the used key should be saved, got %v", record.Inventory.Items)
+	}
+
+	player.giveItem("gold-key", 1)
+	tile.interactable.React(nil, player, tile, 0, 1) // Walking through
+	if player.inventory.itemCount("gold-key") != 1 || tile.interactable.reactionsName != "" {
+		t.Error("an open door should not take another key")
+	}
+}
+
+func TestLockedDoorTakesAllKeysOrNone(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	player := joinInventoryTestingPlayer(t, world, PlayerRecord{Username: "locksmith"})
+	action, err := compileAction(ActionDescription{Name: "openDoor", Args: []string{"gold-key", "ice-key", "gold-key"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tile := player.getTileSync().stage.tiles[1][3]
+	tile.interactable = &Interactable{name: "door", cssClass: "door"}
+
+	player.giveItem("gold-key", 1)
+	player.giveItem("ice-key", 1)
+	action(nil, player, tile)
+	if tile.interactable.walkable || player.inventory.itemCount("gold-key") != 1 || player.inventory.itemCount("ice-key") != 1 {
+		t.Error("no key should be used while one is missing")
+	}
+	player.giveItem("gold-key", 1)
+	action(nil, player, tile)
+	if !tile.interactable.walkable || len(player.inventory.record().Items) != 0 {
+		t.Errorf("expected every key used, left %v", player.inventory.record().Items)
+	}
+}
+
+func TestPickUpItem(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	player := joinInventoryTestingPlayer(t, world, PlayerRecord{Username: "collector"})
+	action, err := compileAction(ActionDescription{Name: "pickUpItem", Args: []string{"gold-key", "2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tile := player.getTileSync().stage.tiles[1][2]
+	tile.interactable = &Interactable{name: "key"}
+	action(nil, player, tile)
+	if tile.interactable != nil || player.inventory.itemCount("gold-key") != 2 {
+		t.Error("expected the key to move from the tile to the inventory")
+	}
+	record, _ := world.db.getPlayerRecord("collector")
+	if record.Inventory.Items["gold-key"] != 2 {
+		t.Errorf("expected the key to be saved, got %v", record.Inventory.Items)
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"math/rand"
 	"strconv"
 	"time"
 )
@@ -82,7 +81,7 @@ func both(f1, f2 func(*Player, *Stage) bool) func(*Player, *Stage) bool {
 
 func oneOutOf(n int) func(*Player, *Stage) bool {
 	return func(_ *Player, stage *Stage) bool {
-		r := rand.Intn(n)
+		r := stage.intn(n)
 		return r == 0
 	}
 }
@@ -151,11 +150,11 @@ func tutorial1Npc(player *Player) {
 	tiles0 := getRegion(stage.tiles, Rect{2, 5, 5, 6})
 	tiles1 := getRegion(stage.tiles, Rect{6, 7, 2, 4})
 	tiles := append(tiles0, tiles1...)
-	tile, ok := pickOne(tiles)
+	tile, ok := pickOne(tiles, stage.intn)
 	if !ok {
 		return
 	}
-	randStr := strconv.Itoa(rand.Intn(16))
+	randStr := strconv.Itoa(stage.intn(16))
 	spawnNewNPCDoingAction(player, randStr, 110, 60, moveAgressiveRand(shortShapes), tile)
 }
 
@@ -192,11 +191,11 @@ func clamp(v, lo, hi int) int {
 }
 
 // ok is false when the slice is empty.
-func pickOne[T any](items []T) (item T, ok bool) {
+func pickOne[T any](items []T, intn func(int) int) (item T, ok bool) {
 	if len(items) == 0 {
 		return
 	}
-	item = items[rand.Intn(len(items))]
+	item = items[intn(len(items))]
 	ok = true
 	return
 }
@@ -208,7 +207,7 @@ func tutorial1Ring(player *Player) {
 		stage.tiles[13][2],
 		stage.tiles[2][13],
 	}
-	n := rand.Intn(len(tiles))
+	n := stage.intn(len(tiles))
 	n2 := mod(n+1, len(tiles))
 	tile := tiles[n]
 	tile2 := tiles[n2]
@@ -253,7 +252,7 @@ func tutorialPower(stage *Stage) {
 
 func spawnBoosts(stage *Stage) {
 	_, uncoveredTiles := sortWalkableTiles(stage.tiles)
-	tile := uncoveredTiles[rand.Intn(len(uncoveredTiles))]
+	tile := uncoveredTiles[stage.intn(len(uncoveredTiles))]
 	tile.addBoostsAndNotifyAll()
 }
 
@@ -312,10 +311,10 @@ func spawnPowerup(stage *Stage) {
 }
 
 func spawnPowerupFromSet(stage *Stage, shapes [][][2]int) {
-	index := rand.Intn(len(shapes))
+	index := stage.intn(len(shapes))
 	tiles, uncoveredTiles := sortWalkableTiles(stage.tiles)
 	tiles = append(tiles, uncoveredTiles...)
-	tile := tiles[rand.Intn(len(tiles))]
+	tile := tiles[stage.intn(len(tiles))]
 	tile.addPowerUpAndNotifyAll(shapes[index])
 }
 
@@ -356,21 +355,21 @@ func basicSpawnOld(stage *Stage) {
 */
 
 func basicSpawnWithRingAndNPCs(p *Player) {
-	determination := rand.Intn(1000)
+	stage := p.getTileSync().stage
+	determination := stage.intn(1000)
 	if determination < 350 {
 		// Do nothing
 		return
 	}
-	stage := p.getTileSync().stage
 	if determination < 650 {
 		spawnBoosts(stage)
 	} else if determination < 910 {
 		spawnPowerupGood(stage)
 	} else if determination < 975 {
-		tryPlaceInteractableOnStage(stage, createRing())
+		tryPlaceInteractableOnStage(stage, createRing(stage))
 	}
 
-	determination2 := rand.Intn(16)
+	determination2 := stage.intn(16)
 	lifeInSeconds := 450
 	if determination2%8 == 0 {
 		spawnPowerupGood(stage)
@@ -384,23 +383,31 @@ func basicSpawnWithRingAndNPCs(p *Player) {
 	if determination2 == 0 {
 		spawnPowerupGood(stage)
 		spawnPowerupGood(stage)
-		npc := spawnNewNPCDoingAction(p, "npc", 95, lifeInSeconds, moveAgressiveRand(shapesNpc), nil)
+		npc := spawnNewNPCDoingAction(p, "npc", 95, lifeInSeconds, powerUpNpcAction(p.world), nil)
 		npc.money.Add(int64(200))
 	}
 
-	determination3 := rand.Intn(24)
+	determination3 := stage.intn(24)
 	if determination3 == 1 {
-		tryPlaceInteractableOnStage(stage, createRing())
-		tryPlaceInteractableOnStage(stage, createRing())
-		tryPlaceInteractableOnStage(stage, createRing())
+		tryPlaceInteractableOnStage(stage, createRing(stage))
+		tryPlaceInteractableOnStage(stage, createRing(stage))
+		tryPlaceInteractableOnStage(stage, createRing(stage))
 		npc := spawnNewNPCDoingAction(p, "npc", 95, lifeInSeconds, moveAgressiveRand(shortShapes), nil)
 		npc.money.Add(int64(200))
 	}
 
 }
 
+// Hunting is opt in, see Configuration
+func powerUpNpcAction(world *World) func(*NonPlayer) {
+	if world.config.huntingNpcs {
+		return huntNearestEnemy(shapesNpc)
+	}
+	return moveAgressiveRand(shapesNpc)
+}
+
 func basicSpawnNoRing(stage *Stage) {
-	determination := rand.Intn(1000)
+	determination := stage.intn(1000)
 	if determination < 250 {
 		// Do nothing
 	} else if determination < 700 {
@@ -411,7 +418,7 @@ func basicSpawnNoRing(stage *Stage) {
 }
 
 func basicSpawnWeak(stage *Stage) {
-	determination := rand.Intn(1000)
+	determination := stage.intn(1000)
 	if determination < 400 {
 		// Do nothing
 	} else if determination < 750 {
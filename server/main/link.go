@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Kept in the session by callback when a guest signs in, until the user chooses to merge or discard
+const SESSION_GUEST_KEY = "guest"
+
+var (
+	errUsernameTaken = errors.New("username unavailable")
+	errNotAGuest     = errors.New("not a guest record")
+	errPlayerOnline  = errors.New("player is online")
+)
+
+////////////////////////////////////////////////////////////
+// Records
+
+// Counts are added, peaks kept and unlocks combined. Location, team and health stay with the target.
+func mergeGuestRecord(target *PlayerRecord, guest PlayerRecord) {
+	target.Money += guest.Money
+	target.Stats.KillCount += guest.Stats.KillCount
+	target.Stats.KillCountNpc += guest.Stats.KillCountNpc
+	target.Stats.DeathCount += guest.Stats.DeathCount
+	target.Stats.GoalsScored += guest.Stats.GoalsScored
+	if guest.Stats.PeakKillStreak > target.Stats.PeakKillStreak {
+		target.Stats.PeakKillStreak = guest.Stats.PeakKillStreak
+	}
+	if guest.Stats.PeakWealth > target.Stats.PeakWealth {
+		target.Stats.PeakWealth = guest.Stats.PeakWealth
+	}
+
+	if len(guest.Accomplishments) > 0 && target.Accomplishments == nil {
+		target.Accomplishments = make(map[string]Accomplishment, len(guest.Accomplishments))
+	}
+	for key, accomplishment := range guest.Accomplishments {
+		if _, ok := target.Accomplishments[key]; !ok {
+			target.Accomplishments[key] = accomplishment
+		}
+	}
+
+	hats := make(map[string]struct{}, len(target.Inventory.Hats)+len(guest.Inventory.Hats))
+	for _, hat := range append(append([]string{}, target.Inventory.Hats...), guest.Inventory.Hats...) {
+		hats[hat] = struct{}{}
+	}
+	target.Inventory.Hats = sortedKeys(hats)
+	if target.Inventory.ActiveHat == "" {
+		target.Inventory.ActiveHat = guest.Inventory.ActiveHat
+	}
+	if len(guest.Inventory.Items) > 0 && target.Inventory.Items == nil {
+		target.Inventory.Items = make(map[string]int, len(guest.Inventory.Items))
+	}
+	for name, count := range guest.Inventory.Items {
+		target.Inventory.Items[name] += count
+	}
+	target.MergedGuests = append(target.MergedGuests, guest.Username)
+}
+
+// A user without a player takes over the guest's player as it is
+func adoptGuestRecord(guest PlayerRecord, username string) PlayerRecord {
+	guest.MergedGuests = append(guest.MergedGuests, guest.Username)
+	guest.Username = username
+	guest.GuestCreateTime = nil
+	guest.LinkingTo = ""
+	return guest
+}
+
+// Records are merged while neither player is in a world, a live player would save over the merge
+func playerOnline(record PlayerRecord) bool {
+	return record.LastLogin.After(record.LastLogout)
+}
+
+////////////////////////////////////////////////////////////
+// Session
+
+func getGuestToLinkFromSession(r *http.Request) (string, bool) {
+	session, err := store.Get(r, "user-session")
+	if err != nil || session == nil {
+		return "", false
+	}
+	guest, ok := session.Values[SESSION_GUEST_KEY].(string)
+	return guest, ok && idBelongsToGuest(guest)
+}
+
+func forgetGuestInSession(w http.ResponseWriter, r *http.Request) error {
+	session, err := store.Get(r, "user-session")
+	if err != nil {
+		return err
+	}
+	delete(session.Values, SESSION_GUEST_KEY)
+	return session.Save(r, w)
+}
+
+////////////////////////////////////////////////////////////
+// Handlers
+
+type LinkGuestPage struct {
+	Guest             PlayerRecord
+	Username          string // Of the existing player, empty if the user has none yet
+	SuggestedUsername string
+}
+
+// Shown from the home page while a guest is waiting to be linked
+func (app *App) linkGuestPage(w http.ResponseWriter, id, guest string) bool {
+	userRecord := app.db.getAuthorizedUserById(id)
+	if userRecord == nil {
+		return false
+	}
+	guestRecord, err := app.db.getPlayerRecord(guest)
+	if err != nil {
+		return false
+	}
+	page := LinkGuestPage{Guest: guestRecord, Username: userRecord.Username}
+	if userRecord.Username == "" {
+		page.SuggestedUsername = uniqueName(app.db)
+	}
+	tmpl.ExecuteTemplate(w, "link-guest", page)
+	return true
+}
+
+func (app *App) linkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		return
+	}
+	id, ok := getUserIdFromSession(r)
+	if !ok || idBelongsToGuest(id) {
+		io.WriteString(w, divBottomInvalid("Sign in to keep guest progress"))
+		return
+	}
+	guest, ok := getGuestToLinkFromSession(r)
+	if !ok {
+		w.Header().Set("HX-Redirect", "/")
+		return
+	}
+	props, ok := requestToProperties(r)
+	if !ok {
+		io.WriteString(w, divBottomInvalid("Invalid request"))
+		return
+	}
+
+	if props["choice"] == "merge" {
+		username, err := url.QueryUnescape(props["player-name"])
+		if err != nil {
+			io.WriteString(w, divBottomInvalid("Invalid Username"))
+			return
+		}
+		userRecord := app.db.getAuthorizedUserById(id)
+		if userRecord == nil {
+			io.WriteString(w, divBottomInvalid("Unknown user"))
+			return
+		}
+		if userRecord.Username == "" && !validUsername(username) {
+			io.WriteString(w, divBottomInvalid("Invalid Username"))
+			return
+		}
+		username, err = app.db.linkGuestToUser(id, guest, username)
+		if errors.Is(err, errUsernameTaken) {
+			io.WriteString(w, divBottomInvalid("Username unavailable. Try again."))
+			return
+		}
+		if errors.Is(err, errPlayerOnline) {
+			io.WriteString(w, divBottomInvalid("Leave the game to keep guest progress. Try again."))
+			return
+		}
+		if err != nil && !errors.Is(err, errRecordNotFound) {
+			logger.Error().Err(err).Msg("Failed to link guest " + guest + " to " + id)
+			forgetGuestInSession(w, r) // The merge is not offered again
+			io.WriteString(w, divBottomInvalid("Error, progress not saved"))
+			return
+		}
+		if err == nil {
+			logger.Info().Msg(fmt.Sprintf("Guest %s merged into %s", guest, username))
+		}
+	}
+
+	if err := forgetGuestInSession(w, r); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("HX-Redirect", "/")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Successful - Redirecting"))
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+func createLinkTestingStore(t *testing.T) *FileStore {
+	db := createMemoryStore()
+	guest := createNewGuestPlayerRecord("guest:abc", "fuchsia")
+	guest.Money = 500
+	guest.Stats = PlayerStatsRecord{KillCount: 3, PeakKillStreak: 3, GoalsScored: 1}
+	guest.Accomplishments = map[string]Accomplishment{puzzle0: {Name: puzzle0}}
+	guest.Inventory = InventoryRecord{Hats: []string{"ice-trim"}, Items: map[string]int{"gold-key": 1}}
+	if err := db.InsertPlayerRecord(guest); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestLinkGuestIntoExistingPlayer(t *testing.T) {
+	db := createLinkTestingStore(t)
+	db.insertAuthorizedUser(UserRecord{Identifier: "google:1", Username: "alice"})
+	db.InsertPlayerRecord(PlayerRecord{
+		Username:  "alice",
+		Money:     100,
+		Stats:     PlayerStatsRecord{KillCount: 10, PeakKillStreak: 2},
+		Inventory: InventoryRecord{Hats: []string{"contributor"}, ActiveHat: "contributor", Items: map[string]int{"gold-key": 2}},
+	})
+
+	username, err := db.linkGuestToUser("google:1", "guest:abc", "ignored")
+	if err != nil || username != "alice" {
+		t.Fatalf("expected guest merged into alice, got %q %v", username, err)
+	}
+	record, _ := db.getPlayerRecord("alice")
+	if record.Money != 600 || record.Stats.KillCount != 13 || record.Stats.PeakKillStreak != 3 || record.Stats.GoalsScored != 1 {
+		t.Errorf("unexpected merged stats %+v money %d", record.Stats, record.Money)
+	}
+	if _, ok := record.Accomplishments[puzzle0]; !ok {
+		t.Error("expected the guest's accomplishment")
+	}
+	inventory := record.Inventory
+	if len(inventory.Hats) != 2 || inventory.ActiveHat != "contributor" || inventory.Items["gold-key"] != 3 {
+		t.Errorf("unexpected merged inventory %+v", inventory)
+	}
+	if db.foundUsername("guest:abc") {
+		t.Error("the guest should be retired")
+	}
+	if _, err := db.linkGuestToUser("google:1", "guest:abc", ""); err != errRecordNotFound {
+		t.Errorf("a guest should only be merged once, got %v", err)
+	}
+}
+
+func TestLinkGuestAsNewPlayer(t *testing.T) {
+	db := createLinkTestingStore(t)
+	db.insertAuthorizedUser(UserRecord{Identifier: "google:2"})
+	db.InsertPlayerRecord(PlayerRecord{Username: "taken"})
+
+	if _, err := db.linkGuestToUser("google:2", "guest:abc", "taken"); err != errUsernameTaken {
+		t.Errorf("expected the username to be unavailable, got %v", err)
+	}
+	if !db.foundUsername("guest:abc") || db.getAuthorizedUserById("google:2").Username != "" {
+		t.Error("a failed link should change nothing")
+	}
+
+	if _, err := db.linkGuestToUser("google:2", "guest:abc", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	record, err := db.getPlayerRecord("bob")
+	if err != nil || record.Money != 500 || record.GuestCreateTime != nil || record.Team != "fuchsia" {
+		t.Errorf("expected the guest to become bob, got %+v %v", record, err)
+	}
+	if db.getAuthorizedUserById("google:2").Username != "bob" || db.foundUsername("guest:abc") {
+		t.Error("expected the user to own bob and the guest to be retired")
+	}
+}
+
+func TestLinkRejectsPlayersThatAreNotGuests(t *testing.T) {
+	db := createLinkTestingStore(t)
+	db.insertAuthorizedUser(UserRecord{Identifier: "google:3", Username: "thief"})
+	db.InsertPlayerRecord(PlayerRecord{Username: "thief"})
+	db.InsertPlayerRecord(PlayerRecord{Username: "rich", Money: 1_000_000})
+
+	if _, err := db.linkGuestToUser("google:3", "rich", ""); err != errNotAGuest {
+		t.Errorf("expected only guests to be merged, got %v", err)
+	}
+}
+
+func TestLinkRefusesOnlinePlayers(t *testing.T) {
+	db := createLinkTestingStore(t)
+	db.insertAuthorizedUser(UserRecord{Identifier: "google:5", Username: "dave"})
+	db.InsertPlayerRecord(PlayerRecord{Username: "dave", LastLogin: time.Now()})
+
+	if _, err := db.linkGuestToUser("google:5", "guest:abc", ""); err != errPlayerOnline {
+		t.Errorf("expected a player in a world to be left alone, got %v", err)
+	}
+	db.updatePlayer("dave", func(record *PlayerRecord) { record.LastLogout = time.Now() })
+	db.updatePlayer("guest:abc", func(record *PlayerRecord) { record.LastLogin = time.Now() })
+	if _, err := db.linkGuestToUser("google:5", "guest:abc", ""); err != errPlayerOnline || !db.foundUsername("guest:abc") {
+		t.Errorf("expected a guest in a world to be left alone, got %v", err)
+	}
+}
+
+// As left by callback after signing in from a guest session
+func linkTestingCookie(t *testing.T, identifier, guest string) *http.Cookie {
+	previous := store
+	t.Cleanup(func() { store = previous })
+	store = sessions.NewCookieStore([]byte("link-testing-key"))
+	setup := httptest.NewRecorder()
+	session, _ := store.Get(httptest.NewRequest("GET", "/", nil), "user-session")
+	session.Values["identifier"] = identifier
+	session.Values[SESSION_GUEST_KEY] = guest
+	session.Save(httptest.NewRequest("GET", "/", nil), setup)
+	return setup.Result().Cookies()[0]
+}
+
+func TestLinkHandlerMergesGuestFromSession(t *testing.T) {
+	cookie := linkTestingCookie(t, "google:4", "guest:abc")
+	db := createLinkTestingStore(t)
+	db.insertAuthorizedUser(UserRecord{Identifier: "google:4"})
+	app := App{db: db, config: &testingConfig}
+
+	home := httptest.NewRequest("GET", "/", nil)
+	home.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	app.homeHandler(w, home)
+	if !strings.Contains(w.Body.String(), "Keep your guest progress") {
+		t.Fatal("expected the home page to offer the merge")
+	}
+
+	form := url.Values{"choice": {"merge"}, "player-name": {"carol"}}
+	r := httptest.NewRequest(http.MethodPost, "/link", strings.NewReader(form.Encode()))
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	app.linkHandler(w, r)
+	if w.Header().Get("HX-Redirect") != "/" {
+		t.Fatalf("expected a redirect home, got %q", w.Body.String())
+	}
+	if record, err := db.getPlayerRecord("carol"); err != nil || record.Money != 500 {
+		t.Errorf("expected the guest's progress under carol, got %+v %v", record, err)
+	}
+
+	home = httptest.NewRequest("GET", "/", nil)
+	for _, updated := range w.Result().Cookies() {
+		home.AddCookie(updated)
+	}
+	if guest, ok := getGuestToLinkFromSession(home); ok {
+		t.Errorf("the guest should be forgotten after linking, still have %s", guest)
+	}
+}
+
+func TestLinkHandlerForgetsGuestOnFailure(t *testing.T) {
+	cookie := linkTestingCookie(t, "google:6", "guest:xyz")
+	db := createLinkTestingStore(t)
+	db.insertAuthorizedUser(UserRecord{Identifier: "google:6", Username: "erin"})
+	db.InsertPlayerRecord(PlayerRecord{Username: "erin"})
+	db.InsertPlayerRecord(PlayerRecord{Username: "guest:xyz"}) // Missing its guest details
+	app := App{db: db, config: &testingConfig}
+
+	form := url.Values{"choice": {"merge"}}
+	r := httptest.NewRequest(http.MethodPost, "/link", strings.NewReader(form.Encode()))
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	app.linkHandler(w, r)
+	if !strings.Contains(w.Body.String(), "progress not saved") {
+		t.Fatalf("expected the link to fail, got %q", w.Body.String())
+	}
+
+	home := httptest.NewRequest("GET", "/", nil)
+	for _, updated := range w.Result().Cookies() {
+		home.AddCookie(updated)
+	}
+	if guest, ok := getGuestToLinkFromSession(home); ok {
+		t.Errorf("a failed link should not be offered again, still have %s", guest)
+	}
+}
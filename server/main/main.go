@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"html/template"
+	"log"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
@@ -19,7 +21,7 @@ var logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
 var store *sessions.CookieStore // Move in app?
 
 type App struct {
-	db           *DB
+	db           Storage
 	config       *Configuration
 	guestLimiter *GuestLimiter
 }
@@ -34,8 +36,23 @@ func main() {
 	gothic.Store = store
 	goth.UseProviders(google.New(config.googleClientId, config.googleClientSecret, config.googleCallbackUrl))
 
+	logger.Info().Msg("Loading teams...")
+	loadTeams()
+	loadShop()
+
 	logger.Info().Msg("Initializing database connection..")
-	db := createDbConnection(config)
+	db := createStorage(config)
+
+	if len(os.Args) > 1 && os.Args[1] == "cleanup" {
+		if err := runCleanupCommand(db, config, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if policy := retentionPolicyFromConfig(config); policy.enabled() && config.runsRetention {
+		logger.Info().Msg("Starting retention...")
+		go periodicRetention(db, policy)
+	}
 
 	if pProfEnabled() {
 		go initiatePProf()
@@ -48,6 +65,7 @@ func main() {
 		logger.Info().Msg("Setting up hub...")
 		app := App{db, config, &GuestLimiter{}}
 		hub := createDefaultHub(db) // rename ?
+		hub.seasons = createSeasonCalendar(config.seasonLength)
 
 		// Static Assets
 		mux.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(http.Dir("./assets"))))
@@ -59,7 +77,7 @@ func main() {
 
 		// Oauth
 		mux.HandleFunc("/auth", auth)
-		mux.HandleFunc("/callback", db.callback)
+		mux.HandleFunc("/callback", app.callback)
 		mux.HandleFunc("/guests", app.guestsHandler)
 		mux.HandleFunc("/signout", signOutHandler)
 
@@ -69,14 +87,20 @@ func main() {
 		mux.HandleFunc("/wrong", somethingWentWrong)
 
 		// New Account
-		mux.HandleFunc("/new", db.postNew)
+		mux.HandleFunc("/new", app.postNew)
+		mux.HandleFunc("/link", app.linkHandler)
 	}
 
+	var world *World // Nil unless serving a world
 	if config.isServer() {
 		logger.Info().Msg("Starting game world...")
-		world := createGameWorld(db, config)
+		stageTickInterval = config.stageTick
+		loadFromJson() // Before the world - persisted stages are checked against their areas
+		world = createGameWorld(db, config)
 		go periodicSnapshot(world)
-		loadFromJson()
+		if config.stageIdleEviction > 0 {
+			go reapIdleStages(world)
+		}
 
 		// Game Fucntionality
 		mux.HandleFunc("/status", world.statusHandler)
@@ -86,23 +110,43 @@ func main() {
 		// REST helper endpoints
 		mux.HandleFunc("/insert", world.postHorribleBypass)
 		mux.HandleFunc("/stats", world.getStats)
+		mux.HandleFunc("/reload", world.postReloadAreas)
+		mux.HandleFunc("/scheduler", world.postScheduler)
+		if config.metricsEnabled {
+			mux.HandleFunc("/metrics", world.metricsHandler)
+		}
+
+		// Admin
+		mux.HandleFunc("/admin", world.adminPageHandler)
+		mux.HandleFunc("/admin/", world.adminHandler)
+		if !config.isHub {
+			mux.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(http.Dir("./assets")))) // For the admin page
+		}
 
 		// Websockets
 		logger.Info().Msg("Initiating Websockets...")
 		mux.HandleFunc("/screen", world.NewSocketConnection)
+		mux.HandleFunc("/replay", world.replayHandler)
+		mux.HandleFunc("/spectate", world.spectateHandler)
 	}
 
+	server := &http.Server{Addr: config.port, Handler: mux}
+	shutdownComplete := make(chan struct{})
+	go shutdownOnSignal(server, world, shutdownComplete)
+
 	logger.Info().Msg("Starting server, listening on port " + config.port)
 	var err error
 	if config.usesTLS {
-		err = http.ListenAndServeTLS(config.port, config.tlsCertPath, config.tlsKeyPath, mux)
+		err = server.ListenAndServeTLS(config.tlsCertPath, config.tlsKeyPath)
 	} else {
-		err = http.ListenAndServe(config.port, mux)
+		err = server.ListenAndServe()
 	}
-	if err != nil {
+	if !errors.Is(err, http.ErrServerClosed) {
 		logger.Error().Err(err).Msg("Failed to start server")
 		return
 	}
+	<-shutdownComplete
+	logger.Info().Msg("Shutdown complete")
 }
 
 ///////////////////////////////////////////////////////
@@ -38,6 +38,7 @@ var pauseMenu = Menu{
 	Links: []MenuLink{
 		{Text: "Resume", eventHandler: turnMenuOff, auth: nil},
 		{Text: "You", eventHandler: openStatsMenu, auth: nil},
+		{Text: "Shop", eventHandler: openShopMenu, auth: excludeSpecialStages},
 		{Text: "Map", eventHandler: openMapMenu, auth: nil},
 		{Text: "Respawn", eventHandler: openRespawnMenu, auth: excludeSpecialStages},
 		{Text: "Quit", eventHandler: Quit, auth: nil},
@@ -58,6 +59,7 @@ var statsMenu = Menu{
 	InfoHtml: `<h2>Stat population error.</h2>`,
 	Links: []MenuLink{
 		{Text: "Accomplishments", eventHandler: openAccomplishmentsMenu, auth: nil},
+		{Text: "Wardrobe", eventHandler: openWardrobeMenu, auth: nil},
 		{Text: "Back", eventHandler: openPauseMenu, auth: nil},
 		{Text: "Close", eventHandler: turnMenuOff, auth: nil},
 	},
@@ -126,7 +128,7 @@ func sendMenu(p *Player, menu Menu) {
 		logger.Error().Err(err).Msg("sendMenu Error")
 	}
 	buf.WriteString(divInputDisabled())
-	p.updates <- buf.Bytes()
+	p.updates <- p.render(buf.String(), menuEvent(menu))
 }
 
 /////////////////////////////////////////////////////
@@ -152,7 +154,7 @@ func (m *Menu) attemptClick(p *Player, e PlayerSocketEvent) {
 func menuUp(p *Player, event PlayerSocketEvent) {
 	menu, ok := p.getMenu(event.MenuName)
 	if ok {
-		updateOne(menu.menuSelectUp(event.Arg0), p)
+		p.updates <- p.render(menu.menuSelectUp(event.Arg0), menu.selectEvent(event.Arg0, -1)...)
 	}
 }
 
@@ -170,7 +172,7 @@ func (menu *Menu) menuSelectUp(index string) string {
 func menuDown(p *Player, event PlayerSocketEvent) {
 	menu, ok := p.getMenu(event.MenuName)
 	if ok {
-		updateOne(menu.menuSelectDown(event.Arg0), p)
+		p.updates <- p.render(menu.menuSelectDown(event.Arg0), menu.selectEvent(event.Arg0, 1)...)
 	}
 }
 
@@ -185,6 +187,15 @@ func (menu *Menu) menuSelectDown(index string) string {
 	return menu.unselectedLinkAt(i) + menu.selectedLinkAt(i+1)
 }
 
+// Events only, a selection which could not be made is a no-op
+func (menu *Menu) selectEvent(index string, offset int) []any {
+	i, err := strconv.Atoi(index)
+	if err != nil || len(menu.Links) <= 1 {
+		return nil
+	}
+	return []any{MenuEvent{Type: "menu-select", Name: menu.Name, Selected: mod(i+offset, len(menu.Links))}}
+}
+
 // view updates
 func (m *Menu) selectedLinkAt(i int) string {
 	index := mod(i, len(m.Links))
@@ -211,7 +222,7 @@ func turnMenuOff(p *Player) {
 	var buffer bytes.Buffer
 	buffer.Write([]byte(divModalDisabled()))
 	tmpl.ExecuteTemplate(&buffer, "input", nil)
-	sendUpdate(p, buffer.Bytes())
+	sendUpdate(p, p.render(buffer.String(), MenuEvent{Type: "menu-close"}))
 }
 func turnMenuOffAnd(f func(*Player)) func(*Player) {
 	return func(p *Player) {
@@ -221,7 +232,8 @@ func turnMenuOffAnd(f func(*Player)) func(*Player) {
 }
 
 func Quit(p *Player) {
-	sendUpdate(p, divLogOutResume("Log out success!", p.world.config.domainName))
+	sendUpdate(p, divLogOutResume(p, "Log out success!"))
+	p.quitting.Store(true)
 	p.closeConnectionSync() // This will initiate log out
 }
 
@@ -241,7 +253,7 @@ func openMapMenu(p *Player) {
 		logger.Error().Err(err).Msg("Map Menu Error")
 	}
 
-	p.updates <- buf.Bytes()
+	p.updates <- p.render(buf.String(), menuEvent(copy))
 }
 
 func openPauseMenu(p *Player) {
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Seconds
+var dbLatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// Process wide so that code without a world, e.g. cameras and the database, can be instrumented
+var metrics = createMetrics()
+
+type Metrics struct {
+	eventsInFlight    atomic.Int64 // Sum of every tile's eventsInFlight
+	bufferWipes       atomic.Int64 // Update buffers discarded by sendUpdates
+	timeoutViolations atomic.Int64
+	backlogDrops      atomic.Int64 // Updates routed to a camera backlog
+	backlogResyncs    atomic.Int64
+	logoutQueue       atomic.Int64 // Players waiting on playersToLogout
+	dbLatency         *HistogramVec
+}
+
+type Histogram struct {
+	sync.Mutex
+	buckets []float64 // Upper bounds, ascending
+	counts  []uint64  // Not cumulative, one per bucket plus +Inf
+	sum     float64
+	count   uint64
+}
+
+type HistogramVec struct {
+	sync.Mutex
+	buckets []float64
+	byLabel map[string]*Histogram
+}
+
+func createMetrics() *Metrics {
+	return &Metrics{dbLatency: createHistogramVec(dbLatencyBuckets)}
+}
+
+////////////////////////////////////////////////////////////
+// Histograms
+
+func createHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+}
+
+func (histogram *Histogram) observe(value float64) {
+	i := sort.SearchFloat64s(histogram.buckets, value) // First bound >= value
+	histogram.Lock()
+	defer histogram.Unlock()
+	histogram.counts[i]++
+	histogram.sum += value
+	histogram.count++
+}
+
+func createHistogramVec(buckets []float64) *HistogramVec {
+	return &HistogramVec{buckets: buckets, byLabel: make(map[string]*Histogram)}
+}
+
+func (vec *HistogramVec) with(label string) *Histogram {
+	vec.Lock()
+	defer vec.Unlock()
+	histogram, ok := vec.byLabel[label]
+	if !ok {
+		histogram = createHistogram(vec.buckets)
+		vec.byLabel[label] = histogram
+	}
+	return histogram
+}
+
+// Deferred at the top of each database call: defer observeDbCall("name", time.Now())
+func observeDbCall(call string, start time.Time) {
+	metrics.dbLatency.with(call).observe(time.Since(start).Seconds())
+}
+
+////////////////////////////////////////////////////////////
+// Exposition
+
+func (world *World) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	io.WriteString(w, world.renderMetrics())
+}
+
+func (world *World) renderMetrics() string {
+	var out strings.Builder
+
+	teamCounts := CopyTeamQuantities(world)
+	writeGaugeVec(&out, "bloop_players", "Players in the world by team.", "team", intsToFloats(teamCounts))
+	stageCounts := make(map[string]int)
+	for _, player := range world.copyOfPlayers() {
+		if tile := player.getTileSync(); tile != nil && tile.stage != nil {
+			stageCounts[tile.stage.name]++
+		}
+	}
+	writeGaugeVec(&out, "bloop_stage_players", "Players by stage.", "stage", intsToFloats(stageCounts))
+
+	world.wStageMutex.Lock()
+	loaded := len(world.worldStages)
+	world.wStageMutex.Unlock()
+	writeMetric(&out, "bloop_stages_loaded", "gauge", "Shared stages in memory.", float64(loaded))
+
+	world.incomingPlayerMutex.Lock()
+	pendingLogins := len(world.incomingPlayers)
+	world.incomingPlayerMutex.Unlock()
+	writeMetric(&out, "bloop_login_tokens_pending", "gauge", "Login tokens issued by /play and not yet used by /screen.", float64(pendingLogins))
+	writeMetric(&out, "bloop_logout_queue_depth", "gauge", "Players waiting to complete logout.", float64(metrics.logoutQueue.Load()))
+	writeMetric(&out, "bloop_logins_total", "counter", "Logins this session.", float64(world.sessionStats.TotalSessionLogins.Load()))
+	writeMetric(&out, "bloop_logouts_total", "counter", "Logouts this session.", float64(world.sessionStats.TotalSessionLogouts.Load()))
+
+	writeMetric(&out, "bloop_events_in_flight", "gauge", "Tile effects waiting to be cleared.", float64(metrics.eventsInFlight.Load()))
+	writeMetric(&out, "bloop_update_bytes_total", "counter", "Bytes of updates written to websockets, before compression.", float64(world.bandwidth.written.Load()))
+	writeMetric(&out, "bloop_update_bytes_coalesced_total", "counter", "Bytes of updates removed by coalescing.", float64(world.bandwidth.coalesced.Load()))
+	writeMetric(&out, "bloop_update_buffer_wipes_total", "counter", "Update buffers discarded for exceeding their limit.", float64(metrics.bufferWipes.Load()))
+	writeMetric(&out, "bloop_session_timeout_violations_total", "counter", "Failed websocket writes.", float64(metrics.timeoutViolations.Load()))
+	writeMetric(&out, "bloop_camera_backlog_updates_total", "counter", "Updates diverted to a camera backlog.", float64(metrics.backlogDrops.Load()))
+	writeMetric(&out, "bloop_camera_resyncs_total", "counter", "Cameras that fell far enough behind to need a resync.", float64(metrics.backlogResyncs.Load()))
+
+	writeHistogramVec(&out, "bloop_db_call_duration_seconds", "Database call latency.", "call", metrics.dbLatency)
+	return out.String()
+}
+
+func writeHeader(out *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeMetric(out *strings.Builder, name, kind, help string, value float64) {
+	writeHeader(out, name, kind, help)
+	fmt.Fprintf(out, "%s %s\n", name, formatMetricValue(value))
+}
+
+func writeGaugeVec(out *strings.Builder, name, help, label string, values map[string]float64) {
+	writeHeader(out, name, "gauge", help)
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(out, "%s{%s=%s} %s\n", name, label, quoteLabel(key), formatMetricValue(values[key]))
+	}
+}
+
+func writeHistogramVec(out *strings.Builder, name, help, label string, vec *HistogramVec) {
+	writeHeader(out, name, "histogram", help)
+	vec.Lock()
+	byLabel := make(map[string]*Histogram, len(vec.byLabel))
+	for key, histogram := range vec.byLabel {
+		byLabel[key] = histogram
+	}
+	vec.Unlock()
+
+	for _, key := range sortedKeys(byLabel) {
+		histogram := byLabel[key]
+		value := quoteLabel(key)
+		histogram.Lock()
+		cumulative := uint64(0)
+		for i, bound := range histogram.buckets {
+			cumulative += histogram.counts[i]
+			fmt.Fprintf(out, "%s_bucket{%s=%s,le=%q} %d\n", name, label, value, formatMetricValue(bound), cumulative)
+		}
+		fmt.Fprintf(out, "%s_bucket{%s=%s,le=\"+Inf\"} %d\n", name, label, value, histogram.count)
+		fmt.Fprintf(out, "%s_sum{%s=%s} %s\n", name, label, value, formatMetricValue(histogram.sum))
+		fmt.Fprintf(out, "%s_count{%s=%s} %d\n", name, label, value, histogram.count)
+		histogram.Unlock()
+	}
+}
+
+func formatMetricValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Quoted, with the only three escapes the text format allows
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+func intsToFloats(values map[string]int) map[string]float64 {
+	out := make(map[string]float64, len(values))
+	for key, value := range values {
+		out[key] = float64(value)
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHistogramBucketsAreCumulative(t *testing.T) {
+	vec := createHistogramVec([]float64{0.1, 1})
+	vec.with("find").observe(0.05)
+	vec.with("find").observe(0.5)
+	vec.with("find").observe(5)
+
+	var out strings.Builder
+	writeHistogramVec(&out, "latency", "help", "call", vec)
+	for _, line := range []string{
+		`latency_bucket{call="find",le="0.1"} 1`,
+		`latency_bucket{call="find",le="1"} 2`,
+		`latency_bucket{call="find",le="+Inf"} 3`,
+		`latency_sum{call="find"} 5.55`,
+		`latency_count{call="find"} 3`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("missing %s in:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestLabelsAreEscaped(t *testing.T) {
+	if quoted := quoteLabel("a\"b\\c\nd"); quoted != `"a\"b\\c\nd"` {
+		t.Errorf("unexpected label %s", quoted)
+	}
+}
+
+func TestMetricsReportPlayersByTeamAndStage(t *testing.T) {
+	world := createChatTestingWorld(t)
+	joinChatTestingPlayer(t, world, "measured", "fuchsia", "test-chat", 0)
+
+	w := httptest.NewRecorder()
+	world.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE bloop_players gauge",
+		`bloop_players{team="fuchsia"} 1`,
+		`bloop_stage_players{stage="test-chat"} 1`,
+		"bloop_logins_total ",
+		"# TYPE bloop_db_call_duration_seconds histogram",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("missing %s", line)
+		}
+	}
+}
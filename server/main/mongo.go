@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -42,6 +44,11 @@ type PlayerRecord struct {
 
 	// Unlocks
 	Accomplishments map[string]Accomplishment `bson:"accomplishments,omitempty"`
+	Inventory       InventoryRecord           `bson:"inventory"`
+
+	// Linking
+	LinkingTo    string   `bson:"linkingTo,omitempty"`    // Identifier of the user a guest is being merged into
+	MergedGuests []string `bson:"mergedGuests,omitempty"` // So that a retried link does not count a guest twice
 }
 
 type PlayerStatsRecord struct {
@@ -54,6 +61,12 @@ type PlayerStatsRecord struct {
 	PeakWealth     int64 `bson:"peakWealth,omitempty"`
 }
 
+const (
+	EVENT_KILL     = "Kill"
+	EVENT_SCORE    = "Score"
+	EVENT_PURCHASE = "Purchase"
+)
+
 type EventRecord struct {
 	Owner     string    `bson:"owner"`
 	Secondary string    `bson:"secondary"`
@@ -62,19 +75,34 @@ type EventRecord struct {
 	StageName string    `bson:"stagename,omitempty"`
 	X         int       `bson:"x,omitempty"`
 	Y         int       `bson:"y,omitempty"`
-	Details   string    `bson:"details,omitempty"` // Could be interface, no purpose
+	Details   string    `bson:"details,omitempty"`          // Could be interface, no purpose
+	Amount    int64     `bson:"amount,omitempty"`           // Price of a purchase
+	Team      string    `bson:"team,omitempty"`             // Of the owner when the event happened
+	Npc       bool      `bson:"npc,omitempty"`              // Owner is not a player, whatever its team
+	Expired   bool      `bson:"expired,omitempty" json:"-"` // Marked by retention to be rolled up and removed
 }
 
 type SessionDataRecord struct {
-	ServerName             string              `bson:"serverName"`
-	Timestamp              time.Time           `bson:"timestamp"`
-	SessionStartTime       time.Time           `bson:"sessionStartTime"`
-	PeakSessionPlayerCount int                 `bson:"peakSessionPlayerCount"`
-	PeakSessionKillStreak  SessionStreakRecord `bson:"peakSessionKillStreak"`
-	TotalSessionLogins     int                 `bson:"totalSessionLogins"`
-	TotalSessionLogouts    int                 `bson:"totalSessionLogouts"`
-	CurrentTeamPlayerCount map[string]int      `bson:"currentTeamPlayerCount"`
-	Scoreboard             map[string]int      `bson:"scoreboard"`
+	ServerName             string                    `bson:"serverName"`
+	Timestamp              time.Time                 `bson:"timestamp"`
+	SessionStartTime       time.Time                 `bson:"sessionStartTime"`
+	PeakSessionPlayerCount int                       `bson:"peakSessionPlayerCount"`
+	PeakSessionKillStreak  SessionStreakRecord       `bson:"peakSessionKillStreak"`
+	TotalSessionLogins     int                       `bson:"totalSessionLogins"`
+	TotalSessionLogouts    int                       `bson:"totalSessionLogouts"`
+	CurrentTeamPlayerCount map[string]int            `bson:"currentTeamPlayerCount"`
+	Scoreboard             map[string]int            `bson:"scoreboard"` // Active game mode
+	GameMode               string                    `bson:"gameMode,omitempty"`
+	ModeScoreboards        map[string]map[string]int `bson:"modeScoreboards,omitempty"`
+}
+
+// Keyed by server and world stage key
+type StageSnapshotRecord struct {
+	ServerName string        `bson:"serverName"`
+	Key        string        `bson:"key"`
+	Timestamp  time.Time     `bson:"timestamp"`
+	AreaHash   string        `bson:"areaHash"`
+	Snapshot   StageSnapshot `bson:"snapshot"`
 }
 
 type SessionStreakRecord struct {
@@ -86,6 +114,7 @@ type SessionStreakRecord struct {
 // User Record
 
 func (db *DB) getAuthorizedUserById(identifier string) *UserRecord {
+	defer observeDbCall("getAuthorizedUserById", time.Now())
 	var result UserRecord
 	collection := db.users
 	err := collection.FindOne(context.TODO(), bson.M{"identifier": bson.M{"$eq": identifier}}).Decode(&result)
@@ -101,11 +130,13 @@ func (db *DB) getAuthorizedUserById(identifier string) *UserRecord {
 }
 
 func (db *DB) insertAuthorizedUser(user UserRecord) error {
+	defer observeDbCall("insertAuthorizedUser", time.Now())
 	_, err := db.users.InsertOne(context.TODO(), user)
 	return err
 }
 
 func (db *DB) updateUsernameForUserWithId(identifier, username string) bool {
+	defer observeDbCall("updateUsernameForUserWithId", time.Now())
 	filter := bson.M{"identifier": bson.M{"$eq": identifier}, "username": ""}
 	update := bson.M{"$set": bson.M{"username": username}}
 
@@ -129,10 +160,152 @@ func (db *DB) updateUsernameForUserWithId(identifier, username string) bool {
 	return true
 }
 
+// Works without transactions, standalone servers included. The guest is claimed for the user
+// first, so a link that fails half way is finished by retrying and no one else can take the guest
+// meanwhile. Each step can be repeated: the player keeps the names of the guests merged into it.
+func (db *DB) linkGuestToUser(identifier, guest, username string) (string, error) {
+	defer observeDbCall("linkGuestToUser", time.Now())
+	ctx := context.TODO()
+	var user UserRecord
+	if err := db.users.FindOne(ctx, bson.M{"identifier": identifier}).Decode(&user); err != nil {
+		return "", notFoundAsRecordError(err)
+	}
+	guestRecord, err := db.claimGuest(ctx, identifier, guest)
+	if err != nil {
+		return "", err
+	}
+
+	if playerOnline(guestRecord) {
+		err = errPlayerOnline
+	} else if user.Username == "" {
+		if err = db.adoptGuest(ctx, guestRecord, username); err == nil {
+			err = db.setUsernameForLink(ctx, identifier, username)
+			user.Username = username
+		}
+	} else {
+		err = db.mergeGuest(ctx, guestRecord, user.Username)
+	}
+	if errors.Is(err, errPlayerOnline) || errors.Is(err, errUsernameTaken) {
+		db.releaseGuest(ctx, identifier, guest) // Nothing was written, the guest may be played again
+		return "", err
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := db.playerRecords.DeleteOne(ctx, bson.M{"username": guest, "linkingTo": identifier}); err != nil {
+		return "", err
+	}
+	return user.Username, nil
+}
+
+// Succeeds again for the same user, so that an unfinished link can be retried
+func (db *DB) claimGuest(ctx context.Context, identifier, guest string) (PlayerRecord, error) {
+	var record PlayerRecord
+	if !idBelongsToGuest(guest) {
+		return record, errNotAGuest
+	}
+	filter := bson.M{
+		"username":        guest,
+		"guestCreateTime": bson.M{"$exists": true},
+		"linkingTo":       bson.M{"$in": bson.A{nil, identifier}},
+	}
+	update := bson.M{"$set": bson.M{"linkingTo": identifier}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := db.playerRecords.FindOneAndUpdate(ctx, filter, update, opts).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		var existing PlayerRecord
+		if db.playerRecords.FindOne(ctx, bson.M{"username": guest}).Decode(&existing) == nil && existing.GuestCreateTime == nil {
+			return record, errNotAGuest
+		}
+		return record, errRecordNotFound // Or claimed by another user
+	}
+	return record, err
+}
+
+func (db *DB) releaseGuest(ctx context.Context, identifier, guest string) {
+	_, err := db.playerRecords.UpdateOne(ctx, bson.M{"username": guest, "linkingTo": identifier}, bson.M{"$unset": bson.M{"linkingTo": ""}})
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to release guest " + guest)
+	}
+}
+
+// A retry finds the adopted player already in place
+func (db *DB) adoptGuest(ctx context.Context, guest PlayerRecord, username string) error {
+	var existing PlayerRecord
+	err := db.playerRecords.FindOne(ctx, bson.M{"username": username}).Decode(&existing)
+	if err == nil {
+		if slices.Contains(existing.MergedGuests, guest.Username) {
+			return nil
+		}
+		return errUsernameTaken
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+	_, err = db.playerRecords.InsertOne(ctx, adoptGuestRecord(guest, username))
+	if mongo.IsDuplicateKeyError(err) {
+		return errUsernameTaken
+	}
+	return err
+}
+
+func (db *DB) setUsernameForLink(ctx context.Context, identifier, username string) error {
+	filter := bson.M{"identifier": identifier, "username": bson.M{"$in": bson.A{"", username}}}
+	result, err := db.users.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"username": username}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("user %s already has a username", identifier)
+	}
+	return nil
+}
+
+// The player is replaced only if no one has logged in or merged this guest since it was read
+func (db *DB) mergeGuest(ctx context.Context, guest PlayerRecord, username string) error {
+	var target PlayerRecord
+	if err := db.playerRecords.FindOne(ctx, bson.M{"username": username}).Decode(&target); err != nil {
+		return notFoundAsRecordError(err)
+	}
+	if slices.Contains(target.MergedGuests, guest.Username) {
+		return nil
+	}
+	if playerOnline(target) {
+		return errPlayerOnline
+	}
+	filter := bson.M{"username": username, "lastLogin": unchangedTime(target.LastLogin), "mergedGuests": bson.M{"$ne": guest.Username}}
+	mergeGuestRecord(&target, guest)
+	result, err := db.playerRecords.ReplaceOne(ctx, filter, target)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("player %s changed while merging %s", username, guest.Username)
+	}
+	return nil
+}
+
+// Zero times are omitted from records
+func unchangedTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return bson.M{"$exists": false}
+	}
+	return t
+}
+
+func notFoundAsRecordError(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return errRecordNotFound
+	}
+	return err
+}
+
 /////////////////////////////////////////////////////////////
 //  Player Record
 
 func (db *DB) InsertPlayerRecord(player PlayerRecord) error {
+	defer observeDbCall("InsertPlayerRecord", time.Now())
 	_, err := db.playerRecords.InsertOne(context.TODO(), player)
 	if err != nil {
 		return err
@@ -141,6 +314,7 @@ func (db *DB) InsertPlayerRecord(player PlayerRecord) error {
 }
 
 func (db *DB) getPlayerRecord(username string) (PlayerRecord, error) {
+	defer observeDbCall("getPlayerRecord", time.Now())
 	collection := db.playerRecords
 	var result PlayerRecord
 	err := collection.FindOne(context.TODO(), bson.M{"username": bson.M{"$eq": username}}).Decode(&result)
@@ -161,6 +335,7 @@ func (db *DB) foundUsername(username string) bool {
 }
 
 func (db *DB) updateRecordForPlayer(p *Player, pTile *Tile) error {
+	defer observeDbCall("updateRecordForPlayer", time.Now())
 	_, err := db.playerRecords.UpdateOne(
 		context.TODO(),
 		bson.M{"username": bson.M{"$eq": p.username}},
@@ -172,6 +347,7 @@ func (db *DB) updateRecordForPlayer(p *Player, pTile *Tile) error {
 }
 
 func (db *DB) updateLoginForPlayer(p *Player) error {
+	defer observeDbCall("updateLoginForPlayer", time.Now())
 	_, err := db.playerRecords.UpdateOne(
 		context.TODO(),
 		bson.M{"username": bson.M{"$eq": p.username}},
@@ -185,6 +361,7 @@ func (db *DB) updateLoginForPlayer(p *Player) error {
 }
 
 func (db *DB) updatePlayerRecordOnLogout(p *Player, pTile *Tile) error {
+	defer observeDbCall("updatePlayerRecordOnLogout", time.Now())
 	snapshot := createPlayerSnapShot(p, pTile)
 	snapshot["lastLogout"] = time.Now()
 	_, err := db.playerRecords.UpdateOne(
@@ -197,7 +374,22 @@ func (db *DB) updatePlayerRecordOnLogout(p *Player, pTile *Tile) error {
 	return err
 }
 
+func (db *DB) updateTeamForPlayer(username, team string) error {
+	defer observeDbCall("updateTeamForPlayer", time.Now())
+	_, err := db.playerRecords.UpdateOne(
+		context.TODO(),
+		bson.M{"username": username},
+		bson.M{
+			"$set": bson.M{
+				"team": team,
+			},
+		},
+	)
+	return err
+}
+
 func (db *DB) addAccomplishmentToPlayer(username string, key string, value Accomplishment) error {
+	defer observeDbCall("addAccomplishmentToPlayer", time.Now())
 	_, err := db.playerRecords.UpdateOne(
 		context.TODO(),
 		bson.M{"username": username},
@@ -210,6 +402,16 @@ func (db *DB) addAccomplishmentToPlayer(username string, key string, value Accom
 	return err
 }
 
+func (db *DB) updateInventoryForPlayer(username string, inventory InventoryRecord) error {
+	defer observeDbCall("updateInventoryForPlayer", time.Now())
+	_, err := db.playerRecords.UpdateOne(
+		context.TODO(),
+		bson.M{"username": username},
+		bson.M{"$set": bson.M{"inventory": inventory}},
+	)
+	return err
+}
+
 func createPlayerSnapShot(p *Player, pTile *Tile) bson.M {
 	return bson.M{
 		"x":         pTile.x,
@@ -218,6 +420,7 @@ func createPlayerSnapShot(p *Player, pTile *Tile) bson.M {
 		"stagename": pTile.stage.name,
 		"money":     p.money.Load(),
 		"stats":     statsRecordFromPlayerStats(&p.PlayerStats),
+		"inventory": p.inventory.record(),
 	}
 }
 
@@ -236,15 +439,19 @@ func statsRecordFromPlayerStats(stats *PlayerStats) PlayerStatsRecord {
 // Event Records
 
 func (db *DB) saveKillEvent(tile *Tile, initiator Character, defeated *Player) error {
+	defer observeDbCall("saveKillEvent", time.Now())
 	eventCollection := db.events
+	_, isPlayer := initiator.(*Player)
 	event := EventRecord{
 		Owner:     initiator.getName(),
 		Secondary: defeated.username,
-		Type:      "Kill",
+		Type:      EVENT_KILL,
 		Created:   time.Now(),
 		StageName: tile.stage.name,
 		X:         tile.x,
 		Y:         tile.y,
+		Team:      initiator.getTeamNameSync(),
+		Npc:       !isPlayer,
 	}
 	_, err := eventCollection.InsertOne(context.TODO(), event)
 	if err != nil {
@@ -255,16 +462,18 @@ func (db *DB) saveKillEvent(tile *Tile, initiator Character, defeated *Player) e
 }
 
 func (db *DB) saveScoreEvent(tile *Tile, initiator *Player, message string) error {
+	defer observeDbCall("saveScoreEvent", time.Now())
 	eventCollection := db.events
 	event := EventRecord{
 		Owner:     initiator.username,
 		Secondary: "",
-		Type:      "Score",
+		Type:      EVENT_SCORE,
 		Created:   time.Now(),
 		StageName: tile.stage.name,
 		X:         tile.x,
 		Y:         tile.y,
 		Details:   message,
+		Team:      initiator.getTeamNameSync(),
 	}
 	_, err := eventCollection.InsertOne(context.TODO(), event)
 	if err != nil {
@@ -274,10 +483,56 @@ func (db *DB) saveScoreEvent(tile *Tile, initiator *Player, message string) erro
 	return nil
 }
 
+func (db *DB) savePurchaseEvent(tile *Tile, buyer *Player, itemId string, price int64) error {
+	defer observeDbCall("savePurchaseEvent", time.Now())
+	event := EventRecord{
+		Owner:     buyer.username,
+		Type:      EVENT_PURCHASE,
+		Created:   time.Now(),
+		StageName: tile.stage.name,
+		X:         tile.x,
+		Y:         tile.y,
+		Details:   itemId,
+		Amount:    price,
+	}
+	_, err := db.events.InsertOne(context.TODO(), event)
+	return err
+}
+
+// Grouped by position, events from [from, to)
+func (db *DB) countEventsByTile(ctx context.Context, stageName, eventType string, from, to time.Time) ([]HeatmapCell, error) {
+	defer observeDbCall("countEventsByTile", time.Now())
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"stagename": stageName,
+			"eventtype": eventType,
+			"created":   bson.M{"$gte": from, "$lt": to},
+		}}},
+		// x and y are omitempty so zero is missing
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"y": bson.M{"$ifNull": bson.A{"$y", 0}}, "x": bson.M{"$ifNull": bson.A{"$x", 0}}},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$project", Value: bson.M{"_id": 0, "y": "$_id.y", "x": "$_id.x", "count": 1}}},
+	}
+	cursor, err := db.events.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	results := make([]HeatmapCell, 0)
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 //////////////////////////////////////////////////////////////////////
 // Highscores
 
 func (db *DB) getTopNPlayersByField(field string, n int) ([]PlayerRecord, error) {
+	defer observeDbCall("getTopNPlayersByField", time.Now())
 	// Should add indexes where needed
 	findOptions := options.Find().
 		SetSort(bson.D{{Key: field, Value: -1}}).
@@ -298,16 +553,101 @@ func (db *DB) getTopNPlayersByField(field string, n int) ([]PlayerRecord, error)
 	return results, nil
 }
 
+// Each event counts once and each rollup by its count, so removing events after they are rolled up changes nothing
+func (db *DB) rankEventsBy(ctx context.Context, eventType, groupBy string, from, to time.Time, n int) ([]RankedCount, error) {
+	if groupBy != RANK_BY_OWNER && groupBy != RANK_BY_TEAM {
+		return nil, fmt.Errorf("unknown grouping: %s", groupBy)
+	}
+	defer observeDbCall("rankEventsBy", time.Now())
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"eventtype": eventType, "npc": bson.M{"$ne": true}, "created": bson.M{"$gte": from, "$lt": to}}}},
+		{{Key: "$project", Value: bson.M{"name": "$" + groupBy, "count": bson.M{"$literal": 1}}}},
+		{{Key: "$unionWith", Value: bson.M{
+			"coll": db.dailyEvents.Name(),
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"eventtype": eventType, "npc": bson.M{"$ne": true}, "day": bson.M{"$gte": rollupDay(from), "$lt": rollupDay(to)}}},
+				bson.M{"$project": bson.M{"name": "$" + groupBy, "count": 1}},
+			},
+		}}},
+		{{Key: "$match", Value: bson.M{"name": bson.M{"$nin": bson.A{nil, ""}}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$name", "count": bson.M{"$sum": "$count"}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: n}},
+		{{Key: "$project", Value: bson.M{"_id": 0, "name": "$_id", "count": 1}}},
+	}
+	cursor, err := db.events.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	results := make([]RankedCount, 0)
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (db *DB) getSeasonStandings(ctx context.Context, season int) (*SeasonStandingsRecord, error) {
+	defer observeDbCall("getSeasonStandings", time.Now())
+	var record SeasonStandingsRecord
+	err := db.seasons.FindOne(ctx, bson.M{"season": season}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (db *DB) saveSeasonStandings(ctx context.Context, record SeasonStandingsRecord) error {
+	defer observeDbCall("saveSeasonStandings", time.Now())
+	_, err := db.seasons.ReplaceOne(ctx, bson.M{"season": record.Season}, record, options.Replace().SetUpsert(true))
+	return err
+}
+
+///////////////////////////////////////////////////////////////////////
+// Bans
+
+func (db *DB) getBans(ctx context.Context) ([]BanRecord, error) {
+	defer observeDbCall("getBans", time.Now())
+	cursor, err := db.bans.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	results := make([]BanRecord, 0)
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (db *DB) saveBan(ctx context.Context, ban BanRecord) error {
+	defer observeDbCall("saveBan", time.Now())
+	_, err := db.bans.ReplaceOne(ctx, bson.M{"username": ban.Username}, ban, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (db *DB) deleteBan(ctx context.Context, username string) error {
+	defer observeDbCall("deleteBan", time.Now())
+	_, err := db.bans.DeleteOne(ctx, bson.M{"username": username})
+	return err
+}
+
 ///////////////////////////////////////////////////////////////////////
 // Game Status Funcs
 
-func getMostRecentSessionData(ctx context.Context, collection *mongo.Collection, serverName string) (*SessionDataRecord, error) {
+func (db *DB) getMostRecentSessionData(ctx context.Context, serverName string) (*SessionDataRecord, error) {
+	defer observeDbCall("getMostRecentSessionData", time.Now())
 	filter := bson.M{"serverName": serverName}
 	// Sort by timestamp in descending order to get the most recent document.
 	findOpts := options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}})
 
 	var result SessionDataRecord
-	err := collection.FindOne(ctx, filter, findOpts).Decode(&result)
+	err := db.sessionData.FindOne(ctx, filter, findOpts).Decode(&result)
 	if err != nil {
 		return nil, err
 	}
@@ -315,7 +655,149 @@ func getMostRecentSessionData(ctx context.Context, collection *mongo.Collection,
 	return &result, nil
 }
 
-func saveGameStatus(ctx context.Context, collection *mongo.Collection, status SessionDataRecord) error {
-	_, err := collection.InsertOne(ctx, status)
+func (db *DB) saveGameStatus(ctx context.Context, status SessionDataRecord) error {
+	defer observeDbCall("saveGameStatus", time.Now())
+	_, err := db.sessionData.InsertOne(ctx, status)
 	return err
 }
+
+///////////////////////////////////////////////////////////////////////
+// Stage Snapshots
+
+func (db *DB) getStageSnapshots(ctx context.Context, serverName string) ([]StageSnapshotRecord, error) {
+	defer observeDbCall("getStageSnapshots", time.Now())
+	cursor, err := db.snapshots.Find(ctx, bson.M{"serverName": serverName})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []StageSnapshotRecord
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (db *DB) upsertStageSnapshot(ctx context.Context, record StageSnapshotRecord) error {
+	defer observeDbCall("upsertStageSnapshot", time.Now())
+	filter := bson.M{"serverName": record.ServerName, "key": record.Key}
+	_, err := db.snapshots.ReplaceOne(ctx, filter, record, options.Replace().SetUpsert(true))
+	return err
+}
+
+///////////////////////////////////////////////////////////////////////
+// Retention
+
+// lastLogin and lastLogout are omitempty so a guest who never played has neither
+func inactiveGuestFilter(before time.Time) bson.M {
+	return bson.M{
+		"guestCreateTime": bson.M{"$ne": nil, "$lt": before},
+		"$and": bson.A{
+			bson.M{"$or": bson.A{bson.M{"lastLogin": bson.M{"$exists": false}}, bson.M{"lastLogin": bson.M{"$lt": before}}}},
+			bson.M{"$or": bson.A{bson.M{"lastLogout": bson.M{"$exists": false}}, bson.M{"lastLogout": bson.M{"$lt": before}}}},
+		},
+	}
+}
+
+func (db *DB) countInactiveGuests(ctx context.Context, before time.Time) (int64, error) {
+	defer observeDbCall("countInactiveGuests", time.Now())
+	return db.playerRecords.CountDocuments(ctx, inactiveGuestFilter(before))
+}
+
+func (db *DB) deleteInactiveGuests(ctx context.Context, before time.Time) (int64, error) {
+	defer observeDbCall("deleteInactiveGuests", time.Now())
+	result, err := db.playerRecords.DeleteMany(ctx, inactiveGuestFilter(before))
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (db *DB) rollupEventsBefore(ctx context.Context, before time.Time) ([]DailyEventRecord, error) {
+	defer observeDbCall("rollupEventsBefore", time.Now())
+	return db.rollupEvents(ctx, bson.M{"created": bson.M{"$lt": before}})
+}
+
+func (db *DB) expireEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	defer observeDbCall("expireEventsBefore", time.Now())
+	result, err := db.events.UpdateMany(ctx, bson.M{"created": bson.M{"$lt": before}}, bson.M{"$set": bson.M{"expired": true}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (db *DB) rollupExpiredEvents(ctx context.Context) ([]DailyEventRecord, error) {
+	defer observeDbCall("rollupExpiredEvents", time.Now())
+	return db.rollupEvents(ctx, bson.M{"expired": true})
+}
+
+func (db *DB) rollupEvents(ctx context.Context, match bson.M) ([]DailyEventRecord, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"day":       bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$created", "timezone": "UTC"}},
+				"eventtype": "$eventtype",
+				"owner":     "$owner",
+				"stagename": bson.M{"$ifNull": bson.A{"$stagename", ""}},
+				"team":      bson.M{"$ifNull": bson.A{"$team", ""}},
+				"npc":       bson.M{"$ifNull": bson.A{"$npc", false}},
+			},
+			"count":  bson.M{"$sum": 1},
+			"amount": bson.M{"$sum": bson.M{"$ifNull": bson.A{"$amount", 0}}},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":       0,
+			"day":       "$_id.day",
+			"eventtype": "$_id.eventtype",
+			"owner":     "$_id.owner",
+			"stagename": "$_id.stagename",
+			"team":      "$_id.team",
+			"npc":       "$_id.npc",
+			"count":     1,
+			"amount":    1,
+		}}},
+	}
+	cursor, err := db.events.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	results := make([]DailyEventRecord, 0)
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (db *DB) saveDailyEvents(ctx context.Context, records []DailyEventRecord) error {
+	defer observeDbCall("saveDailyEvents", time.Now())
+	if len(records) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, 0, len(records))
+	for _, record := range records {
+		filter := bson.M{"day": record.Day, "eventtype": record.Type, "owner": record.Owner, "stagename": record.StageName, "team": record.Team, "npc": bson.M{"$ne": true}}
+		if record.Npc {
+			filter["npc"] = true
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(filter).
+			SetUpdate(bson.M{"$inc": bson.M{"count": record.Count, "amount": record.Amount}}).
+			SetUpsert(true))
+	}
+	_, err := db.dailyEvents.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (db *DB) deleteExpiredEvents(ctx context.Context) (int64, error) {
+	defer observeDbCall("deleteExpiredEvents", time.Now())
+	result, err := db.events.DeleteMany(ctx, bson.M{"expired": true})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
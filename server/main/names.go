@@ -137,7 +137,7 @@ func generateRandomName() string {
 	return honorifics[a] + adjectives[b] + "Bloop"
 }
 
-func (db *DB) UniqueName() string {
+func uniqueName(db PlayerStore) string {
 	base := generateRandomName()
 	for i := 0; i < len(numerals); i++ {
 		candidate := base + numerals[i]
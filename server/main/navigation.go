@@ -0,0 +1,239 @@
+package main
+
+const NAVIGATION_SEARCH_LIMIT = 600 // Tiles visited per search
+const FLEE_HEALTH = 30
+const ATTACK_DISTANCE = 3
+
+// Either an offset onto a neighboring tile or a teleport from the current one
+type PathStep struct {
+	tile       *Tile
+	yOff, xOff int
+	teleport   *Teleport
+	from       *Tile
+}
+
+type Waypoint struct {
+	stagename string
+	y, x      int
+}
+
+var cardinalOffsets = [4][2]int{{-1, 0}, {1, 0}, {0, 1}, {0, -1}}
+
+////////////////////////////////////////////////////////////
+// Graph
+
+// Only loaded world stages are searched, navigation never creates a stage. Team stages are
+// registered as stagename:team, see fetchStageSync.
+func (world *World) loadedStage(stagename, team string) *Stage {
+	world.wStageMutex.Lock()
+	defer world.wStageMutex.Unlock()
+	if stage, ok := world.worldStages[stagename]; ok {
+		return stage
+	}
+	return world.worldStages[stagename+":"+team]
+}
+
+// Stages as found by a member of team
+func (world *World) loadedStagesFor(team string) func(stagename string) *Stage {
+	return func(stagename string) *Stage {
+		return world.loadedStage(stagename, team)
+	}
+}
+
+// Standing on a teleport leads only to its destination
+func neighborSteps(tile *Tile, fetch func(stagename string) *Stage) []PathStep {
+	if tile.teleport != nil {
+		stage := fetch(tile.teleport.destStage)
+		if !validCoordinate(tile.teleport.destY, tile.teleport.destX, stage) {
+			return nil
+		}
+		dest := stage.tiles[tile.teleport.destY][tile.teleport.destX]
+		if !walkable(dest) {
+			return nil
+		}
+		return []PathStep{{tile: dest, teleport: tile.teleport}}
+	}
+	out := make([]PathStep, 0, len(cardinalOffsets))
+	for _, offset := range cardinalOffsets {
+		next := relativeTileVia(tile, offset[0], offset[1], fetch)
+		if walkable(next) {
+			out = append(out, PathStep{tile: next, yOff: offset[0], xOff: offset[1]})
+		}
+	}
+	return out
+}
+
+////////////////////////////////////////////////////////////
+// Search
+
+// Breadth first, steps are of equal cost. Nil if no goal is within the search limit.
+func findPath(start *Tile, fetch func(stagename string) *Stage, goal func(*Tile) bool) []PathStep {
+	if start == nil {
+		return nil
+	}
+	if goal(start) {
+		return []PathStep{}
+	}
+	previous := map[*Tile]PathStep{start: {}}
+	queue := []*Tile{start}
+	for len(queue) > 0 && len(previous) < NAVIGATION_SEARCH_LIMIT {
+		current := queue[0]
+		queue = queue[1:]
+		for _, step := range neighborSteps(current, fetch) {
+			if _, seen := previous[step.tile]; seen {
+				continue
+			}
+			step.from = current
+			previous[step.tile] = step
+			if goal(step.tile) {
+				return walkBack(previous, start, step.tile)
+			}
+			queue = append(queue, step.tile)
+		}
+	}
+	return nil
+}
+
+func walkBack(previous map[*Tile]PathStep, start, end *Tile) []PathStep {
+	out := make([]PathStep, 0)
+	for tile := end; tile != start; tile = previous[tile].from {
+		out = append(out, previous[tile])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// Steps from the nearest source, up to the search limit
+func distancesFrom(sources []*Tile, fetch func(stagename string) *Stage) map[*Tile]int {
+	out := make(map[*Tile]int)
+	queue := make([]*Tile, 0, len(sources))
+	for _, source := range sources {
+		out[source] = 0
+		queue = append(queue, source)
+	}
+	for len(queue) > 0 && len(out) < NAVIGATION_SEARCH_LIMIT {
+		current := queue[0]
+		queue = queue[1:]
+		for _, step := range neighborSteps(current, fetch) {
+			if _, seen := out[step.tile]; seen {
+				continue
+			}
+			out[step.tile] = out[current] + 1
+			queue = append(queue, step.tile)
+		}
+	}
+	return out
+}
+
+func pathToTile(start, dest *Tile, fetch func(stagename string) *Stage) []PathStep {
+	return findPath(start, fetch, func(tile *Tile) bool { return tile == dest })
+}
+
+func pathToNearestEnemy(npc *NonPlayer) []PathStep {
+	return findPath(npc.getTileSync(), npcStages(npc), func(tile *Tile) bool { return hasEnemyOf(npc, tile) })
+}
+
+func npcStages(npc *NonPlayer) func(stagename string) *Stage {
+	return npc.world.loadedStagesFor(npc.getTeamNameSync())
+}
+
+func hasEnemyOf(npc *NonPlayer, tile *Tile) bool {
+	team := npc.getTeamNameSync()
+	tile.CharacterMutex.Lock()
+	defer tile.CharacterMutex.Unlock()
+	for _, character := range tile.characterMap {
+		if character.getTeamNameSync() != team {
+			return true
+		}
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////
+// Movement
+
+func takeStep(npc *NonPlayer, step PathStep) {
+	if step.teleport != nil {
+		applyTeleport(npc, step.teleport)
+		return
+	}
+	move(npc, step.yOff, step.xOff)
+}
+
+// Chases the nearest enemy, attacking once close - Flees when low on health, wanders when alone
+func huntNearestEnemy(shapes [][][2]int) func(*NonPlayer) {
+	return func(npc *NonPlayer) {
+		if npc.health.Load() < FLEE_HEALTH {
+			fleeFromEnemies(npc)
+			return
+		}
+		path := pathToNearestEnemy(npc)
+		if path == nil {
+			moveRandomly(npc)
+			return
+		}
+		if len(path) <= ATTACK_DISTANCE && npc.rng.Intn(4) == 0 {
+			activatePower(npc, shapes)
+			return
+		}
+		if len(path) > 1 {
+			takeStep(npc, path[0])
+		}
+	}
+}
+
+// Steps onto the neighbor furthest from every enemy in range
+func fleeFromEnemies(npc *NonPlayer) {
+	current := npc.getTileSync()
+	if current == nil {
+		return
+	}
+	stages := npcStages(npc)
+	enemies := make([]*Tile, 0)
+	for tile := range distancesFrom([]*Tile{current}, stages) {
+		if hasEnemyOf(npc, tile) {
+			enemies = append(enemies, tile)
+		}
+	}
+	if len(enemies) == 0 {
+		return
+	}
+	distances := distancesFrom(enemies, stages)
+	best, bestDistance := PathStep{}, distances[current]
+	for _, step := range neighborSteps(current, stages) {
+		distance, found := distances[step.tile]
+		if !found {
+			distance = NAVIGATION_SEARCH_LIMIT // Out of range is as far as can be
+		}
+		if distance > bestDistance {
+			best, bestDistance = step, distance
+		}
+	}
+	if best.tile != nil {
+		takeStep(npc, best)
+	}
+}
+
+// Visits each waypoint in turn, skipping any that cannot be reached. One per npc.
+func patrolWaypoints(waypoints []Waypoint) func(*NonPlayer) {
+	next := 0
+	return func(npc *NonPlayer) {
+		if len(waypoints) == 0 {
+			return
+		}
+		waypoint := waypoints[next]
+		stage := npc.world.loadedStage(waypoint.stagename, npc.getTeamNameSync())
+		if !validCoordinate(waypoint.y, waypoint.x, stage) {
+			next = (next + 1) % len(waypoints)
+			return
+		}
+		path := pathToTile(npc.getTileSync(), stage.tiles[waypoint.y][waypoint.x], npcStages(npc))
+		if len(path) == 0 {
+			next = (next + 1) % len(waypoints)
+			return
+		}
+		takeStep(npc, path[0])
+	}
+}
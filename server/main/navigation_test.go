@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+)
+
+// nav-west has a wall with a gap at the bottom, nav-east lies to its east and teleports into nav-vault
+func navigationTestingAreas() []Area {
+	o, w := Material{Walkable: true}, Material{Walkable: false}
+	return []Area{
+		{Name: "nav-west", SpawnStrategy: "none", East: "nav-east", Tiles: [][]Material{
+			{o, w, o},
+			{o, w, o},
+			{o, o, o},
+		}},
+		{Name: "nav-east", SpawnStrategy: "none", West: "nav-west", Tiles: [][]Material{
+			{o, o, o},
+			{o, o, o},
+			{o, o, o},
+		}, Transports: []Transport{{SourceY: 0, SourceX: 2, DestStage: "nav-vault", DestY: 1, DestX: 1}}},
+		{Name: "nav-vault", SpawnStrategy: "none", Tiles: [][]Material{
+			{w, w, w},
+			{w, o, w},
+			{w, w, w},
+		}},
+	}
+}
+
+func createNavigationTestingWorld(t *testing.T) (*World, *NonPlayer) {
+	replaceAreasForTesting(t, navigationTestingAreas())
+	world := createGameWorld(nil, &testingConfig)
+	npc, _ := createNewNPC(world, "npc")
+	for _, area := range navigationTestingAreas() {
+		if npc.fetchStageSync(area.Name) == nil {
+			t.Fatal("failed to load " + area.Name)
+		}
+	}
+	return world, npc
+}
+
+func TestFindPathAroundWallsAndAcrossStages(t *testing.T) {
+	world, _ := createNavigationTestingWorld(t)
+	west := world.loadedStage("nav-west", "")
+	east := world.loadedStage("nav-east", "")
+
+	path := pathToTile(west.tiles[0][0], east.tiles[0][0], world.loadedStagesFor(""))
+	if len(path) != 7 {
+		t.Fatalf("expected 7 steps around the wall and over the edge, got %d", len(path))
+	}
+	if path[2].tile != west.tiles[2][1] {
+		t.Error("path should pass through the gap in the wall")
+	}
+	if path[len(path)-1].tile != east.tiles[0][0] {
+		t.Error("path should end on nav-east")
+	}
+}
+
+func TestFindPathThroughTeleport(t *testing.T) {
+	world, _ := createNavigationTestingWorld(t)
+	east := world.loadedStage("nav-east", "")
+	vault := world.loadedStage("nav-vault", "")
+
+	path := pathToTile(east.tiles[1][1], vault.tiles[1][1], world.loadedStagesFor(""))
+	if len(path) != 3 {
+		t.Fatalf("expected 3 steps, got %d", len(path))
+	}
+	if path[2].teleport == nil || path[2].tile != vault.tiles[1][1] {
+		t.Error("final step should be the teleport into the vault")
+	}
+
+	if pathToTile(vault.tiles[1][1], east.tiles[1][1], world.loadedStagesFor("")) != nil {
+		t.Error("vault has no way out")
+	}
+}
+
+func TestFindPathOntoTeamStage(t *testing.T) {
+	replaceAreasForTesting(t, navigationTestingAreas())
+	world := createGameWorld(nil, &testingConfig)
+	west, _ := areaFromName("nav-west")
+	east, _ := areaFromName("nav-east")
+	world.wStageMutex.Lock()
+	world.registerStage("nav-west", createStageFromArea(west))
+	world.registerStage("nav-east:fuchsia", createStageFromArea(east))
+	world.wStageMutex.Unlock()
+
+	start := world.loadedStage("nav-west", "").tiles[0][2]
+	teamEast := world.loadedStage("nav-east", "fuchsia")
+	if teamEast == nil || world.loadedStage("nav-east", "sky-blue") != nil {
+		t.Fatal("expected only fuchsia to find its team stage")
+	}
+	if path := pathToTile(start, teamEast.tiles[0][0], world.loadedStagesFor("fuchsia")); len(path) != 1 {
+		t.Errorf("expected one step onto the team stage, got %d", len(path))
+	}
+}
+
+func TestHuntChasesEnemyAcrossStageEdge(t *testing.T) {
+	world, npc := createNavigationTestingWorld(t)
+	west := world.loadedStage("nav-west", "")
+	east := world.loadedStage("nav-east", "")
+
+	addNPCAndNotifyOthers(npc, west.tiles[2][2])
+	enemy, _ := createNewNPC(world, "enemy")
+	addNPCAndNotifyOthers(enemy, east.tiles[2][2])
+
+	hunt := huntNearestEnemy([][][2]int{{}})
+	for range 20 {
+		if npc.health.Load() < FLEE_HEALTH {
+			t.Fatal("npc should not be fleeing")
+		}
+		hunt(npc)
+	}
+	if tile := npc.getTileSync(); tile != east.tiles[2][1] {
+		t.Errorf("expected npc to stop beside its enemy, got %s %d,%d", tile.stage.name, tile.y, tile.x)
+	}
+
+	npc.health.Store(FLEE_HEALTH - 1)
+	hunt(npc)
+	if tile := npc.getTileSync(); tile != east.tiles[2][0] && tile != east.tiles[1][1] {
+		t.Errorf("expected npc to flee away from its enemy, got %s %d,%d", tile.stage.name, tile.y, tile.x)
+	}
+}
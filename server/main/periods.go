@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PERIOD_ALL_TIME = "All-Time"
+	PERIOD_DAILY    = "Daily"
+	PERIOD_WEEKLY   = "Weekly" // Starting Monday
+	PERIOD_SEASON   = "Season"
+
+	RANK_BY_OWNER = "owner"
+	RANK_BY_TEAM  = "team"
+
+	DEFAULT_SEASON_LENGTH = 28 * 24 * time.Hour
+)
+
+// Seasons are numbered from one, the first starting on a Monday
+var SEASON_EPOCH = time.Date(2025, time.January, 6, 0, 0, 0, 0, time.UTC)
+
+// Used w/ Template methods to cycle through on site
+var queryPeriods = []string{
+	PERIOD_ALL_TIME,
+	PERIOD_DAILY,
+	PERIOD_WEEKLY,
+	PERIOD_SEASON,
+}
+
+// Categories ranked by counting events over a period, the rest are all-time only
+var periodEventTypes = map[string]string{
+	"Deadliest": EVENT_KILL,
+	"MVP":       EVENT_SCORE,
+}
+
+var periodStatNames = map[string]string{
+	"Deadliest": "Kills",
+	"MVP":       "Goals",
+}
+
+// What the all-time lists of the same categories are ranked by
+var allTimeStatNames = map[string]string{
+	"Deadliest": "Streak",
+	"MVP":       "Goals",
+}
+
+type RankedCount struct {
+	Name  string `bson:"name"`
+	Count int64  `bson:"count"`
+}
+
+// Final standings, saved once a season has ended
+type SeasonStandingsRecord struct {
+	Season    int           `bson:"season"`
+	Start     time.Time     `bson:"start"`
+	End       time.Time     `bson:"end"`
+	Archived  time.Time     `bson:"archived"`
+	Kills     []RankedCount `bson:"kills"`
+	Goals     []RankedCount `bson:"goals"`
+	TeamKills []RankedCount `bson:"teamKills"`
+	TeamGoals []RankedCount `bson:"teamGoals"`
+}
+
+func (record *SeasonStandingsRecord) standings(category string) (players, teams []RankedCount) {
+	if category == "MVP" {
+		return record.Goals, record.TeamGoals
+	}
+	return record.Kills, record.TeamKills
+}
+
+////////////////////////////////////////////////////////////
+// Windows
+
+type SeasonCalendar struct {
+	epoch  time.Time
+	length time.Duration // Whole days so that daily rollups fall in one season
+}
+
+func createSeasonCalendar(length time.Duration) SeasonCalendar {
+	if length <= 0 {
+		length = DEFAULT_SEASON_LENGTH
+	}
+	return SeasonCalendar{epoch: SEASON_EPOCH, length: length.Truncate(24 * time.Hour)}
+}
+
+func (calendar SeasonCalendar) seasonAt(t time.Time) int {
+	if t.Before(calendar.epoch) {
+		return 1
+	}
+	return int(t.Sub(calendar.epoch)/calendar.length) + 1
+}
+
+func (calendar SeasonCalendar) bounds(season int) (time.Time, time.Time) {
+	start := calendar.epoch.Add(time.Duration(season-1) * calendar.length)
+	return start, start.Add(calendar.length)
+}
+
+// Whole UTC days, as required by rankEventsBy
+func periodBounds(period string, season int, calendar SeasonCalendar, now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case PERIOD_DAILY:
+		return today, today.AddDate(0, 0, 1)
+	case PERIOD_WEEKLY:
+		monday := today.AddDate(0, 0, -mod(int(today.Weekday())-1, 7))
+		return monday, monday.AddDate(0, 0, 7)
+	}
+	return calendar.bounds(season)
+}
+
+func periodFromQuery(s string) string {
+	for _, period := range queryPeriods {
+		if strings.EqualFold(s, period) {
+			return period
+		}
+	}
+	return PERIOD_ALL_TIME
+}
+
+////////////////////////////////////////////////////////////
+// Lists
+
+// Current periods are refreshed like the all-time lists, ended seasons come from the archive
+func generatePeriodList(hub *Hub, category, period string, season int, now time.Time) HighScoreList {
+	current := hub.seasons.seasonAt(now)
+	if period != PERIOD_SEASON {
+		season = 0
+	} else if season <= 0 || season > current {
+		season = current
+	}
+	list := hub.periodList(category, period, season)
+	list.Lock()
+	defer list.Unlock()
+	if !isOverNSecondsAgo(list.lastChecked, HIGHSCORE_CHECK_INTERVAL_IN_SECONDS) {
+		return list.HighScoreList
+	}
+
+	var players, teams []RankedCount
+	if period == PERIOD_SEASON && season < current {
+		record, err := hub.archiveSeason(season)
+		if err != nil {
+			logger.Error().Err(err).Msg(fmt.Sprintf("Failed to archive season %d", season))
+			return list.HighScoreList
+		}
+		players, teams = record.standings(category)
+	} else {
+		if current > 1 {
+			hub.archiveSeason(current - 1) // Once the first list of a new season is shown
+		}
+		from, to := periodBounds(period, season, hub.seasons, now)
+		var err error
+		if players, err = hub.db.rankEventsBy(context.TODO(), periodEventTypes[category], RANK_BY_OWNER, from, to, 10); err == nil {
+			teams, err = hub.db.rankEventsBy(context.TODO(), periodEventTypes[category], RANK_BY_TEAM, from, to, 10)
+		}
+		if err != nil {
+			logger.Error().Err(err).Msg(fmt.Sprintf("Failed to rank %s for %s", category, list.PeriodTitle()))
+			return list.HighScoreList // Tried again on the next request
+		}
+	}
+	list.Entries = rankedEntries(players, periodStatNames[category])
+	list.Teams = rankedEntries(teams, periodStatNames[category])
+	list.lastChecked = time.Now()
+	return list.HighScoreList
+}
+
+func (hub *Hub) periodList(category, period string, season int) *HighScoreListSync {
+	hub.periodsLock.Lock()
+	defer hub.periodsLock.Unlock()
+	key := category + "/" + period + "/" + strconv.Itoa(season)
+	list, ok := hub.periods[key]
+	if !ok {
+		list = &HighScoreListSync{HighScoreList: HighScoreList{Category: category, Period: period, Season: season}}
+		hub.periods[key] = list
+	}
+	return list
+}
+
+func rankedEntries(counts []RankedCount, statName string) []HighScoreEntry {
+	entries := make([]HighScoreEntry, 0, len(counts))
+	for _, count := range counts {
+		entries = append(entries, HighScoreEntry{
+			Username:   count.Name,
+			StatNames:  []string{statName},
+			StatValues: []string{strconv.FormatInt(count.Count, 10)},
+		})
+	}
+	return entries
+}
+
+////////////////////////////////////////////////////////////
+// Archive
+
+// Standings of an ended season are computed once and kept, later reads use the saved record
+func (hub *Hub) archiveSeason(season int) (*SeasonStandingsRecord, error) {
+	hub.archiveLock.Lock()
+	defer hub.archiveLock.Unlock()
+	if record, ok := hub.archived[season]; ok {
+		return record, nil
+	}
+	record, err := hub.db.getSeasonStandings(context.TODO(), season)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		if record, err = hub.computeSeasonStandings(season); err != nil {
+			return nil, err
+		}
+		if err := hub.db.saveSeasonStandings(context.TODO(), *record); err != nil {
+			return nil, err
+		}
+		logger.Info().Msg(fmt.Sprintf("Archived standings of season %d", season))
+	}
+	hub.archived[season] = record
+	return record, nil
+}
+
+func (hub *Hub) computeSeasonStandings(season int) (*SeasonStandingsRecord, error) {
+	start, end := hub.seasons.bounds(season)
+	record := &SeasonStandingsRecord{Season: season, Start: start, End: end, Archived: time.Now()}
+	rankings := []struct {
+		out       *[]RankedCount
+		eventType string
+		groupBy   string
+	}{
+		{&record.Kills, EVENT_KILL, RANK_BY_OWNER},
+		{&record.Goals, EVENT_SCORE, RANK_BY_OWNER},
+		{&record.TeamKills, EVENT_KILL, RANK_BY_TEAM},
+		{&record.TeamGoals, EVENT_SCORE, RANK_BY_TEAM},
+	}
+	for _, ranking := range rankings {
+		counts, err := hub.db.rankEventsBy(context.TODO(), ranking.eventType, ranking.groupBy, start, end, 10)
+		if err != nil {
+			return nil, err
+		}
+		*ranking.out = counts
+	}
+	return record, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPeriodBounds(t *testing.T) {
+	calendar := createSeasonCalendar(DEFAULT_SEASON_LENGTH)
+	wednesday := time.Date(2025, time.February, 5, 15, 30, 0, 0, time.UTC)
+
+	from, to := periodBounds(PERIOD_DAILY, 0, calendar, wednesday)
+	if !from.Equal(time.Date(2025, time.February, 5, 0, 0, 0, 0, time.UTC)) || to.Sub(from) != 24*time.Hour {
+		t.Errorf("unexpected day %v - %v", from, to)
+	}
+	from, to = periodBounds(PERIOD_WEEKLY, 0, calendar, wednesday)
+	if !from.Equal(time.Date(2025, time.February, 3, 0, 0, 0, 0, time.UTC)) || to.Sub(from) != 7*24*time.Hour {
+		t.Errorf("expected the week to start on Monday, got %v - %v", from, to)
+	}
+
+	if calendar.seasonAt(wednesday) != 2 || calendar.seasonAt(SEASON_EPOCH.Add(-time.Hour)) != 1 {
+		t.Errorf("unexpected season %d", calendar.seasonAt(wednesday))
+	}
+	from, to = periodBounds(PERIOD_SEASON, 2, calendar, wednesday)
+	if !from.Equal(time.Date(2025, time.February, 3, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2025, time.March, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected season bounds %v - %v", from, to)
+	}
+	if periodFromQuery("weekly") != PERIOD_WEEKLY || periodFromQuery("yearly") != PERIOD_ALL_TIME {
+		t.Error("unexpected period from query")
+	}
+}
+
+func createPeriodTestingStore(t *testing.T) *FileStore {
+	db := createMemoryStore()
+	season1 := SEASON_EPOCH.Add(48 * time.Hour)
+	season2 := SEASON_EPOCH.Add(30 * 24 * time.Hour)
+	for _, event := range []EventRecord{
+		{Owner: "alice", Team: "fuchsia", Type: EVENT_KILL, Created: season1},
+		{Owner: "alice", Team: "fuchsia", Type: EVENT_KILL, Created: season1},
+		{Owner: "bob", Team: "sky-blue", Type: EVENT_KILL, Created: season1},
+		{Owner: "bob", Team: "sky-blue", Type: EVENT_KILL, Created: season2},
+		{Owner: "bob", Team: "sky-blue", Type: EVENT_SCORE, Created: season2},
+		{Owner: "carol", Type: EVENT_KILL, Created: season2}, // Recorded before teams
+		{Owner: "6f1c2a9e-npc", Team: "npc", Npc: true, Type: EVENT_KILL, Created: season1},
+		{Owner: "6f1c2a9e-npc", Team: "npc", Npc: true, Type: EVENT_KILL, Created: season1},
+		{Owner: "7d2b3f0a-npc", Team: "fuchsia", Npc: true, Type: EVENT_KILL, Created: season1}, // Npcs can join any team
+		{Owner: "7d2b3f0a-npc", Team: "fuchsia", Npc: true, Type: EVENT_KILL, Created: season1},
+	} {
+		if err := db.appendEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestRankEventsIncludesRollups(t *testing.T) {
+	db := createPeriodTestingStore(t)
+	from, to := createSeasonCalendar(DEFAULT_SEASON_LENGTH).bounds(1)
+
+	before, _ := db.rankEventsBy(context.Background(), EVENT_KILL, RANK_BY_OWNER, from, to, 10)
+	if len(before) != 2 || before[0] != (RankedCount{Name: "alice", Count: 2}) || before[1] != (RankedCount{Name: "bob", Count: 1}) {
+		t.Fatalf("unexpected ranking %v", before)
+	}
+
+	// Season one expires
+	policy := RetentionPolicy{EventRetention: 7 * 24 * time.Hour}
+	if _, err := runRetention(context.Background(), db, policy, SEASON_EPOCH.Add(30*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := db.rankEventsBy(context.Background(), EVENT_KILL, RANK_BY_OWNER, from, to, 10)
+	if len(after) != 2 || after[0] != before[0] || after[1] != before[1] {
+		t.Errorf("rolled up events should rank the same, got %v", after)
+	}
+	teams, _ := db.rankEventsBy(context.Background(), EVENT_KILL, RANK_BY_TEAM, from, to, 1)
+	if len(teams) != 1 || teams[0] != (RankedCount{Name: "fuchsia", Count: 2}) {
+		t.Errorf("unexpected team ranking %v", teams)
+	}
+	if _, err := db.rankEventsBy(context.Background(), EVENT_KILL, "stage", from, to, 1); err == nil {
+		t.Error("unknown groupings should be rejected")
+	}
+}
+
+func TestKillsByNpcsOnPlayerTeamsAreNotRanked(t *testing.T) {
+	loadFromJson()
+	db := createMemoryStore()
+	tile := createStageByName("hallway").tiles[3][11]
+	npc := &NonPlayer{id: "tutorial-npc", team: "7"}
+	player := &Player{username: "alice", team: "7"}
+	db.saveKillEvent(tile, npc, &Player{username: "bob"})
+	db.saveKillEvent(tile, player, &Player{username: "bob"})
+
+	ranked, _ := db.rankEventsBy(context.Background(), EVENT_KILL, RANK_BY_TEAM, time.Time{}, time.Now().Add(time.Hour), 10)
+	if len(ranked) != 1 || ranked[0] != (RankedCount{Name: "7", Count: 1}) {
+		t.Errorf("only the player's kill should be ranked, got %v", ranked)
+	}
+}
+
+func TestSeasonStandingsAreArchived(t *testing.T) {
+	db := createPeriodTestingStore(t)
+	now := SEASON_EPOCH.Add(30 * 24 * time.Hour)
+	hub := createDefaultHub(db)
+
+	list := generatePeriodList(hub, "Deadliest", PERIOD_SEASON, 0, now)
+	if list.Season != 2 || len(list.Entries) != 2 || list.Entries[0].Username != "bob" {
+		t.Errorf("expected the current season, got %+v", list)
+	}
+	if record := db.seasons[1]; len(record.Kills) != 2 || record.Kills[0].Name != "alice" || len(record.TeamKills) != 2 {
+		t.Fatalf("the ended season should be archived, got %+v", record)
+	}
+
+	// Late events do not change final standings
+	db.appendEvent(EventRecord{Owner: "dave", Team: "fuchsia", Type: EVENT_KILL, Created: SEASON_EPOCH})
+	list = generatePeriodList(createDefaultHub(db), "Deadliest", PERIOD_SEASON, 1, now)
+	if len(list.Entries) != 2 || list.Entries[0].Username != "alice" || list.Teams[0].Username != "fuchsia" || list.PrevSeason() != 0 {
+		t.Errorf("expected the archived standings, got %+v", list)
+	}
+
+	list = generatePeriodList(hub, "MVP", PERIOD_WEEKLY, 0, now)
+	if len(list.Entries) != 1 || list.Entries[0].StatValues[0] != "1" || list.PeriodTitle() != PERIOD_WEEKLY {
+		t.Errorf("unexpected weekly list %+v", list)
+	}
+}
+
+type failingRankings struct {
+	*FileStore
+	err error
+}
+
+func (db *failingRankings) rankEventsBy(ctx context.Context, eventType, groupBy string, from, to time.Time, n int) ([]RankedCount, error) {
+	if db.err != nil {
+		return nil, db.err
+	}
+	return db.FileStore.rankEventsBy(ctx, eventType, groupBy, from, to, n)
+}
+
+func TestPeriodListRetriesAfterRankingError(t *testing.T) {
+	db := &failingRankings{FileStore: createPeriodTestingStore(t), err: errors.New("unavailable")}
+	hub := createDefaultHub(db)
+	now := SEASON_EPOCH.Add(30 * 24 * time.Hour)
+
+	if list := generatePeriodList(hub, "Deadliest", PERIOD_SEASON, 0, now); len(list.Entries) != 0 {
+		t.Errorf("expected no entries while ranking fails, got %+v", list.Entries)
+	}
+	db.err = nil
+	if list := generatePeriodList(hub, "Deadliest", PERIOD_SEASON, 0, now); len(list.Entries) != 2 {
+		t.Errorf("a failed ranking should not be cached, got %+v", list.Entries)
+	}
+}
+
+func TestHighscorePeriodNavigation(t *testing.T) {
+	list := HighScoreList{Category: "Deadliest"}
+	if list.NextPeriod() != PERIOD_DAILY || list.PrevPeriod() != PERIOD_SEASON || !list.HasPeriods() {
+		t.Error("all-time lists should lead to the periods")
+	}
+	list = HighScoreList{Category: "Deadliest", Period: PERIOD_SEASON, Season: 3}
+	if list.NextPeriod() != PERIOD_ALL_TIME || list.PeriodTitle() != "Season 3" || list.PrevSeason() != 2 {
+		t.Errorf("unexpected navigation from %+v", list)
+	}
+	if (HighScoreList{Category: "Deadliest"}).RankedBy() != "Streak" || list.RankedBy() != "Kills" {
+		t.Error("expected the all-time list to be labelled by streak and the periods by kills")
+	}
+	if (HighScoreList{Category: "Richest"}).HasPeriods() {
+		t.Error("richest is all-time only")
+	}
+
+	hub := createDefaultHub(createPeriodTestingStore(t))
+	w := httptest.NewRecorder()
+	hub.highscoreHandler(w, httptest.NewRequest("GET", "/highscore?category=deadliest&period=season&season=1", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, "Season 1 - by Kills") || !strings.Contains(body, "fuchsia") || !strings.Contains(body, "category=MVP&period=Season") {
+		t.Errorf("expected season one with teams and navigation, got %s", body)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"math/rand/v2"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,7 +16,7 @@ type Player struct {
 	username                 string
 	team                     string
 	icon                     string
-	hat                      string
+	hat                      string // Trim currently worn, see inventory for the chosen hat
 	viewLock                 sync.Mutex
 	world                    *World
 	tile                     *Tile
@@ -27,18 +26,26 @@ type Player struct {
 	textUpdatesInFlight      atomic.Int32
 	conn                     WebsocketConnection
 	connLock                 sync.RWMutex // Never RLocks?
+	connected                atomic.Bool  // False once a write fails, until resumed
+	jsonEvents               atomic.Bool  // Typed events replace html, see render
+	quitting                 atomic.Bool  // Quitting players are never parked
+	loggedOut                atomic.Bool
+	resumeToken              string
 	tangible                 bool
 	tangibilityLock          sync.Mutex
 	actions                  *Actions
 	playerStages             map[string]*Stage
 	pStageMutex              sync.Mutex
+	evictedStages            *StageSnapshots
 	accomplishments          SyncAccomplishmentList
+	inventory                Inventory
 	health                   atomic.Int64
 	money                    atomic.Int64
 	killstreak               atomic.Int64
 	PlayerStats
 	SyncMenuList
 	camera *Camera
+	chat   ChatState
 }
 
 type PlayerStats struct {
@@ -91,7 +98,7 @@ func handleDeath(player *Player) {
 	player.incrementDeathCount()
 	player.resetHealth()
 	player.zeroKillStreak()
-	player.setHat("")
+	player.wearActiveHat()
 	player.setIcon()
 	player.actions = createDefaultActions() // problematic, -> setDefaultActions(player)
 
@@ -144,36 +151,32 @@ func removeFromTileAndStage(player *Player) {
 }
 
 func infirmaryStagenameForPlayer(player *Player) string {
-	team := player.getTeamNameSync()
-	if team != "sky-blue" && team != "fuchsia" {
+	team, ok := teams.get(player.getTeamNameSync())
+	if !ok || team.Infirmary.Stage == "" {
 		return "clinic"
 	}
 
-	return "infirmary-flattened:0-0"
+	return team.Infirmary.Stage
 }
 
 func infirmaryCoordsForPlayer(player *Player) (int, int) {
-	team := player.getTeamNameSync()
-	if team != "sky-blue" && team != "fuchsia" {
+	team, ok := teams.get(player.getTeamNameSync())
+	if !ok || team.Infirmary.Stage == "" {
 		return 2, 2
 	}
-	y := 2 // team is "fuchsia" if not "sky-blue"
-	if team == "sky-blue" {
-		y = 50 // ( 3 * 16 ) + 2
-	}
-	longitude := rand.IntN(4)
-	x := (longitude * 16) + 2
-	return y, x
+	return team.Infirmary.coords()
 }
 
 ////////////////////////////////////////////////////////////
 //	Updates
 
+// Zone updates beyond this are coalesced in the camera backlog rather than blocking the zone
+const UPDATE_QUEUE_SIZE = 256
+
 func (player *Player) sendUpdates() {
 	var buffer bytes.Buffer
 	const maxBufferSize = 10 * 256 * 1024
 
-	shouldSendUpdates := true
 	ticker := time.NewTicker(25 * time.Millisecond)
 	defer ticker.Stop()
 	for {
@@ -183,7 +186,7 @@ func (player *Player) sendUpdates() {
 				logger.Info().Msg("Player:" + player.username + "- update channel closed")
 				return
 			}
-			if !shouldSendUpdates {
+			if !player.connected.Load() {
 				continue
 			}
 
@@ -191,18 +194,32 @@ func (player *Player) sendUpdates() {
 				// Accumulate the update in the buffer.
 				buffer.Write(update)
 			} else {
-				logger.Warn().Msg(fmt.Sprintf("Player: %s - buffer exceeded %d bytes, wiping buffer\n", player.username, maxBufferSize))
+				logger.Warn().Msg(fmt.Sprintf("Player: %s - buffer exceeded %d bytes, resyncing\n", player.username, maxBufferSize))
 				buffer.Reset()
+				metrics.bufferWipes.Add(1)
+				player.camera.backlog.requestResync()
 			}
 		case <-ticker.C:
-			if !shouldSendUpdates || buffer.Len() == 0 {
+			resync, open := player.camera.collect(player.updates, &buffer)
+			if !open {
+				logger.Info().Msg("Player:" + player.username + "- update channel closed")
+				return
+			}
+			if !player.connected.Load() {
+				buffer.Reset() // Stale once resumed
+				continue
+			}
+			if resync && resyncPlayer(player, &buffer) {
+				player.camera.backlog.resynced()
+			}
+			if buffer.Len() == 0 {
 				continue
 			}
 			// Every 25ms, if there's anything in the buffer, send it.
-			err := sendUpdate(player, buffer.Bytes())
+			err := sendUpdate(player, player.world.bandwidth.coalesce(buffer.Bytes()))
 			if err != nil {
 				//logger.Warn().Err(err).Msg("Error - Stopping furture sends: ")
-				shouldSendUpdates = false
+				player.connected.Store(false)
 				player.closeConnectionSync()
 			}
 
@@ -211,6 +228,20 @@ func (player *Player) sendUpdates() {
 	}
 }
 
+// Whole stage rather than the view so that nothing which scrolls into view is stale
+func resyncPlayer(player *Player, buffer *bytes.Buffer) bool {
+	set, ok := player.camera.setToken()
+	if !ok {
+		return false
+	}
+	buffer.Write(set)
+	if player.getTileSync() != nil {
+		buffer.Write(entireScreenAsSwaps(player))
+	}
+	buffer.Write(player.render(divPlayerInformation(player), hudFromPlayer(player)))
+	return true
+}
+
 func sendUpdate(player *Player, update []byte) error {
 	player.connLock.Lock()
 	defer player.connLock.Unlock()
@@ -227,6 +258,7 @@ func sendUpdate(player *Player, update []byte) error {
 	if err != nil {
 		// Technically can be any write error
 		logger.Debug().Msg("Incrementing websocket session timeout violations for: " + player.username)
+		metrics.timeoutViolations.Add(1)
 		if player.sessionTimeOutViolations.Add(1) >= 2 {
 			return err
 		}
@@ -261,13 +293,24 @@ const bottomTextEmpty = `
 
 func (player *Player) updateBottomText(message string) {
 	msg := fmt.Sprintf(bottomTextTemplate, processStringForColors(message))
-	updateOne(msg, player) // Potential to send on closed ?
+	player.updates <- player.render(msg, textEvent(message)) // Potential to send on closed ?
 	player.textUpdatesInFlight.Add(1)
-	go tryClearBottomTextAfter(player, 5000)
+	scheduleAfter(player.tryGetStage(), 5000*time.Millisecond, func(*UpdateBatch) { tryClearBottomText(player) })
+}
+
+// Nil if the tile is locked, e.g. mid transfer
+func (player *Player) tryGetStage() *Stage {
+	if !player.tileLock.TryLock() {
+		return nil
+	}
+	defer player.tileLock.Unlock()
+	if player.tile == nil {
+		return nil
+	}
+	return player.tile.stage
 }
 
-func tryClearBottomTextAfter(player *Player, delay int) {
-	time.Sleep(time.Millisecond * time.Duration(delay))
+func tryClearBottomText(player *Player) {
 	if player.textUpdatesInFlight.Add(-1) == 0 {
 		ownLock := player.tangibilityLock.TryLock()
 		if !ownLock {
@@ -278,13 +321,13 @@ func tryClearBottomTextAfter(player *Player, delay int) {
 			return
 		}
 
-		updateOne(bottomTextEmpty, player)
+		player.updates <- player.render(bottomTextEmpty, textEvent(""))
 	}
 }
 
 func (player *Player) updatePlayerHud() {
 	player.updatePlayerBox()
-	updateOne(divPlayerInformation(player), player)
+	player.updates <- player.render(divPlayerInformation(player), hudFromPlayer(player))
 }
 
 func (player *Player) updatePlayerBox() {
@@ -294,7 +337,7 @@ func (player *Player) updatePlayerBox() {
 }
 
 func sendSoundToPlayer(player *Player, soundName string) {
-	updateOne(soundTriggerByName(soundName), player)
+	player.updates <- player.render(soundTriggerByName(soundName), MessageEvent{Type: "sound", Text: soundName})
 }
 
 func soundTriggerByName(soundName string) string {
@@ -325,7 +368,11 @@ func (player *Player) updateRecordOnLogin() {
 }
 func (player *Player) updateRecordOnLogout() {
 	currentTile := player.getTileSync()
-	go player.world.db.updatePlayerRecordOnLogout(player, currentTile)
+	player.world.pendingSaves.Add(1)
+	go func() {
+		defer player.world.pendingSaves.Done()
+		player.world.db.updatePlayerRecordOnLogout(player, currentTile)
+	}()
 }
 
 /////////////////////////////////////////////////////////////
@@ -352,6 +399,7 @@ func (player *Player) setHatByName(hatName string) {
 	if !ok {
 		return
 	}
+	player.unlockHat(hatName)
 	player.setHat(hat)
 	updateIconForAllIfTangible(player) // May not originate from click hence check tangible
 }
@@ -376,6 +424,12 @@ func (player *Player) setHat(hat string) {
 	player.hat = hat
 }
 
+func (player *Player) getHatSync() string {
+	player.viewLock.Lock()
+	defer player.viewLock.Unlock()
+	return player.hat
+}
+
 /////////////////////////////////////////////////////////////
 //  Accomplishments
 
@@ -385,6 +439,9 @@ func (player *Player) addAccomplishmentByName(accomplishmentName string) {
 		return
 	}
 	player.world.db.addAccomplishmentToPlayer(player.username, acc.Name, *acc)
+	if hat, ok := ACCOMPLISHMENT_HATS[accomplishmentName]; ok {
+		player.unlockHat(hat)
+	}
 }
 
 /////////////////////////////////////////////////////////////
@@ -432,6 +489,7 @@ func (player *Player) addMoneyAndUpdate(n int) {
 	}
 
 	// Track richest?
+	player.world.getGameModeSync().onMoneyGained(player, n)
 
 	updateOne(spanMoney(totalMoney), player)
 }
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Chosen in the first /screen message: {"token": ..., "protocol": "json"}
+const (
+	PROTOCOL_HTML = "html"
+	PROTOCOL_JSON = "json"
+)
+
+// Emits each outgoing update as a JSON array of events instead of swaps and html fragments.
+// Player specific updates are built as events where they are sent, see render. Zone updates are
+// shared by every camera in the zone so they remain swaps and sounds, which are translated here.
+type JsonConnection struct {
+	WebsocketConnection
+}
+
+func negotiateProtocol(conn WebsocketConnection, protocol string) (WebsocketConnection, bool) {
+	switch protocol {
+	case "", PROTOCOL_HTML:
+		return conn, true
+	case PROTOCOL_JSON:
+		return &JsonConnection{WebsocketConnection: conn}, true
+	}
+	return conn, false
+}
+
+func speaksJson(conn WebsocketConnection) bool {
+	_, ok := conn.(*JsonConnection)
+	return ok
+}
+
+// Must be called before any update is sent to the player, and again on resume
+func attachPlayer(conn WebsocketConnection, player *Player) {
+	player.jsonEvents.Store(speaksJson(conn))
+	player.camera.events.Store(speaksJson(conn))
+}
+
+func (conn *JsonConnection) WriteMessage(messageType int, data []byte) error {
+	events := eventsFromUpdate(data)
+	if len(events) == 0 {
+		return nil
+	}
+	out, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	return conn.WebsocketConnection.WriteMessage(messageType, out)
+}
+
+////////////////////////////////////////////////////////////
+// Events
+
+type TileEvent struct {
+	Type  string `json:"type"` // "tile"
+	Layer string `json:"layer"`
+	Y     int    `json:"y"`
+	X     int    `json:"x"`
+	Class string `json:"class"`
+}
+
+type ViewEvent struct {
+	Type string `json:"type"` // "view"
+	Op   string `json:"op"`   // "set" or "shift"
+	Y    int    `json:"y"`
+	X    int    `json:"x"`
+}
+
+type ScreenEvent struct {
+	Type   string `json:"type"` // "screen"
+	Height int    `json:"height"`
+	Width  int    `json:"width"`
+}
+
+type HudEvent struct {
+	Type     string `json:"type"` // "hud"
+	Username string `json:"username"`
+	Health   int64  `json:"health"`
+	Streak   int64  `json:"streak"`
+	Boosts   int    `json:"boosts"`
+	Money    int64  `json:"money"`
+	Power    int    `json:"power"`
+}
+
+type MenuEvent struct {
+	Type     string   `json:"type"` // "menu", "menu-select" or "menu-close"
+	Name     string   `json:"name,omitempty"`
+	Options  []string `json:"options,omitempty"`
+	Selected int      `json:"selected"`
+}
+
+type ChatEvent struct {
+	Type    string `json:"type"`    // "chat"
+	Channel string `json:"channel"` // "team", "stage", "world" or "notice"
+	From    string `json:"from"`
+	Text    string `json:"text"`
+}
+
+type MessageEvent struct {
+	Type string `json:"type"` // "sound", "text", "input", "resume", "logout" or "error"
+	Text string `json:"text"`
+}
+
+type SwapEvent struct {
+	Type  string `json:"type"` // "swap", for ids without an event of their own
+	Id    string `json:"id"`
+	Y     string `json:"y"`
+	X     string `json:"x"`
+	Class string `json:"class"`
+}
+
+type HtmlEvent struct {
+	Type string `json:"type"` // "html", for fragments without an event of their own
+	Html string `json:"html"`
+}
+
+var soundRegex = regexp.MustCompile(`<div id="sound">([^<]*)</div>`)
+
+var swapTokenFields = [][]byte{[]byte(`[~ id="`), []byte(`" y="`), []byte(`" x="`), []byte(`" class="`), []byte(`"]`)}
+
+// Indexes as from regexp's FindAllSubmatchIndex for [~ id="..." y="..." x="..." class="..."]
+// Scanned by hand as every batch for every player passes through here
+func findSwapTokens(update []byte) [][]int {
+	var matches [][]int
+	offset := 0
+	for {
+		start := bytes.Index(update[offset:], swapTokenFields[0])
+		if start == -1 {
+			return matches
+		}
+		start += offset
+		if match, ok := swapTokenAt(update, start); ok {
+			matches = append(matches, match)
+			offset = match[1]
+		} else {
+			offset = start + 1
+		}
+	}
+}
+
+func swapTokenAt(update []byte, start int) ([]int, bool) {
+	match := make([]int, 2, 2*len(swapTokenFields))
+	match[0] = start
+	position := start + len(swapTokenFields[0])
+	for _, field := range swapTokenFields[1:] {
+		end := bytes.IndexByte(update[position:], '"')
+		if end == -1 || !bytes.HasPrefix(update[position+end:], field) {
+			return nil, false
+		}
+		match = append(match, position, position+end)
+		position += end + len(field)
+	}
+	match[1] = position
+	return match, true
+}
+
+// Events are framed as in a JSON text sequence (RFC 7464). Html and swaps never contain the
+// record separator and encoded events never contain a newline.
+const (
+	EVENT_RECORD_START = '\x1e'
+	EVENT_RECORD_END   = '\n'
+)
+
+func eventRecord(events ...any) []byte {
+	var buf bytes.Buffer
+	for _, event := range events {
+		out, err := json.Marshal(event)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to encode event")
+			continue
+		}
+		buf.WriteByte(EVENT_RECORD_START)
+		buf.Write(out)
+		buf.WriteByte(EVENT_RECORD_END)
+	}
+	return buf.Bytes()
+}
+
+// The event replaces the html for players on the json protocol
+func (player *Player) render(html string, events ...any) []byte {
+	if player.jsonEvents.Load() {
+		return eventRecord(events...)
+	}
+	return []byte(html)
+}
+
+// Tile layers by swap id, see makeQuickSwapTemplate
+var swapLayers = map[string]string{
+	"Lg1": "ground1",
+	"Lg2": "ground2",
+	"Lf1": "floor1",
+	"Lf2": "floor2",
+	"Lp1": "character",
+	"Li1": "interactable",
+	"Ls1": "item",
+	"Lc1": "ceiling1",
+	"Lc2": "ceiling2",
+	"Lw1": "weather",
+	"Lt1": "highlight",
+}
+
+// Css classes every box of a layer shares
+var layerClasses = map[string]bool{"box": true, "g1": true, "g2": true, "f1": true, "f2": true, "zp": true, "zi": true, "zs": true, "c1": true, "c2": true, "zw": true, "top": true}
+
+// Event records are passed through, swaps are translated one for one and anything else is sent as html
+func eventsFromUpdate(update []byte) []any {
+	events := make([]any, 0)
+	for len(update) > 0 {
+		start := bytes.IndexByte(update, EVENT_RECORD_START)
+		if start < 0 {
+			return append(events, eventsFromZoneUpdate(update)...)
+		}
+		events = append(events, eventsFromZoneUpdate(update[:start])...)
+		update = update[start+1:]
+		end := bytes.IndexByte(update, EVENT_RECORD_END)
+		if end < 0 {
+			end = len(update)
+		}
+		events = append(events, json.RawMessage(update[:end]))
+		update = update[min(end+1, len(update)):]
+	}
+	return events
+}
+
+// Zone updates are rendered once for every camera in the zone, so they are still built as swaps and
+// sounds and translated here for each json connection rather than built as events where they are sent
+func eventsFromZoneUpdate(update []byte) []any {
+	events := make([]any, 0)
+	var rest bytes.Buffer
+	last := 0
+	for _, match := range findSwapTokens(update) {
+		rest.Write(update[last:match[0]])
+		last = match[1]
+		group := func(i int) string { return string(update[match[2*i]:match[2*i+1]]) }
+		events = append(events, eventFromSwap(group(1), group(2), group(3), group(4)))
+	}
+	rest.Write(update[last:])
+
+	fragment := soundRegex.ReplaceAllStringFunc(rest.String(), func(sound string) string {
+		events = append(events, MessageEvent{Type: "sound", Text: soundRegex.FindStringSubmatch(sound)[1]})
+		return ""
+	})
+	if strings.TrimSpace(fragment) != "" {
+		events = append(events, HtmlEvent{Type: "html", Html: fragment})
+	}
+	return events
+}
+
+func eventFromSwap(id, yString, xString, class string) any {
+	switch id {
+	case "set", "shift":
+		y, _ := strconv.Atoi(yString)
+		x, _ := strconv.Atoi(xString)
+		return ViewEvent{Type: "view", Op: id, Y: y, X: x}
+	case "dpad-shift":
+		if strings.Contains(class, "hidden") {
+			return MessageEvent{Type: "input", Text: "normal"}
+		}
+		return MessageEvent{Type: "input", Text: "shift"}
+	}
+	layer, ok := swapLayers[id]
+	if !ok {
+		return SwapEvent{Type: "swap", Id: id, Y: yString, X: xString, Class: class}
+	}
+	y, _ := strconv.Atoi(yString)
+	x, _ := strconv.Atoi(xString)
+	classes := make([]string, 0)
+	for _, name := range strings.Fields(class) {
+		if !layerClasses[name] {
+			classes = append(classes, name)
+		}
+	}
+	return TileEvent{Type: "tile", Layer: layer, Y: y, X: x, Class: strings.Join(classes, " ")}
+}
+
+////////////////////////////////////////////////////////////
+// Builders
+
+// As swapsForTileNoHighlight
+func tileEvents(tile *Tile) []any {
+	tileEvent := func(layer, class string) any {
+		return TileEvent{Type: "tile", Layer: layer, Y: tile.y, X: tile.x, Class: strings.Join(strings.Fields(class), " ")}
+	}
+	mat := tile.material
+	return []any{
+		tileEvent("ground1", mat.Ground1Css),
+		tileEvent("ground2", mat.Ground2Css),
+		tileEvent("floor1", mat.Floor1Css),
+		tileEvent("floor2", mat.Floor2Css),
+		tileEvent("character", characterIcon(tile)),
+		tileEvent("interactable", interactableClass(tile)),
+		tileEvent("item", itemClasses(tile)),
+		tileEvent("ceiling1", mat.Ceiling1Css),
+		tileEvent("ceiling2", mat.Ceiling2Css),
+		tileEvent("weather", tile.stage.weather),
+		tileEvent("highlight", ""),
+	}
+}
+
+func viewEvent(op string, y, x int) ViewEvent {
+	return ViewEvent{Type: "view", Op: op, Y: y, X: x}
+}
+
+func hudFromPlayer(player *Player) HudEvent {
+	return HudEvent{
+		Type:     "hud",
+		Username: player.username,
+		Health:   player.health.Load(),
+		Streak:   player.killstreak.Load(),
+		Boosts:   player.getBoostCountSync(),
+		Money:    player.money.Load(),
+		Power:    player.actions.spaceStack.count(),
+	}
+}
+
+func menuEvent(menu Menu) MenuEvent {
+	event := MenuEvent{Type: "menu", Name: menu.Name, Options: make([]string, 0, len(menu.Links))}
+	for _, link := range menu.Links {
+		event.Options = append(event.Options, link.Text)
+	}
+	return event
+}
+
+func textEvent(message string) MessageEvent {
+	return MessageEvent{Type: "text", Text: stripColors(message)}
+}
+
+// Sent before the player or spectator exists, so directly on the connection
+func initialScreen(conn WebsocketConnection, height, width int) []byte {
+	if speaksJson(conn) {
+		return eventRecord(ScreenEvent{Type: "screen", Height: height, Width: width})
+	}
+	return emptyScreenBySize(height, width)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type CapturingConn struct {
+	MockConn
+	sync.Mutex
+	messages [][]byte
+}
+
+func (conn *CapturingConn) WriteMessage(messageType int, data []byte) error {
+	conn.Lock()
+	defer conn.Unlock()
+	conn.messages = append(conn.messages, append([]byte{}, data...))
+	return nil
+}
+
+func (conn *CapturingConn) written() string {
+	conn.Lock()
+	defer conn.Unlock()
+	return string(bytes.Join(conn.messages, nil))
+}
+
+func decodeEvents(t *testing.T, message []byte) []map[string]any {
+	var events []map[string]any
+	if err := json.Unmarshal(message, &events); err != nil {
+		t.Fatalf("expected a JSON array of events, got %q: %v", message, err)
+	}
+	return events
+}
+
+func TestFindSwapTokensMatchesTheTokenPattern(t *testing.T) {
+	pattern := regexp.MustCompile(`\[~ id="([^"]*)" y="([^"]*)" x="([^"]*)" class="([^"]*)"\]`)
+	updates := []string{
+		"",
+		playerBoxSpecifc(1, 2, "red") + soundTriggerByName("clink") + interactableBoxSpecific(3, 4, nil),
+		`[~ id="t" y="1" x="2"]` + `[~ id="t" y="1" x="2" class=""]`,
+		`[~ id="broken" y="1` + `[~ id="t" y="" x="" class="a b"]trailing`,
+		`<div id="bottom_text">[~ id="</div>`,
+	}
+	for _, update := range updates {
+		expected := pattern.FindAllSubmatchIndex([]byte(update), -1)
+		if found := findSwapTokens([]byte(update)); !reflect.DeepEqual(found, expected) {
+			t.Errorf("For %q found %v but expected %v", update, found, expected)
+		}
+	}
+}
+
+func TestNegotiateProtocol(t *testing.T) {
+	for _, name := range []string{"", PROTOCOL_HTML} {
+		if conn, ok := negotiateProtocol(&MockConn{}, name); !ok || conn == nil {
+			t.Errorf("expected %q to be supported", name)
+		}
+	}
+	if conn, ok := negotiateProtocol(&MockConn{}, PROTOCOL_JSON); !ok {
+		t.Error("expected json to be supported")
+	} else if _, isJson := conn.(*JsonConnection); !isJson {
+		t.Error("expected json to wrap the connection")
+	}
+	if _, ok := negotiateProtocol(&MockConn{}, "xml"); ok {
+		t.Error("expected unknown protocol to be rejected")
+	}
+}
+
+func TestJsonConnectionTranslatesZoneUpdates(t *testing.T) {
+	capture := &CapturingConn{}
+	conn, _ := negotiateProtocol(capture, PROTOCOL_JSON)
+
+	conn.WriteMessage(1, initialScreen(conn, 2, 3))
+	screen := decodeEvents(t, capture.messages[0])
+	if len(screen) != 1 || screen[0]["type"] != "screen" || screen[0]["height"] != 2.0 || screen[0]["width"] != 3.0 {
+		t.Errorf("unexpected screen event %v", screen)
+	}
+
+	update := `[~ id="shift" y="1" x="-1" class=""]` + playerBoxSpecifc(4, 5, "fuchsia-b") + soundTriggerByName("clink") +
+		`[~ id="Lq9" y="" x="2" class="box new"]<div id="unknown">?</div>`
+	conn.WriteMessage(1, []byte(update))
+	events := decodeEvents(t, capture.messages[1])
+	if len(events) != 5 {
+		t.Fatalf("expected 5 events, got %v", events)
+	}
+	if events[0]["type"] != "view" || events[0]["op"] != "shift" || events[0]["x"] != -1.0 {
+		t.Errorf("unexpected view event %v", events[0])
+	}
+	if events[1]["type"] != "tile" || events[1]["layer"] != "character" || events[1]["y"] != 4.0 || events[1]["class"] != "fuchsia-b" {
+		t.Errorf("unexpected tile event %v", events[1])
+	}
+	if events[2]["type"] != "swap" || events[2]["id"] != "Lq9" || events[2]["x"] != "2" || events[2]["class"] != "box new" {
+		t.Errorf("unknown swaps should be passed through, got %v", events[2])
+	}
+	if events[3]["type"] != "sound" || events[3]["text"] != "clink" {
+		t.Errorf("unexpected sound event %v", events[3])
+	}
+	if events[4]["type"] != "html" || events[4]["html"] != `<div id="unknown">?</div>` {
+		t.Errorf("unknown fragments should be passed through, got %v", events[4])
+	}
+}
+
+func TestJsonCameraSendsTileEvents(t *testing.T) {
+	world := createWorldWithAreasForTesting(t, &testingConfig, Area{Name: "test-json", SpawnStrategy: "none", Tiles: walkableTilesForTesting(2, 2)})
+	capture := &CapturingConn{}
+	conn, _ := negotiateProtocol(capture, PROTOCOL_JSON)
+	player := joinPlayerForTesting(t, world, PlayerRecord{Username: "viewer", Team: "fuchsia", StageName: "test-json", Y: 1, X: 1, Health: 100}, conn)
+	time.Sleep(60 * time.Millisecond)
+
+	capture.Lock()
+	defer capture.Unlock()
+	var events []map[string]any
+	for _, message := range capture.messages {
+		events = append(events, decodeEvents(t, message)...)
+	}
+	if len(events) < 2 || events[0]["type"] != "screen" || events[1]["type"] != "view" || events[1]["op"] != "set" {
+		t.Fatalf("expected the screen then the view, got %v", events)
+	}
+	for _, event := range events {
+		if event["type"] == "tile" && event["layer"] == "character" && event["y"] == 1.0 && event["x"] == 1.0 {
+			if event["class"] != strings.Join(strings.Fields(player.getIconSync()), " ") {
+				t.Errorf("expected the player's icon, got %v", event)
+			}
+			return
+		}
+	}
+	t.Error("expected the player's tile")
+}
+
+func TestJsonPlayerUpdatesAreEvents(t *testing.T) {
+	world := createGameWorld(nil, &testingConfig)
+	player := world.newPlayerFromRecord(PlayerRecord{Username: "hud", Team: "fuchsia", Health: 100, Money: 42}, "token")
+	capture := &CapturingConn{}
+	conn, _ := negotiateProtocol(capture, PROTOCOL_JSON)
+	player.camera = newCamera(player.updates)
+	player.conn = conn
+	attachPlayer(conn, player)
+	next := func() []map[string]any {
+		conn.WriteMessage(1, <-player.updates)
+		return decodeEvents(t, capture.messages[len(capture.messages)-1])
+	}
+
+	var resync bytes.Buffer
+	resyncPlayer(player, &resync)
+	conn.WriteMessage(1, resync.Bytes())
+	if events := decodeEvents(t, capture.messages[0]); len(events) != 1 || events[0]["type"] != "hud" || events[0]["money"] != 42.0 || events[0]["username"] != "hud" {
+		t.Errorf("expected one hud event from player state, got %v", events)
+	}
+
+	player.updateBottomText("hello @[there|red]")
+	if events := next(); events[0]["type"] != "text" || events[0]["text"] != "hello there" {
+		t.Errorf("unexpected text event %v", events)
+	}
+
+	menu, _ := player.getMenu("pause")
+	sendMenu(player, menu)
+	opened := next()
+	options, _ := opened[0]["options"].([]any)
+	if opened[0]["type"] != "menu" || opened[0]["name"] != "pause" || len(options) != len(menu.Links) {
+		t.Errorf("unexpected menu %v", opened)
+	}
+	menuDown(player, PlayerSocketEvent{MenuName: "pause", Arg0: "0"})
+	if selected := next(); selected[0]["type"] != "menu-select" || selected[0]["name"] != "pause" || selected[0]["selected"] != 1.0 {
+		t.Errorf("unexpected selection %v", selected)
+	}
+	turnMenuOff(player)
+	if closed := decodeEvents(t, capture.messages[len(capture.messages)-1]); closed[0]["type"] != "menu-close" {
+		t.Errorf("unexpected close %v", closed)
+	}
+}
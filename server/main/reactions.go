@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Declarative reactions are defined per area and referenced by name from InteractableDescription.Reactions
+//
+//	"reactions": {
+//	    "team-plate-fuchsia": [
+//	        {"reactsWith": {"name": "all", "of": [{"name": "interactableIsNil"}, {"name": "playerHasTeam", "args": ["fuchsia"]}]},
+//	         "reaction": {"name": "playSoundForAll", "args": ["water-splash"]}},
+//	        {"reactsWith": {"name": "everything"}, "reaction": {"name": "pass"}}
+//	    ]
+//	}
+
+type ReactionDescription struct {
+	ReactsWith PredicateDescription `json:"reactsWith"`
+	Reaction   ActionDescription    `json:"reaction"`
+}
+
+type PredicateDescription struct {
+	Name string                 `json:"name"`
+	Args []string               `json:"args,omitempty"`
+	Of   []PredicateDescription `json:"of,omitempty"` // Operands for all, any, and not
+}
+
+type ActionDescription struct {
+	Name string   `json:"name"`
+	Args []string `json:"args,omitempty"`
+}
+
+type reactionPredicate = func(*Interactable, *Player) bool
+type reactionAction = func(*Interactable, *Player, *Tile) (*Interactable, bool)
+
+var reactionPredicates map[string]func(args []string) (reactionPredicate, error)
+var reactionActions map[string]func(args []string) (reactionAction, error)
+
+// Assigned in init() - actions such as killInstantly reach createStageFromArea
+func init() {
+	reactionPredicates = map[string]func(args []string) (reactionPredicate, error){
+		"everything":          noArgs[reactionPredicate](everything),
+		"never":               noArgs[reactionPredicate](never),
+		"interactableIsNil":   noArgs[reactionPredicate](interactableIsNil),
+		"interactableIsABall": noArgs[reactionPredicate](interactableIsABall),
+		"interactableIsARing": noArgs[reactionPredicate](interactableIsARing),
+		"interactableHasName": func(args []string) (reactionPredicate, error) {
+			name, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return interactableHasName(name), nil
+		},
+		"playerHasTeam": func(args []string) (reactionPredicate, error) {
+			team, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return playerHasTeam(team), nil
+		},
+		"playerHasItem": func(args []string) (reactionPredicate, error) {
+			item, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return playerHasItem(item), nil
+		},
+		"playerOwnsHat": func(args []string) (reactionPredicate, error) {
+			hat, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return playerOwnsHat(hat), nil
+		},
+	}
+
+	reactionActions = map[string]func(args []string) (reactionAction, error){
+		"eat":           noArgs[reactionAction](eat),
+		"pass":          noArgs[reactionAction](pass),
+		"killInstantly": noArgs[reactionAction](killInstantly),
+		"openShop":      noArgs[reactionAction](openShopInteraction),
+		"moveInitiator": func(args []string) (reactionAction, error) {
+			offsets, err := intArgs(args, 2)
+			if err != nil {
+				return nil, err
+			}
+			return moveInitiator(offsets[0], offsets[1]), nil
+		},
+		"playSoundForAll": func(args []string) (reactionAction, error) {
+			sound, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return playSoundForAll(sound), nil
+		},
+		"openDoor": func(args []string) (reactionAction, error) {
+			return openDoor(args), nil // Keys to use up, if any
+		},
+		"pickUpItem": func(args []string) (reactionAction, error) {
+			item, err := stringArg(args, 0)
+			if err != nil {
+				return nil, err
+			}
+			count := 1
+			if len(args) > 1 {
+				counts, err := intArgs(args[1:], 1)
+				if err != nil {
+					return nil, err
+				}
+				count = counts[0]
+			}
+			return pickUpItem(item, count), nil
+		},
+		"spawnMoney": func(args []string) (reactionAction, error) {
+			amounts, err := intArgs(args, len(args))
+			if err != nil {
+				return nil, err
+			}
+			if len(amounts) == 0 {
+				return nil, fmt.Errorf("spawnMoney requires at least one amount")
+			}
+			return spawnMoney(amounts), nil
+		},
+	}
+}
+
+////////////////////////////////////////////////////////////
+// Compile
+
+func compileReactionSets(sets map[string][]ReactionDescription) (map[string][]InteractableReaction, error) {
+	out := make(map[string][]InteractableReaction, len(sets))
+	for name, descriptions := range sets {
+		reactions, err := compileReactions(descriptions)
+		if err != nil {
+			return nil, fmt.Errorf("reaction set %s: %w", name, err)
+		}
+		out[name] = reactions
+	}
+	return out, nil
+}
+
+// Also checks that every interactable of the area refers to reactions which exist
+func compileAreaReactions(area Area) (map[string][]InteractableReaction, error) {
+	compiled, err := compileReactionSets(area.Reactions)
+	if err != nil {
+		return nil, err
+	}
+	for y := range area.Interactables {
+		for x, description := range area.Interactables[y] {
+			if description == nil || description.Reactions == "" {
+				continue
+			}
+			if _, ok := compiled[description.Reactions]; ok {
+				continue
+			}
+			if _, ok := interactableReactions[description.Reactions]; !ok {
+				return nil, fmt.Errorf("interactable at %d,%d: unknown reactions: %q", y, x, description.Reactions)
+			}
+		}
+	}
+	return compiled, nil
+}
+
+func compileReactions(descriptions []ReactionDescription) ([]InteractableReaction, error) {
+	out := make([]InteractableReaction, 0, len(descriptions))
+	for i := range descriptions {
+		predicate, err := compilePredicate(descriptions[i].ReactsWith)
+		if err != nil {
+			return nil, fmt.Errorf("reaction %d: %w", i, err)
+		}
+		action, err := compileAction(descriptions[i].Reaction)
+		if err != nil {
+			return nil, fmt.Errorf("reaction %d: %w", i, err)
+		}
+		out = append(out, InteractableReaction{ReactsWith: predicate, Reaction: action})
+	}
+	return out, nil
+}
+
+func compilePredicate(description PredicateDescription) (reactionPredicate, error) {
+	switch description.Name {
+	case "all", "any", "not":
+		return compileCombinator(description)
+	}
+	build, ok := reactionPredicates[description.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown predicate: %q", description.Name)
+	}
+	return build(description.Args)
+}
+
+func compileCombinator(description PredicateDescription) (reactionPredicate, error) {
+	operands := make([]reactionPredicate, 0, len(description.Of))
+	for _, operand := range description.Of {
+		predicate, err := compilePredicate(operand)
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, predicate)
+	}
+	switch description.Name {
+	case "all":
+		return func(i *Interactable, p *Player) bool {
+			for _, predicate := range operands {
+				if !predicate(i, p) {
+					return false
+				}
+			}
+			return true
+		}, nil
+	case "any":
+		return func(i *Interactable, p *Player) bool {
+			for _, predicate := range operands {
+				if predicate(i, p) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	default:
+		if len(operands) != 1 {
+			return nil, fmt.Errorf("not requires exactly one operand, got %d", len(operands))
+		}
+		return func(i *Interactable, p *Player) bool {
+			return !operands[0](i, p)
+		}, nil
+	}
+}
+
+func compileAction(description ActionDescription) (reactionAction, error) {
+	build, ok := reactionActions[description.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown reaction: %q", description.Name)
+	}
+	return build(description.Args)
+}
+
+// Area definitions take priority over the built-in reactions of the same name
+func reactionsByName(name string, areaReactions map[string][]InteractableReaction) []InteractableReaction {
+	if reactions, ok := areaReactions[name]; ok {
+		return reactions
+	}
+	return interactableReactions[name]
+}
+
+////////////////////////////////////////////////////////////
+// Arguments
+
+func noArgs[T any](f T) func([]string) (T, error) {
+	return func(args []string) (T, error) {
+		if len(args) != 0 {
+			var zero T
+			return zero, fmt.Errorf("expected no arguments, got %d", len(args))
+		}
+		return f, nil
+	}
+}
+
+func stringArg(args []string, index int) (string, error) {
+	if index >= len(args) {
+		return "", fmt.Errorf("missing argument %d", index)
+	}
+	return args[index], nil
+}
+
+func intArgs(args []string, n int) ([]int, error) {
+	if len(args) != n {
+		return nil, fmt.Errorf("expected %d arguments, got %d", n, len(args))
+	}
+	out := make([]int, n)
+	for i := range args {
+		value, err := strconv.Atoi(args[i])
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		out[i] = value
+	}
+	return out, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCompileReactionsFromJson(t *testing.T) {
+	raw := `{
+		"team-plate-fuchsia": [
+			{"reactsWith": {"name": "all", "of": [{"name": "interactableIsNil"}, {"name": "playerHasTeam", "args": ["fuchsia"]}]},
+			 "reaction": {"name": "eat"}},
+			{"reactsWith": {"name": "not", "of": [{"name": "interactableHasName", "args": ["ball-gold"]}]},
+			 "reaction": {"name": "pass"}}
+		]
+	}`
+	var sets map[string][]ReactionDescription
+	if err := json.Unmarshal([]byte(raw), &sets); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	compiled, err := compileReactionSets(sets)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	reactions := compiled["team-plate-fuchsia"]
+	if len(reactions) != 2 {
+		t.Fatalf("expected 2 reactions, got %d", len(reactions))
+	}
+
+	fuchsia := &Player{team: "fuchsia"}
+	skyBlue := &Player{team: "sky-blue"}
+	gold := &Interactable{name: "ball-gold"}
+	if !reactions[0].ReactsWith(nil, fuchsia) {
+		t.Error("plate should react to fuchsia player")
+	}
+	if reactions[0].ReactsWith(nil, skyBlue) {
+		t.Error("plate should not react to sky-blue player")
+	}
+	if reactions[1].ReactsWith(gold, skyBlue) {
+		t.Error("negated predicate should reject ball-gold")
+	}
+	if !reactions[1].ReactsWith(&Interactable{name: "ball-lavender"}, skyBlue) {
+		t.Error("negated predicate should accept other interactables")
+	}
+}
+
+func TestCompileReactionsRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		description ReactionDescription
+	}{
+		{"unknown predicate", ReactionDescription{PredicateDescription{Name: "nope"}, ActionDescription{Name: "eat"}}},
+		{"unknown action", ReactionDescription{PredicateDescription{Name: "everything"}, ActionDescription{Name: "nope"}}},
+		{"missing team", ReactionDescription{PredicateDescription{Name: "playerHasTeam"}, ActionDescription{Name: "eat"}}},
+		{"bad offset", ReactionDescription{PredicateDescription{Name: "everything"}, ActionDescription{Name: "moveInitiator", Args: []string{"1", "x"}}}},
+		{"unexpected args", ReactionDescription{PredicateDescription{Name: "everything"}, ActionDescription{Name: "pass", Args: []string{"1"}}}},
+		{"empty not", ReactionDescription{PredicateDescription{Name: "not"}, ActionDescription{Name: "eat"}}},
+	}
+	for _, tc := range tests {
+		if _, err := compileReactions([]ReactionDescription{tc.description}); err == nil {
+			t.Errorf("%s: expected error", tc.name)
+		}
+	}
+}
+
+func TestAreaReactionsOverrideBuiltIn(t *testing.T) {
+	walkable := Material{Walkable: true}
+	area := Area{
+		Name:  "test-reactions",
+		Tiles: [][]Material{{walkable, walkable}},
+		Interactables: [][]*InteractableDescription{{
+			{Name: "plate", Reactions: "pass-all"},
+			{Name: "hole", Reactions: "death-trap"},
+		}},
+		Reactions: map[string][]ReactionDescription{
+			"pass-all": {{ReactsWith: PredicateDescription{Name: "never"}, Reaction: ActionDescription{Name: "eat"}}},
+		},
+	}
+
+	stage := createStageFromArea(area)
+	overridden := stage.tiles[0][0].interactable.reactions
+	if len(overridden) != 1 || overridden[0].ReactsWith(nil, nil) {
+		t.Error("area definition should replace built-in pass-all")
+	}
+	if len(stage.tiles[0][1].interactable.reactions) != len(interactableReactions["death-trap"]) {
+		t.Error("undefined names should fall back to built-in reactions")
+	}
+}
+
+func TestAreasWithInvalidReactionsAreRejected(t *testing.T) {
+	walkable := Material{Walkable: true}
+	unknownReference := Area{
+		Name:          "test-unknown-reactions",
+		Tiles:         [][]Material{{walkable}},
+		Interactables: [][]*InteractableDescription{{{Name: "plate", Reactions: "no-such-reactions"}}},
+	}
+	invalidSet := Area{
+		Name:  "test-invalid-reactions",
+		Tiles: [][]Material{{walkable}},
+		Reactions: map[string][]ReactionDescription{
+			"pass-all": {{ReactsWith: PredicateDescription{Name: "nope"}, Reaction: ActionDescription{Name: "eat"}}},
+		},
+	}
+	for _, area := range []Area{unknownReference, invalidSet} {
+		if _, err := compileAreaReactions(area); err == nil {
+			t.Errorf("%s: expected error", area.Name)
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: should not become a stage", area.Name)
+				}
+			}()
+			createStageFromArea(area)
+		}()
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bump when the meaning of a recorded event changes
+const RECORDING_FORMAT_VERSION = 1
+const RECORDINGS_DIRECTORY = "./data/recordings"
+
+const (
+	recordedStage     = "stage"
+	recordedJoin      = "join"
+	recordedPress     = "press"
+	recordedLeave     = "leave"
+	recordedNpcSpawn  = "npc-spawn"
+	recordedNpcMove   = "npc-move"
+	recordedNpcPower  = "npc-power"
+	recordedNpcRemove = "npc-remove"
+)
+
+// First line of a recording, every following line is a RecordedEvent
+type RecordingHeader struct {
+	Version    int       `json:"version"`
+	ServerName string    `json:"serverName"`
+	Started    time.Time `json:"started"`
+}
+
+// Npc outcomes are recorded rather than re-simulated. Stage outcomes such as item spawns are re-drawn from
+// the stage's recorded seed, in the order the presses were recorded.
+type RecordedEvent struct {
+	Offset   int64              `json:"t"` // Milliseconds since the recording started
+	Kind     string             `json:"kind"`
+	Id       string             `json:"id,omitempty"`  // Username or npc id
+	Key      string             `json:"key,omitempty"` // World stage key of a snapshot
+	Team     string             `json:"team,omitempty"`
+	Stage    string             `json:"stage,omitempty"`
+	Y        int                `json:"y,omitempty"`
+	X        int                `json:"x,omitempty"`
+	Health   int64              `json:"health,omitempty"`
+	Money    int64              `json:"money,omitempty"`
+	Seed     int64              `json:"seed,omitempty"`
+	Press    *PlayerSocketEvent `json:"press,omitempty"`
+	Shape    [][2]int           `json:"shape,omitempty"`
+	Snapshot *StageSnapshot     `json:"snapshot,omitempty"`
+}
+
+// Nil recorders record nothing
+type Recorder struct {
+	sync.Mutex
+	directory  string
+	serverName string
+	file       *os.File
+	encoder    *json.Encoder
+	started    time.Time
+	stages     map[string]struct{} // Keys with a recorded initial state
+}
+
+////////////////////////////////////////////////////////////
+// Lifecycle
+
+func createRecorder(directory, serverName string) *Recorder {
+	return &Recorder{directory: directory, serverName: serverName}
+}
+
+// Starts a new recording from the current state of the world
+func (recorder *Recorder) rotate(world *World) {
+	if recorder == nil {
+		return
+	}
+	if err := recorder.open(); err != nil {
+		logger.Error().Err(err).Msg("Failed to start recording")
+		return
+	}
+	world.wStageMutex.Lock()
+	for key, stage := range world.worldStages {
+		if stage != nil {
+			recorder.recordStage(key, stage)
+		}
+	}
+	world.wStageMutex.Unlock()
+	for _, player := range world.copyOfPlayers() {
+		if tile := player.getTileSync(); tile != nil {
+			recorder.recordJoin(player, tile)
+		}
+	}
+}
+
+func (recorder *Recorder) open() error {
+	recorder.Lock()
+	defer recorder.Unlock()
+	recorder.closeLocked()
+	if err := os.MkdirAll(recorder.directory, 0755); err != nil {
+		return err
+	}
+	started := time.Now()
+	name := fmt.Sprintf("%s-%s.jsonl", recorder.serverName, started.Format("20060102-150405.000"))
+	file, err := os.Create(filepath.Join(recorder.directory, name))
+	if err != nil {
+		return err
+	}
+	recorder.file = file
+	recorder.encoder = json.NewEncoder(file)
+	recorder.started = started
+	recorder.stages = make(map[string]struct{})
+	logger.Info().Msg("Recording to " + name)
+	return recorder.encoder.Encode(RecordingHeader{Version: RECORDING_FORMAT_VERSION, ServerName: recorder.serverName, Started: started})
+}
+
+func (recorder *Recorder) close() {
+	if recorder == nil {
+		return
+	}
+	recorder.Lock()
+	defer recorder.Unlock()
+	recorder.closeLocked()
+}
+
+func (recorder *Recorder) closeLocked() {
+	if recorder.file == nil {
+		return
+	}
+	if err := recorder.file.Close(); err != nil {
+		logger.Error().Err(err).Msg("Failed to close recording")
+	}
+	recorder.file = nil
+	recorder.encoder = nil
+}
+
+func (recorder *Recorder) write(event RecordedEvent) {
+	if recorder == nil {
+		return
+	}
+	recorder.Lock()
+	defer recorder.Unlock()
+	if recorder.encoder == nil {
+		return
+	}
+	event.Offset = time.Since(recorder.started).Milliseconds()
+	if err := recorder.encoder.Encode(event); err != nil {
+		logger.Error().Err(err).Msg("Failed to record event")
+	}
+}
+
+////////////////////////////////////////////////////////////
+// Events
+
+// Only the first state of each stage is needed, later changes follow from the events
+func (recorder *Recorder) recordStage(key string, stage *Stage) {
+	if recorder == nil {
+		return
+	}
+	recorder.Lock()
+	_, recorded := recorder.stages[key]
+	if recorder.stages != nil {
+		recorder.stages[key] = struct{}{}
+	}
+	recorder.Unlock()
+	if !recorded {
+		recorder.write(RecordedEvent{Kind: recordedStage, Key: key, Snapshot: snapshotStage(stage), Seed: stage.seed})
+	}
+}
+
+func (recorder *Recorder) recordJoin(player *Player, tile *Tile) {
+	if recorder == nil {
+		return
+	}
+	recorder.write(RecordedEvent{
+		Kind:   recordedJoin,
+		Id:     player.username,
+		Team:   player.getTeamNameSync(),
+		Stage:  tile.stage.name,
+		Y:      tile.y,
+		X:      tile.x,
+		Health: player.health.Load(),
+		Money:  player.money.Load(),
+	})
+}
+
+// Tokens are never recorded
+func (recorder *Recorder) recordPress(player *Player, event *PlayerSocketEvent) {
+	if recorder == nil {
+		return
+	}
+	press := *event
+	press.Token = ""
+	recorder.write(RecordedEvent{Kind: recordedPress, Id: player.username, Press: &press})
+}
+
+func (recorder *Recorder) recordLeave(player *Player) {
+	if recorder == nil {
+		return
+	}
+	recorder.write(RecordedEvent{Kind: recordedLeave, Id: player.username})
+}
+
+func (recorder *Recorder) recordNpcSpawn(npc *NonPlayer) {
+	tile := npc.getTileSync()
+	if recorder == nil || tile == nil {
+		return
+	}
+	recorder.write(RecordedEvent{Kind: recordedNpcSpawn, Id: npc.id, Team: npc.getTeamNameSync(), Stage: tile.stage.name, Y: tile.y, X: tile.x, Health: npc.health.Load(), Money: npc.money.Load(), Seed: npc.seed})
+}
+
+func (recorder *Recorder) recordNpcMove(npc *NonPlayer, tile *Tile) {
+	if recorder == nil {
+		return
+	}
+	recorder.write(RecordedEvent{Kind: recordedNpcMove, Id: npc.id, Stage: tile.stage.name, Y: tile.y, X: tile.x})
+}
+
+func (recorder *Recorder) recordNpcPower(npc *NonPlayer, shape [][2]int) {
+	if recorder == nil {
+		return
+	}
+	recorder.write(RecordedEvent{Kind: recordedNpcPower, Id: npc.id, Shape: shape})
+}
+
+func (recorder *Recorder) recordNpcRemove(npc *NonPlayer) {
+	if recorder == nil {
+		return
+	}
+	recorder.write(RecordedEvent{Kind: recordedNpcRemove, Id: npc.id})
+}
+
+// Npc moves are recorded by where the action left the npc
+func recordingNpcMoves(action func(*NonPlayer)) func(*NonPlayer) {
+	return func(npc *NonPlayer) {
+		before := npc.getTileSync()
+		action(npc)
+		after := npc.getTileSync()
+		if after != nil && after != before {
+			npc.world.recorder.recordNpcMove(npc, after)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////
+// Read
+
+func readRecording(path string) (RecordingHeader, []RecordedEvent, error) {
+	var header RecordingHeader
+	file, err := os.Open(path)
+	if err != nil {
+		return header, nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024) // Stage snapshots can be large
+	if !scanner.Scan() {
+		return header, nil, fmt.Errorf("empty recording")
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return header, nil, err
+	}
+	if header.Version != RECORDING_FORMAT_VERSION {
+		return header, nil, fmt.Errorf("unsupported recording version %d", header.Version)
+	}
+	events := make([]RecordedEvent, 0)
+	for scanner.Scan() {
+		var event RecordedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return header, nil, err
+		}
+		events = append(events, event)
+	}
+	return header, events, scanner.Err()
+}
+
+// Names are file names only, nothing outside of the recordings directory can be read
+func recordingPath(directory, name string) (string, bool) {
+	if name == "" || filepath.Base(name) != name || !strings.HasSuffix(name, ".jsonl") {
+		return "", false
+	}
+	return filepath.Join(directory, name), true
+}
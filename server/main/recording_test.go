@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordingReplaysPushedBall(t *testing.T) {
+	walkable := Material{Walkable: true}
+	area := Area{
+		Name:          "test-replay",
+		SpawnStrategy: "none",
+		Tiles:         [][]Material{{walkable, walkable, walkable, walkable, walkable}},
+		Interactables: [][]*InteractableDescription{{nil, nil, {Name: "ball", CssClass: "gold", Pushable: true}, nil, nil}},
+	}
+	world := createWorldWithAreasForTesting(t, &testingConfig, area)
+	directory := t.TempDir()
+	world.recorder = createRecorder(directory, "test")
+	world.recorder.rotate(world)
+
+	record := PlayerRecord{Username: "recorded", Team: "fuchsia", StageName: area.Name, Y: 0, X: 0, Health: 100}
+	player := joinPlayerForTesting(t, world, record, &MockConn{})
+	for _, name := range []string{"d", "d"} {
+		press := &PlayerSocketEvent{Token: "secret", Name: name}
+		world.recorder.recordPress(player, press)
+		player.handlePress(press, "")
+	}
+	stage := player.getTileSync().stage
+	if stage.tiles[0][3].interactable == nil {
+		t.Fatal("ball should have been pushed during recording")
+	}
+	seed := stage.seed
+	world.recorder.close()
+
+	// A different initial state proves the recorded snapshot is used
+	stage.tiles[0][3].interactable = nil
+	areas[len(areas)-1].Interactables = nil
+
+	names, _ := filepath.Glob(filepath.Join(directory, "*.jsonl"))
+	if len(names) != 1 {
+		t.Fatalf("expected one recording, got %d", len(names))
+	}
+	contents, _ := os.ReadFile(names[0])
+	if len(contents) == 0 || strings.Contains(string(contents), "secret") {
+		t.Fatal("recording should exist and never contain tokens")
+	}
+	header, events, err := readRecording(names[0])
+	if err != nil || header.Version != RECORDING_FORMAT_VERSION {
+		t.Fatalf("failed to read recording: %v", err)
+	}
+
+	replay := createReplay(&MockConn{}, "")
+	replay.run(events, 0)
+	replayed := replay.players["recorded"]
+	if replayed == nil {
+		t.Fatal("recorded player did not join the replay")
+	}
+	tile := replayed.getTileSync()
+	if tile.x != 2 {
+		t.Errorf("expected replayed player at x 2, got %d", tile.x)
+	}
+	if ball := tile.stage.tiles[0][3].interactable; ball == nil || ball.name != "ball" {
+		t.Error("expected replayed ball at x 3")
+	}
+	if tile.stage.seed != seed {
+		t.Errorf("expected the stage to draw from the recorded seed %d, got %d", seed, tile.stage.seed)
+	}
+	select {
+	case <-replay.world.stopped:
+	default:
+		t.Error("the replay's world should be stopped once the recording ends")
+	}
+}
+
+func TestRecordingPathRejectsTraversal(t *testing.T) {
+	for _, name := range []string{"", "../secret.jsonl", "a/b.jsonl", "notes.txt"} {
+		if _, ok := recordingPath("dir", name); ok {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+	if _, ok := recordingPath("dir", "world-1.jsonl"); !ok {
+		t.Error("expected plain recording name to be accepted")
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type ReloadReport struct {
+	AreaCount       int
+	ChangedAreas    []string
+	RebuiltStages   int
+	MigratedPlayers int
+	MigratedNPCs    int
+}
+
+////////////////////////////////////////////////////////////
+// Admin trigger
+
+func (world *World) postReloadAreas(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	report, err := world.reloadAreasFromFile("areas")
+	world.audit.record(clientIP(r), "reload", "areas", strings.Join(report.ChangedAreas, ", "), err)
+	if err != nil {
+		logger.Error().Err(err).Msg("Area reload rejected")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	io.WriteString(w, fmt.Sprintf("Loaded %d areas. Changed: [%s]. Rebuilt %d stages, migrated %d players and %d npcs.",
+		report.AreaCount, strings.Join(report.ChangedAreas, ", "), report.RebuiltStages, report.MigratedPlayers, report.MigratedNPCs))
+}
+
+////////////////////////////////////////////////////////////
+// Reload
+
+func (world *World) reloadAreasFromFile(filename string) (ReloadReport, error) {
+	jsonData, err := os.ReadFile(fmt.Sprintf("./data/%s.json", filename))
+	if err != nil {
+		return ReloadReport{}, err
+	}
+	var incoming []Area
+	if err := json.Unmarshal(jsonData, &incoming); err != nil {
+		return ReloadReport{}, err
+	}
+	return world.reloadAreas(incoming)
+}
+
+// Nothing is modified unless every area is valid
+func (world *World) reloadAreas(incoming []Area) (ReloadReport, error) {
+	if err := validateAreas(incoming); err != nil {
+		return ReloadReport{}, err
+	}
+
+	areasLock.Lock()
+	changed := changedAreaNames(areas, incoming)
+	areas = incoming
+	areasLock.Unlock()
+
+	report := ReloadReport{AreaCount: len(incoming), ChangedAreas: sortedKeys(changed)}
+	if len(changed) == 0 {
+		return report, nil
+	}
+
+	stale := world.removeStagesByName(changed)
+	report.RebuiltStages = len(stale)
+	if hill, ok := world.gameModes["king-of-the-hill"].(*KingOfTheHill); ok {
+		hill.refreshHill()
+	}
+
+	for _, character := range charactersToMigrate(stale, world.copyOfPlayers(), changed) {
+		if !migrateCharacter(character, changed) {
+			continue
+		}
+		if _, isPlayer := character.(*Player); isPlayer {
+			report.MigratedPlayers++
+		} else {
+			report.MigratedNPCs++
+		}
+	}
+	logger.Info().Msgf("Reloaded areas, changed: %v", report.ChangedAreas)
+	return report, nil
+}
+
+func changedAreaNames(previous, incoming []Area) map[string]struct{} {
+	previousByName := make(map[string]Area, len(previous))
+	for _, area := range previous {
+		previousByName[area.Name] = area
+	}
+	out := make(map[string]struct{})
+	for _, area := range incoming {
+		old, found := previousByName[area.Name]
+		if !found || !reflect.DeepEqual(old, area) {
+			out[area.Name] = struct{}{}
+		}
+		delete(previousByName, area.Name)
+	}
+	for name := range previousByName {
+		out[name] = struct{}{} // Removed
+	}
+	return out
+}
+
+// Stale snapshots are dropped as they may not fit the new layout
+func (world *World) removeStagesByName(names map[string]struct{}) []*Stage {
+	out := make([]*Stage, 0)
+
+	world.wStageMutex.Lock()
+	for key, stage := range world.worldStages {
+		if stage == nil {
+			continue
+		}
+		if _, changed := names[stage.name]; changed {
+			out = append(out, stage)
+			delete(world.worldStages, key)
+		}
+	}
+	world.evictedStages.dropByName(names)
+	world.persistedStages.dropByName(names)
+	world.wStageMutex.Unlock()
+
+	for _, player := range world.copyOfPlayers() {
+		player.pStageMutex.Lock()
+		for key, stage := range player.playerStages {
+			if stage == nil {
+				continue
+			}
+			if _, changed := names[stage.name]; changed {
+				out = append(out, stage)
+				delete(player.playerStages, key)
+			}
+		}
+		player.evictedStages.dropByName(names)
+		player.pStageMutex.Unlock()
+	}
+	return out
+}
+
+// Players on Individual stages are not registered anywhere and are found through their tile
+func charactersToMigrate(stages []*Stage, players []*Player, names map[string]struct{}) []Character {
+	seen := make(map[string]struct{})
+	out := make([]Character, 0)
+	for _, stage := range stages {
+		for y := range stage.tiles {
+			for x := range stage.tiles[y] {
+				tile := stage.tiles[y][x]
+				tile.CharacterMutex.Lock()
+				for id, character := range tile.characterMap {
+					if _, found := seen[id]; !found {
+						seen[id] = struct{}{}
+						out = append(out, character)
+					}
+				}
+				tile.CharacterMutex.Unlock()
+			}
+		}
+	}
+	for _, player := range players {
+		if _, found := seen[player.id]; found {
+			continue
+		}
+		tile := player.getTileSync()
+		if tile == nil {
+			continue
+		}
+		if _, changed := names[tile.stage.name]; changed {
+			seen[player.id] = struct{}{}
+			out = append(out, player)
+		}
+	}
+	return out
+}
+
+func migrateCharacter(character Character, names map[string]struct{}) bool {
+	source := character.getTileSync()
+	if source == nil {
+		return false
+	}
+	if _, changed := names[source.stage.name]; !changed {
+		return false // Already moved on
+	}
+	stage := character.fetchStageSync(source.stage.name)
+	if stage == nil {
+		// Area was removed
+		stage = character.fetchStageSync("clinic")
+		if stage == nil {
+			return false
+		}
+	}
+	dest := nearestWalkableTile(stage, source.y, source.x)
+	if dest == nil {
+		logger.Warn().Msg("No walkable tile to migrate " + character.getName() + " onto stage: " + stage.name)
+		return false
+	}
+	character.transferBetween(source, dest)
+	return true
+}
+
+// Manhattan distance, ties broken in row-major order
+func nearestWalkableTile(stage *Stage, y, x int) *Tile {
+	var out *Tile
+	best := -1
+	for row := range stage.tiles {
+		for col := range stage.tiles[row] {
+			tile := stage.tiles[row][col]
+			if !tile.material.Walkable {
+				continue
+			}
+			distance := abs(row-y) + abs(col-x)
+			if best != -1 && distance >= best {
+				continue
+			}
+			tile.interactableMutex.Lock()
+			blocked := tile.interactable != nil && !tile.interactable.walkable
+			tile.interactableMutex.Unlock()
+			if !blocked {
+				out, best = tile, distance
+			}
+		}
+	}
+	return out
+}
+
+////////////////////////////////////////////////////////////
+// Validate
+
+func validateAreas(incoming []Area) error {
+	byName := make(map[string]Area, len(incoming))
+	for _, area := range incoming {
+		if area.Name == "" {
+			return fmt.Errorf("area with empty name")
+		}
+		if _, duplicate := byName[area.Name]; duplicate {
+			return fmt.Errorf("duplicate area: %s", area.Name)
+		}
+		byName[area.Name] = area
+	}
+	if _, found := byName["clinic"]; !found {
+		return fmt.Errorf("missing default area: clinic")
+	}
+	for _, area := range incoming {
+		if err := validateArea(area, byName); err != nil {
+			return fmt.Errorf("area %s: %w", area.Name, err)
+		}
+	}
+	return nil
+}
+
+// Destinations are checked against the incoming areas, not those being replaced
+func validateArea(area Area, byName map[string]Area) error {
+	if len(area.Tiles) == 0 || len(area.Tiles[0]) == 0 {
+		return fmt.Errorf("no tiles")
+	}
+	for y := range area.Tiles {
+		if len(area.Tiles[y]) != len(area.Tiles[0]) {
+			return fmt.Errorf("row %d has %d tiles, expected %d", y, len(area.Tiles[y]), len(area.Tiles[0]))
+		}
+	}
+	switch area.LoadStrategy {
+	case "", "Team", "Personal", "Individual":
+	default:
+		return fmt.Errorf("unknown load strategy: %s", area.LoadStrategy)
+	}
+	if _, found := spawnActions[area.SpawnStrategy]; !found {
+		return fmt.Errorf("unknown spawn strategy: %s", area.SpawnStrategy)
+	}
+	if len(area.Interactables) > len(area.Tiles) {
+		return fmt.Errorf("interactables exceed tiles")
+	}
+	for y := range area.Interactables {
+		if len(area.Interactables[y]) > len(area.Tiles[y]) {
+			return fmt.Errorf("interactables exceed tiles in row %d", y)
+		}
+	}
+	for _, transport := range area.Transports {
+		if transport.SourceY < 0 || transport.SourceY >= len(area.Tiles) || transport.SourceX < 0 || transport.SourceX >= len(area.Tiles[0]) {
+			return fmt.Errorf("transport source out of bounds: %d,%d", transport.SourceY, transport.SourceX)
+		}
+		destination, found := byName[transport.DestStage]
+		if !found {
+			return fmt.Errorf("transport to unknown area: %s", transport.DestStage)
+		}
+		if transport.DestY < 0 || transport.DestY >= len(destination.Tiles) || transport.DestX < 0 || transport.DestX >= len(destination.Tiles[0]) {
+			return fmt.Errorf("transport destination out of bounds: %s %d,%d", transport.DestStage, transport.DestY, transport.DestX)
+		}
+	}
+	for _, neighbour := range []string{area.North, area.South, area.East, area.West} {
+		if _, found := byName[neighbour]; neighbour != "" && !found {
+			return fmt.Errorf("unknown neighbouring area: %s", neighbour)
+		}
+	}
+	if _, err := compileAreaReactions(area); err != nil {
+		return err
+	}
+	return nil
+}
+
+func sortedKeys[V any](set map[string]V) []string {
+	out := make([]string, 0, len(set))
+	for key := range set {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func reloadTestingAreas(blocked bool) []Area {
+	walkable, wall := Material{Walkable: true}, Material{Walkable: false}
+	last := walkable
+	if blocked {
+		last = wall
+	}
+	return []Area{
+		{Name: "clinic", SpawnStrategy: "none", Tiles: [][]Material{{walkable}}},
+		{Name: "test-reload", SpawnStrategy: "none", Tiles: [][]Material{{walkable, walkable, last}, {wall, wall, wall}}},
+	}
+}
+
+func TestReloadMigratesPlayersToNearestWalkable(t *testing.T) {
+	replaceAreasForTesting(t, reloadTestingAreas(false))
+
+	world := createGameWorld(nil, &testingConfig)
+	player := createTestingPlayer(world, "reload")
+	stage := player.fetchStageSync("test-reload")
+	placePlayerOnStageAt(player, stage, 0, 2)
+
+	report, err := world.reloadAreas(reloadTestingAreas(true))
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if len(report.ChangedAreas) != 1 || report.ChangedAreas[0] != "test-reload" {
+		t.Errorf("expected only test-reload to change, got %v", report.ChangedAreas)
+	}
+	if report.MigratedPlayers != 1 {
+		t.Errorf("expected 1 migrated player, got %d", report.MigratedPlayers)
+	}
+
+	tile := player.getTileSync()
+	if tile.stage == stage || tile.stage.name != "test-reload" {
+		t.Fatal("player should be on the rebuilt stage")
+	}
+	if tile.y != 0 || tile.x != 1 {
+		t.Errorf("expected nearest walkable tile 0,1 got %d,%d", tile.y, tile.x)
+	}
+	if len(stage.tiles[0][2].characterMap) != 0 {
+		t.Error("player should be removed from the stale stage")
+	}
+}
+
+func TestReloadRejectsInvalidAreas(t *testing.T) {
+	replaceAreasForTesting(t, reloadTestingAreas(false))
+	world := createGameWorld(nil, &testingConfig)
+
+	tests := []struct {
+		name   string
+		modify func([]Area) []Area
+	}{
+		{"missing clinic", func(a []Area) []Area { return a[1:] }},
+		{"duplicate", func(a []Area) []Area { return append(a, a[1]) }},
+		{"ragged", func(a []Area) []Area { a[1].Tiles[1] = a[1].Tiles[1][:1]; return a }},
+		{"bad transport", func(a []Area) []Area {
+			a[1].Transports = []Transport{{SourceY: 0, SourceX: 0, DestStage: "nowhere"}}
+			return a
+		}},
+		{"transport out of bounds", func(a []Area) []Area {
+			a[1].Transports = []Transport{{SourceY: 0, SourceX: 0, DestStage: "clinic", DestY: 0, DestX: 3}}
+			return a
+		}},
+		{"unknown neighbour", func(a []Area) []Area { a[1].East = "nowhere"; return a }},
+		{"unknown reactions reference", func(a []Area) []Area {
+			a[1].Interactables = [][]*InteractableDescription{{{Name: "plate", Reactions: "nope"}}}
+			return a
+		}},
+		{"bad reactions", func(a []Area) []Area {
+			a[1].Reactions = map[string][]ReactionDescription{"x": {{ReactsWith: PredicateDescription{Name: "nope"}}}}
+			return a
+		}},
+	}
+	for _, tc := range tests {
+		if _, err := world.reloadAreas(tc.modify(reloadTestingAreas(true))); err == nil {
+			t.Errorf("%s: expected error", tc.name)
+		}
+		if area, _ := areaFromName("test-reload"); len(areaNames()) != 2 || !area.Tiles[0][2].Walkable {
+			t.Fatalf("%s: areas should be unchanged after rejected reload", tc.name)
+		}
+	}
+}
+
+func TestReloadEndpointIsAudited(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "secret")
+	replaceAreasForTesting(t, reloadTestingAreas(false))
+	world := createGameWorld(nil, &testingConfig)
+
+	w := httptest.NewRecorder()
+	world.postReloadAreas(w, httptest.NewRequest(http.MethodPost, "/reload", strings.NewReader("secret=wrong")))
+	if w.Code != http.StatusUnauthorized || len(areaNames()) != 2 {
+		t.Fatalf("expected an unauthorized reload to change nothing, got %d", w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/reload", nil)
+	r.Header.Set("X-Admin-Secret", "secret")
+	w = httptest.NewRecorder()
+	world.postReloadAreas(w, r)
+	entries := world.audit.recent()
+	if w.Code != http.StatusOK || len(entries) != 1 || entries[0].Action != "reload" || entries[0].Error != "" {
+		t.Errorf("expected an audited reload, got %d %+v", w.Code, entries)
+	}
+	if _, ok := areaFromName("clinic"); !ok || len(areaNames()) <= 2 {
+		t.Error("expected the areas from file")
+	}
+}
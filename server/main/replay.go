@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Feeds a recording through a headless world. The viewer sees what the followed player saw.
+type Replay struct {
+	world    *World
+	viewer   WebsocketConnection
+	follow   string // Username, defaults to the first to join
+	players  map[string]*Player
+	previous map[string]string // Last press of each player, for jukes
+	npcs     map[string]*NonPlayer
+}
+
+func createReplay(viewer WebsocketConnection, follow string) *Replay {
+	return &Replay{
+		world:    createGameWorld(nil, &Configuration{serverName: "replay"}),
+		viewer:   viewer,
+		follow:   follow,
+		players:  make(map[string]*Player),
+		previous: make(map[string]string),
+		npcs:     make(map[string]*NonPlayer),
+	}
+}
+
+// Zero speed replays without waiting. The replay's world is stopped once every event is applied.
+func (replay *Replay) run(events []RecordedEvent, speed float64) {
+	defer replay.close()
+	started := time.Now()
+	for _, event := range events {
+		if speed > 0 {
+			due := started.Add(time.Duration(float64(event.Offset)/speed) * time.Millisecond)
+			time.Sleep(time.Until(due))
+		}
+		replay.apply(event)
+	}
+}
+
+func (replay *Replay) close() {
+	for id, npc := range replay.npcs {
+		delete(replay.npcs, id)
+		removeNpc(npc)
+	}
+	replay.world.logoutEveryone(SHUTDOWN_LOGOUT_CONCURRENCY)
+	replay.world.stop()
+}
+
+func (replay *Replay) apply(event RecordedEvent) {
+	switch event.Kind {
+	case recordedStage:
+		if event.Snapshot != nil {
+			replay.world.evictedStages.put(event.Key, event.Snapshot)
+		}
+		replay.world.wStageMutex.Lock()
+		if replay.world.stageSeeds == nil {
+			replay.world.stageSeeds = make(map[string]int64)
+		}
+		replay.world.stageSeeds[event.Key] = event.Seed
+		replay.world.wStageMutex.Unlock()
+	case recordedJoin:
+		replay.join(event)
+	case recordedPress:
+		player, ok := replay.players[event.Id]
+		if !ok || event.Press == nil {
+			return
+		}
+		if !player.handlePressActive(event.Press) {
+			player.handlePress(event.Press, replay.previous[event.Id])
+			replay.previous[event.Id] = event.Press.Name
+		}
+	case recordedLeave:
+		if player, ok := replay.players[event.Id]; ok {
+			delete(replay.players, event.Id)
+			initiateLogout(player)
+		}
+	case recordedNpcSpawn:
+		replay.spawnNpc(event)
+	case recordedNpcMove:
+		npc, ok := replay.npcs[event.Id]
+		if !ok {
+			return
+		}
+		if dest := replayTile(npc, event); dest != nil {
+			npc.transferBetween(npc.getTileSync(), dest)
+		}
+	case recordedNpcPower:
+		if npc, ok := replay.npcs[event.Id]; ok && npc.getTileSync() != nil {
+			activatePowerShape(npc, event.Shape)
+		}
+	case recordedNpcRemove:
+		if npc, ok := replay.npcs[event.Id]; ok {
+			delete(replay.npcs, event.Id)
+			removeNpc(npc)
+		}
+	}
+}
+
+func (replay *Replay) join(event RecordedEvent) {
+	if replay.follow == "" {
+		replay.follow = event.Id
+	}
+	var conn WebsocketConnection = &MockConn{}
+	if event.Id == replay.follow {
+		conn = replay.viewer
+	}
+	record := PlayerRecord{Username: event.Id, Team: event.Team, StageName: event.Stage, Y: event.Y, X: event.X, Health: event.Health, Money: event.Money}
+	player := replay.world.join(createLoginRequest(record), conn)
+	if player == nil {
+		logger.Warn().Msg("Replay failed to join: " + event.Id)
+		return
+	}
+	replay.players[event.Id] = player
+}
+
+func (replay *Replay) spawnNpc(event RecordedEvent) {
+	npc, _ := createNewNPC(replay.world, event.Team)
+	npc.id = event.Id
+	npc.health.Store(event.Health)
+	npc.money.Store(event.Money)
+	tile := replayTile(npc, event)
+	if tile == nil {
+		return
+	}
+	addNPCAndNotifyOthers(npc, tile)
+	replay.npcs[event.Id] = npc
+}
+
+func replayTile(npc *NonPlayer, event RecordedEvent) *Tile {
+	stage := npc.fetchStageSync(event.Stage)
+	if !validCoordinate(event.Y, event.X, stage) {
+		return nil
+	}
+	return stage.tiles[event.Y][event.X]
+}
+
+////////////////////////////////////////////////////////////
+// Viewer
+
+// First message: {"token": <admin password>, "recording": <file name>, "follow": <username>, "speed": "1"}
+func (world *World) replayHandler(w http.ResponseWriter, r *http.Request) {
+	if os.Getenv("ADMIN_PASSWORD") == "" {
+		http.Error(w, "Disabled", http.StatusNotFound)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error().Err(err).Msg("Error:")
+		return
+	}
+	defer conn.Close()
+
+	_, bytes, err := conn.ReadMessage()
+	if err != nil {
+		return
+	}
+	var request struct {
+		Token     string `json:"token"`
+		Recording string `json:"recording"`
+		Follow    string `json:"follow"`
+		Speed     string `json:"speed"`
+	}
+	if err := json.Unmarshal(bytes, &request); err != nil || !secretMatches(request.Token, "ADMIN_PASSWORD") {
+		logger.Warn().Msg("Unauthorized replay request from: " + clientIP(r))
+		return
+	}
+	world.audit.record(clientIP(r), "replay", request.Recording, request.Follow, nil)
+	path, ok := recordingPath(RECORDINGS_DIRECTORY, request.Recording)
+	if !ok {
+		sendUnableToJoinMessage(conn, "Invalid recording.")
+		return
+	}
+	header, events, err := readRecording(path)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to read recording: " + request.Recording)
+		sendUnableToJoinMessage(conn, "Unable to read recording.")
+		return
+	}
+	speed, err := strconv.ParseFloat(request.Speed, 64)
+	if err != nil || speed <= 0 {
+		speed = 1
+	}
+	logger.Info().Msgf("Replaying %s from %s (%d events)", request.Recording, header.ServerName, len(events))
+	createReplay(conn, request.Follow).run(events, speed)
+}
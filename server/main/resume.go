@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// A disconnected player left on their tile, intangible, until resumed or expired
+type ParkedPlayer struct {
+	player *Player
+	expiry *time.Timer
+}
+
+// Replaces the login token so that a reconnecting socket presents the resume token
+const resumeTokenInput = `<input id="token" ws-send hx-trigger="htmx:wsOpen from:#controls" type="hidden" name="token" value="%s" />`
+
+func sendResumeToken(player *Player) {
+	if player.world.config.resumeGrace <= 0 {
+		return
+	}
+	player.updates <- player.render(fmt.Sprintf(resumeTokenInput, player.resumeToken), MessageEvent{Type: "resume", Text: player.resumeToken})
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+////////////////////////////////////////////////////////////
+// Park
+
+// False when the player should be logged out instead
+func (world *World) park(player *Player) bool {
+	grace := world.config.resumeGrace
+	if grace <= 0 || player.quitting.Load() || player.resumeToken == "" {
+		return false
+	}
+	player.tangibilityLock.Lock()
+	defer player.tangibilityLock.Unlock()
+	if !player.tangible {
+		return false
+	}
+	player.tangible = false
+
+	token := player.resumeToken
+	world.parkedMutex.Lock()
+	defer world.parkedMutex.Unlock()
+	world.parkedPlayers[token] = &ParkedPlayer{
+		player: player,
+		expiry: time.AfterFunc(grace, func() { world.expireParked(token) }),
+	}
+	logger.Info().Msg("Parked: " + player.username)
+	return true
+}
+
+func (world *World) expireParked(token string) {
+	parked := world.unparkByToken(token)
+	if parked == nil {
+		return // Resumed
+	}
+	logger.Info().Msg("Resume window expired: " + parked.player.username)
+	initiateLogout(parked.player)
+}
+
+func (player *Player) isParked() bool {
+	player.world.parkedMutex.Lock()
+	defer player.world.parkedMutex.Unlock()
+	parked, ok := player.world.parkedPlayers[player.resumeToken]
+	return ok && parked.player == player
+}
+
+// Whoever removes a parked player from the map owns it
+func (world *World) unparkByToken(token string) *ParkedPlayer {
+	world.parkedMutex.Lock()
+	defer world.parkedMutex.Unlock()
+	parked, ok := world.parkedPlayers[token]
+	if !ok {
+		return nil
+	}
+	delete(world.parkedPlayers, token)
+	parked.expiry.Stop()
+	return parked
+}
+
+// A fresh login takes over a parked player rather than waiting out the window
+func (world *World) unparkByUsername(username string) *ParkedPlayer {
+	world.parkedMutex.Lock()
+	token := ""
+	for key, parked := range world.parkedPlayers {
+		if parked.player.username == username {
+			token = key
+		}
+	}
+	world.parkedMutex.Unlock()
+	if token == "" {
+		return nil
+	}
+	return world.unparkByToken(token)
+}
+
+////////////////////////////////////////////////////////////
+// Resume
+
+func (world *World) resume(parked *ParkedPlayer, conn WebsocketConnection) *Player {
+	player := parked.player
+	attachPlayer(conn, player)
+	if !sendInitialScreen(conn, initialScreen(conn, player.camera.height, player.camera.width)) {
+		initiateLogout(player)
+		return nil
+	}
+
+	player.connLock.Lock()
+	player.conn.Close()
+	player.conn = conn
+	player.connLock.Unlock()
+	player.sessionTimeOutViolations.Store(0)
+	world.parkedMutex.Lock()
+	player.resumeToken = createRandomToken() // Read under parkedMutex by isParked
+	world.parkedMutex.Unlock()
+	player.connected.Store(true)
+
+	player.tangibilityLock.Lock()
+	player.tangible = true
+	if tile := player.getTileSync(); tile != nil {
+		player.camera.drop()
+		player.camera.setView(tile.y, tile.x, tile.stage)
+		updateEntireExistingScreen(player)
+		player.updatePlayerHud()
+	}
+	player.tangibilityLock.Unlock()
+
+	sendResumeToken(player)
+	logger.Info().Msg("Resumed: " + player.username)
+	return player
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func createResumeTestingWorld(t *testing.T, grace time.Duration) *World {
+	area := Area{Name: "test-resume", SpawnStrategy: "none", Tiles: walkableTilesForTesting(1, 3)}
+	return createWorldWithAreasForTesting(t, &Configuration{serverName: "test", resumeGrace: grace}, area)
+}
+
+func joinResumeTestingPlayer(t *testing.T, world *World, conn WebsocketConnection) *Player {
+	record := PlayerRecord{Username: "resumed", Team: "fuchsia", StageName: "test-resume", Y: 0, X: 1, Health: 100}
+	return joinPlayerForTesting(t, world, record, conn)
+}
+
+func TestParkedPlayerResumesWithToken(t *testing.T) {
+	world := createResumeTestingWorld(t, time.Minute)
+	player := joinResumeTestingPlayer(t, world, &MockConn{})
+	player.killstreak.Store(3)
+	token := player.resumeToken
+
+	if !world.park(player) || !player.isParked() {
+		t.Fatal("expected player to be parked")
+	}
+	enemy, _ := createNewNPC(world, "enemy")
+	if player.takeDamageFrom(enemy, 10) || player.health.Load() != 100 {
+		t.Error("parked players should be intangible")
+	}
+	if tile := player.getTileSync(); tile == nil || tile.x != 1 {
+		t.Fatal("parked player should stay on their tile")
+	}
+
+	parked := world.unparkByToken(token)
+	if parked == nil || world.unparkByToken(token) != nil {
+		t.Fatal("resume token should work exactly once")
+	}
+	conn := &CapturingConn{}
+	if world.resume(parked, conn) != player {
+		t.Fatal("expected to reattach the same player")
+	}
+	if player.isParked() || !player.tangible || player.resumeToken == token {
+		t.Error("resumed player should be tangible with a fresh token")
+	}
+	if player.killstreak.Load() != 3 {
+		t.Error("resumed player should keep their killstreak")
+	}
+	time.Sleep(60 * time.Millisecond)
+	written := conn.written()
+	if !strings.Contains(written, `id="set"`) || !strings.Contains(written, player.resumeToken) {
+		t.Error("resumed connection should receive the screen and the new token")
+	}
+}
+
+func TestParkedPlayerLogsOutWhenWindowExpires(t *testing.T) {
+	world := createResumeTestingWorld(t, 10*time.Millisecond)
+	player := joinResumeTestingPlayer(t, world, &MockConn{})
+	token := player.resumeToken
+	if !world.park(player) {
+		t.Fatal("expected player to be parked")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if world.getPlayerByUsername("resumed") != nil || world.unparkByToken(token) != nil {
+		t.Error("expired player should have logged out")
+	}
+}
+
+func TestFreshLoginTakesOverParkedPlayer(t *testing.T) {
+	world := createResumeTestingWorld(t, time.Minute)
+	player := joinResumeTestingPlayer(t, world, &MockConn{})
+	world.park(player)
+	if joinResumeTestingPlayer(t, world, &MockConn{}) != player {
+		t.Error("login should reattach the parked player")
+	}
+}
+
+func TestQuittingPlayersAreNotParked(t *testing.T) {
+	world := createResumeTestingWorld(t, time.Minute)
+	player := joinResumeTestingPlayer(t, world, &MockConn{})
+	player.quitting.Store(true)
+	if world.park(player) {
+		t.Error("quitting players should log out")
+	}
+	if createResumeTestingWorld(t, 0).park(player) {
+		t.Error("resuming should be disabled without a grace window")
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+)
+
+const (
+	RETENTION_INTERVAL_IN_MIN = 60
+	ROLLUP_DAY_FORMAT         = "2006-01-02" // Days are in UTC
+)
+
+// Events counted per day, kept after the events themselves have expired
+type DailyEventRecord struct {
+	Day       string `bson:"day"`
+	Type      string `bson:"eventtype"`
+	Owner     string `bson:"owner"`
+	StageName string `bson:"stagename"`
+	Team      string `bson:"team,omitempty"`
+	Npc       bool   `bson:"npc,omitempty"`
+	Count     int64  `bson:"count"`
+	Amount    int64  `bson:"amount,omitempty"` // Sum of purchase prices
+}
+
+func (record DailyEventRecord) key() string {
+	key := record.Day + "/" + record.Type + "/" + record.Owner + "/" + record.StageName + "/" + record.Team
+	if record.Npc {
+		key += "/npc" // Keys of earlier rollups are unchanged
+	}
+	return key
+}
+
+type RetentionPolicy struct {
+	GuestTTL       time.Duration // Since last activity, zero keeps guests forever
+	EventRetention time.Duration // Zero keeps events forever
+	DryRun         bool
+}
+
+func retentionPolicyFromConfig(config *Configuration) RetentionPolicy {
+	return RetentionPolicy{GuestTTL: config.guestRetention, EventRetention: config.eventRetention, DryRun: config.retentionDryRun}
+}
+
+func (policy RetentionPolicy) enabled() bool {
+	return policy.GuestTTL > 0 || policy.EventRetention > 0
+}
+
+type RetentionReport struct {
+	DryRun  bool
+	Guests  int64 // Removed, or would be in a dry run
+	Events  int64 // Rolled up and removed
+	Rollups int   // Daily aggregates written to
+}
+
+func (report RetentionReport) String() string {
+	prefix := "Retention"
+	if report.DryRun {
+		prefix = "Retention (dry run)"
+	}
+	return fmt.Sprintf("%s - guests: %d events: %d daily rollups: %d", prefix, report.Guests, report.Events, report.Rollups)
+}
+
+// A guest is active when created, on login and on logout
+func lastActivity(record PlayerRecord) time.Time {
+	latest := record.LastLogin
+	if record.LastLogout.After(latest) {
+		latest = record.LastLogout
+	}
+	if record.GuestCreateTime != nil && record.GuestCreateTime.After(latest) {
+		latest = *record.GuestCreateTime
+	}
+	return latest
+}
+
+func inactiveGuest(record PlayerRecord, before time.Time) bool {
+	return record.GuestCreateTime != nil && lastActivity(record).Before(before)
+}
+
+func rollupDay(t time.Time) string {
+	return t.UTC().Format(ROLLUP_DAY_FORMAT)
+}
+
+////////////////////////////////////////////////////////////
+// Run
+
+// Events are rolled up before they are removed, only those marked expired at the start of the run.
+// Removal failing after the rollup is saved means the same events are counted again on the next run.
+func runRetention(ctx context.Context, db RetentionStore, policy RetentionPolicy, now time.Time) (RetentionReport, error) {
+	report := RetentionReport{DryRun: policy.DryRun}
+	if policy.GuestTTL > 0 {
+		before := now.Add(-policy.GuestTTL)
+		var err error
+		if policy.DryRun {
+			report.Guests, err = db.countInactiveGuests(ctx, before)
+		} else {
+			report.Guests, err = db.deleteInactiveGuests(ctx, before)
+		}
+		if err != nil {
+			return report, fmt.Errorf("guests: %w", err)
+		}
+	}
+	if policy.EventRetention > 0 {
+		before := now.Add(-policy.EventRetention)
+		rollups, err := expiredEventRollups(ctx, db, before, policy.DryRun)
+		if err != nil {
+			return report, fmt.Errorf("rollup: %w", err)
+		}
+		report.Rollups = len(rollups)
+		for _, rollup := range rollups {
+			report.Events += rollup.Count
+		}
+		if policy.DryRun || len(rollups) == 0 {
+			return report, nil
+		}
+		if err := db.saveDailyEvents(ctx, rollups); err != nil {
+			return report, fmt.Errorf("rollup: %w", err)
+		}
+		if report.Events, err = db.deleteExpiredEvents(ctx); err != nil {
+			return report, fmt.Errorf("events: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// Events left marked by an earlier run that failed are rolled up again with the new ones
+func expiredEventRollups(ctx context.Context, db RetentionStore, before time.Time, dryRun bool) ([]DailyEventRecord, error) {
+	if dryRun {
+		return db.rollupEventsBefore(ctx, before)
+	}
+	if _, err := db.expireEventsBefore(ctx, before); err != nil {
+		return nil, err
+	}
+	return db.rollupExpiredEvents(ctx)
+}
+
+func periodicRetention(db RetentionStore, policy RetentionPolicy) {
+	ticker := time.NewTicker(time.Duration(RETENTION_INTERVAL_IN_MIN) * time.Minute)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		report, err := runRetention(context.TODO(), db, policy, now)
+		if err != nil {
+			logger.Error().Err(err).Msg(report.String())
+			continue
+		}
+		logger.Info().Msg(report.String())
+	}
+}
+
+////////////////////////////////////////////////////////////
+// CLI
+//
+//	./main cleanup -dry-run -guest-ttl 168h -event-retention 720h
+
+// Flags default to the configured policy
+func runCleanupCommand(db RetentionStore, config *Configuration, args []string) error {
+	policy := retentionPolicyFromConfig(config)
+	flags := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	flags.DurationVar(&policy.GuestTTL, "guest-ttl", policy.GuestTTL, "remove guests inactive for longer, 0 keeps them")
+	flags.DurationVar(&policy.EventRetention, "event-retention", policy.EventRetention, "roll up and remove older events, 0 keeps them")
+	flags.BoolVar(&policy.DryRun, "dry-run", policy.DryRun, "report without removing anything")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	report, err := runRetention(context.Background(), db, policy, time.Now())
+	fmt.Println(report.String())
+	return err
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRetentionRemovesInactiveGuests(t *testing.T) {
+	db := createMemoryStore()
+	now := time.Now()
+	old := now.Add(-10 * 24 * time.Hour)
+	recent := now.Add(-time.Hour)
+	db.InsertPlayerRecord(PlayerRecord{Username: "guest:old", GuestCreateTime: &old, LastLogout: old})
+	db.InsertPlayerRecord(PlayerRecord{Username: "guest:never-played", GuestCreateTime: &old})
+	db.InsertPlayerRecord(PlayerRecord{Username: "guest:returning", GuestCreateTime: &old, LastLogin: recent})
+	db.InsertPlayerRecord(PlayerRecord{Username: "guest:new", GuestCreateTime: &recent})
+	db.InsertPlayerRecord(PlayerRecord{Username: "member", LastLogout: old})
+
+	policy := RetentionPolicy{GuestTTL: 7 * 24 * time.Hour, DryRun: true}
+	report, err := runRetention(context.Background(), db, policy, now)
+	if err != nil || report.Guests != 2 || len(db.players) != 5 {
+		t.Fatalf("a dry run should only count, got %v %v", report, err)
+	}
+
+	policy.DryRun = false
+	report, err = runRetention(context.Background(), db, policy, now)
+	if err != nil || report.Guests != 2 {
+		t.Fatalf("expected two guests removed, got %v %v", report, err)
+	}
+	for _, username := range []string{"guest:returning", "guest:new", "member"} {
+		if !db.foundUsername(username) {
+			t.Errorf("%s should be kept", username)
+		}
+	}
+}
+
+func TestRetentionRollsUpEvents(t *testing.T) {
+	db, err := openFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC)
+	day := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, event := range []EventRecord{
+		{Owner: "alice", Type: EVENT_KILL, Created: day, StageName: "arena"},
+		{Owner: "alice", Type: EVENT_KILL, Created: day.Add(time.Hour), StageName: "arena"},
+		{Owner: "alice", Type: EVENT_PURCHASE, Created: day, StageName: "shop", Amount: 100},
+		{Owner: "bob", Type: EVENT_KILL, Created: day.Add(24 * time.Hour), StageName: "arena"},
+		{Owner: "bob", Type: EVENT_KILL, Created: now.Add(-time.Hour), StageName: "arena"},
+	} {
+		db.appendEvent(event)
+	}
+
+	policy := RetentionPolicy{EventRetention: 14 * 24 * time.Hour}
+	report, err := runRetention(context.Background(), db, policy, now)
+	if err != nil || report.Events != 4 || report.Rollups != 3 {
+		t.Fatalf("expected four events in three rollups, got %v %v", report, err)
+	}
+
+	reopened, err := openFileStore(db.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.events) != 1 || reopened.events[0].Owner != "bob" {
+		t.Errorf("only the recent event should be kept, got %v", reopened.events)
+	}
+	kills := reopened.daily[DailyEventRecord{Day: "2026-03-01", Type: EVENT_KILL, Owner: "alice", StageName: "arena"}.key()]
+	purchases := reopened.daily[DailyEventRecord{Day: "2026-03-01", Type: EVENT_PURCHASE, Owner: "alice", StageName: "shop"}.key()]
+	if kills.Count != 2 || purchases.Count != 1 || purchases.Amount != 100 {
+		t.Errorf("unexpected rollups %v", reopened.daily)
+	}
+
+	// Rolled into the same day again
+	reopened.appendEvent(EventRecord{Owner: "alice", Type: EVENT_KILL, Created: day, StageName: "arena"})
+	if _, err := runRetention(context.Background(), reopened, policy, now); err != nil {
+		t.Fatal(err)
+	}
+	if kills := reopened.daily[kills.key()]; kills.Count != 3 {
+		t.Errorf("expected counts to be added to the day, got %d", kills.Count)
+	}
+}
+
+// An event saved late by a world, with the time it happened
+type lateEventStore struct {
+	*FileStore
+	late EventRecord
+}
+
+func (db *lateEventStore) saveDailyEvents(ctx context.Context, records []DailyEventRecord) error {
+	db.appendEvent(db.late)
+	return db.FileStore.saveDailyEvents(ctx, records)
+}
+
+func TestRetentionDeletesOnlyRolledUpEvents(t *testing.T) {
+	now := time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC)
+	day := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	db := &lateEventStore{FileStore: createMemoryStore(), late: EventRecord{Owner: "bob", Type: EVENT_KILL, Created: day}}
+	db.appendEvent(EventRecord{Owner: "alice", Type: EVENT_KILL, Created: day})
+
+	policy := RetentionPolicy{EventRetention: 14 * 24 * time.Hour}
+	report, err := runRetention(context.Background(), db, policy, now)
+	if err != nil || report.Events != 1 || len(db.events) != 1 || db.events[0].Owner != "bob" {
+		t.Fatalf("the late event should be kept for the next run, got %v %v %v", report, err, db.events)
+	}
+	if _, err := runRetention(context.Background(), db.FileStore, policy, now); err != nil || len(db.events) != 0 || len(db.daily) != 2 {
+		t.Errorf("expected the late event rolled up on the next run, got %v %v", db.daily, err)
+	}
+}
+
+func TestCleanupCommandFlags(t *testing.T) {
+	db := createMemoryStore()
+	old := time.Now().Add(-48 * time.Hour)
+	db.InsertPlayerRecord(PlayerRecord{Username: "guest:old", GuestCreateTime: &old})
+	config := Configuration{guestRetention: 24 * time.Hour}
+
+	if err := runCleanupCommand(db, &config, []string{"-dry-run"}); err != nil || !db.foundUsername("guest:old") {
+		t.Errorf("a dry run should keep the guest, %v", err)
+	}
+	if err := runCleanupCommand(db, &config, []string{"-guest-ttl", "72h"}); err != nil || !db.foundUsername("guest:old") {
+		t.Errorf("the flag should override the configured ttl, %v", err)
+	}
+	if err := runCleanupCommand(db, &config, nil); err != nil || db.foundUsername("guest:old") {
+		t.Errorf("the configured ttl should remove the guest, %v", err)
+	}
+	if runCleanupCommand(db, &config, []string{"-unknown"}) == nil {
+		t.Error("unknown flags should be rejected")
+	}
+}
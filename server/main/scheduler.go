@@ -0,0 +1,295 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Zero disables stage schedulers - timed effects then use a goroutine each
+var stageTickInterval time.Duration
+
+// Advances at a fixed tick while tasks are pending. Tile updates made by the tick's tasks are batched per zone.
+type Scheduler struct {
+	sync.Mutex
+	tick      time.Duration
+	current   uint64
+	tasks     TaskHeap
+	running   bool
+	paused    bool
+	advancing sync.Mutex // One tick at a time, whether from run or step
+}
+
+type ScheduledTask struct {
+	due      uint64
+	interval uint64                                    // Zero for one-shot tasks
+	action   func(batch *UpdateBatch) (continues bool) // Ignored for one-shot tasks
+	ctx      context.Context                           // Optional
+	sequence uint64                                    // Tasks due on the same tick run in order of scheduling
+}
+
+// Given to each of the tick's tasks, which pass it on to the tile updates they make.
+// Other updates to the stage are sent as usual.
+type UpdateBatch struct {
+	sync.Mutex
+	closed  bool // Once flushed, later updates are sent as usual
+	zones   []*CameraZone
+	updates map[*CameraZone][]string
+}
+
+func createScheduler(tick time.Duration) *Scheduler {
+	return &Scheduler{tick: tick}
+}
+
+////////////////////////////////////////////////////////////
+// Scheduling
+
+func (s *Scheduler) after(delay time.Duration, action func(batch *UpdateBatch)) {
+	s.push(&ScheduledTask{due: s.ticksFor(delay), action: func(batch *UpdateBatch) bool { action(batch); return false }})
+}
+
+// Repeats until the action returns false or ctx is cancelled
+func (s *Scheduler) every(interval time.Duration, ctx context.Context, action func(batch *UpdateBatch) bool) {
+	ticks := s.ticksFor(interval)
+	s.push(&ScheduledTask{due: ticks, interval: ticks, action: action, ctx: ctx})
+}
+
+func (s *Scheduler) ticksFor(delay time.Duration) uint64 {
+	ticks := uint64((delay + s.tick - 1) / s.tick)
+	if ticks == 0 {
+		return 1
+	}
+	return ticks
+}
+
+func (s *Scheduler) push(task *ScheduledTask) {
+	s.Lock()
+	defer s.Unlock()
+	task.due += s.current
+	task.sequence = s.tasks.nextSequence()
+	heap.Push(&s.tasks, task)
+	if !s.running {
+		s.running = true
+		go s.run()
+	}
+}
+
+func (s *Scheduler) pending() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.tasks.Len()
+}
+
+////////////////////////////////////////////////////////////
+// Loop
+
+// Exits once no tasks remain, restarted by push
+func (s *Scheduler) run() {
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.Lock()
+		if s.tasks.Len() == 0 {
+			s.running = false
+			s.Unlock()
+			return
+		}
+		paused := s.paused
+		s.Unlock()
+		if !paused {
+			s.advance()
+		}
+	}
+}
+
+func (s *Scheduler) advance() {
+	s.advancing.Lock()
+	defer s.advancing.Unlock()
+	s.Lock()
+	s.current++
+	due := make([]*ScheduledTask, 0)
+	for s.tasks.Len() > 0 && s.tasks.items[0].due <= s.current {
+		due = append(due, heap.Pop(&s.tasks).(*ScheduledTask))
+	}
+	s.Unlock()
+
+	batch := &UpdateBatch{}
+	for _, task := range due {
+		if task.ctx != nil && task.ctx.Err() != nil {
+			continue
+		}
+		if task.action(batch) && task.interval > 0 {
+			task.due = task.interval
+			s.push(task)
+		}
+	}
+	batch.flush()
+}
+
+func (s *Scheduler) pause() {
+	s.Lock()
+	defer s.Unlock()
+	s.paused = true
+}
+
+func (s *Scheduler) resume() {
+	s.Lock()
+	defer s.Unlock()
+	s.paused = false
+}
+
+// Advances one tick, intended for paused schedulers
+func (s *Scheduler) step() {
+	s.advance()
+}
+
+////////////////////////////////////////////////////////////
+// Batching
+
+// Returns false for no batch or one already flushed, the caller sends the update itself
+func (batch *UpdateBatch) add(zone *CameraZone, update string) bool {
+	if batch == nil {
+		return false
+	}
+	batch.Lock()
+	defer batch.Unlock()
+	if batch.closed {
+		return false
+	}
+	if batch.updates == nil {
+		batch.updates = make(map[*CameraZone][]string)
+	}
+	if _, found := batch.updates[zone]; !found {
+		batch.zones = append(batch.zones, zone)
+	}
+	batch.updates[zone] = append(batch.updates[zone], update)
+	return true
+}
+
+// Sent by the tick after the batch is closed, its later updates cannot overtake the batch
+func (batch *UpdateBatch) flush() {
+	batch.Lock()
+	zones, updates := batch.zones, batch.updates
+	batch.closed = true
+	batch.zones = nil
+	batch.updates = nil
+	batch.Unlock()
+
+	for _, zone := range zones {
+		zone.updateAll(strings.Join(updates[zone], ""))
+	}
+}
+
+////////////////////////////////////////////////////////////
+// Task Heap
+
+type TaskHeap struct {
+	items    []*ScheduledTask
+	sequence uint64
+}
+
+func (h *TaskHeap) nextSequence() uint64 {
+	h.sequence++
+	return h.sequence
+}
+
+func (h TaskHeap) Len() int { return len(h.items) }
+
+func (h TaskHeap) Less(i, j int) bool {
+	if h.items[i].due == h.items[j].due {
+		return h.items[i].sequence < h.items[j].sequence
+	}
+	return h.items[i].due < h.items[j].due
+}
+
+func (h TaskHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *TaskHeap) Push(x any) {
+	h.items = append(h.items, x.(*ScheduledTask))
+}
+
+func (h *TaskHeap) Pop() any {
+	old := h.items
+	n := len(old)
+	item := old[n-1]
+	h.items = old[:n-1]
+	return item
+}
+
+////////////////////////////////////////////////////////////
+// Helpers
+
+// Falls back to a goroutine when the stage has no scheduler, there is then no batch
+func scheduleAfter(stage *Stage, delay time.Duration, action func(batch *UpdateBatch)) {
+	if stage == nil || stage.scheduler == nil {
+		time.AfterFunc(delay, func() { action(nil) })
+		return
+	}
+	stage.scheduler.after(delay, action)
+}
+
+// Follows the npc across stages. The npc holds the tick's batch while it acts.
+func scheduleNpcAction(npc *NonPlayer, ctx context.Context, interval time.Duration, action func(*NonPlayer)) {
+	tile := npc.getTileSync()
+	if tile == nil || tile.stage.scheduler == nil {
+		go doAtIntervalUntilTermination(npc, ctx, int(interval/time.Millisecond), action)
+		return
+	}
+	stage := tile.stage
+	stage.scheduler.every(interval, ctx, func(batch *UpdateBatch) bool {
+		npc.batch.Store(batch)
+		action(npc)
+		npc.batch.Store(nil)
+		current := npc.getTileSync()
+		if current == nil {
+			return false
+		}
+		if current.stage != stage {
+			scheduleNpcAction(npc, ctx, interval, action)
+			return false
+		}
+		return true
+	})
+}
+
+////////////////////////////////////////////////////////////
+// Debugging
+
+func (world *World) postScheduler(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(w, r) {
+		return
+	}
+	props, ok := requestToProperties(r)
+	if !ok || r.Method != http.MethodPost {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	world.wStageMutex.Lock()
+	stage := world.worldStages[props["stagename"]]
+	world.wStageMutex.Unlock()
+	if stage == nil || stage.scheduler == nil {
+		world.audit.record(clientIP(r), "scheduler", props["stagename"], props["action"], errors.New("no scheduler for stage"))
+		http.Error(w, "No scheduler for stage", http.StatusNotFound)
+		return
+	}
+	switch props["action"] {
+	case "pause":
+		stage.scheduler.pause()
+	case "resume":
+		stage.scheduler.resume()
+	case "step":
+		stage.scheduler.step()
+	default:
+		world.audit.record(clientIP(r), "scheduler", stage.name, props["action"], errors.New("unknown action"))
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+	world.audit.record(clientIP(r), "scheduler", stage.name, props["action"], nil)
+	io.WriteString(w, fmt.Sprintf("%s: %s (pending %d)", stage.name, props["action"], stage.scheduler.pending()))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerStepRunsDueTasksInOrder(t *testing.T) {
+	scheduler := createScheduler(10 * time.Millisecond)
+	scheduler.pause()
+
+	ran := make([]string, 0)
+	scheduler.after(20*time.Millisecond, func(*UpdateBatch) { ran = append(ran, "second") })
+	scheduler.after(5*time.Millisecond, func(*UpdateBatch) { ran = append(ran, "first") })
+	scheduler.after(15*time.Millisecond, func(*UpdateBatch) { ran = append(ran, "also-second") })
+
+	scheduler.step()
+	if len(ran) != 1 || ran[0] != "first" {
+		t.Fatalf("expected only first task after one step, got %v", ran)
+	}
+	scheduler.step()
+	if len(ran) != 3 || ran[1] != "second" || ran[2] != "also-second" {
+		t.Fatalf("expected tasks due on the same tick in scheduling order, got %v", ran)
+	}
+	if scheduler.pending() != 0 {
+		t.Errorf("expected no pending tasks, got %d", scheduler.pending())
+	}
+}
+
+func TestSchedulerRepeatsUntilCancelled(t *testing.T) {
+	scheduler := createScheduler(10 * time.Millisecond)
+	scheduler.pause()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	count := 0
+	scheduler.every(20*time.Millisecond, ctx, func(*UpdateBatch) bool { count++; return true })
+
+	for range 6 {
+		scheduler.step()
+	}
+	if count != 3 {
+		t.Errorf("expected 3 runs in 6 ticks, got %d", count)
+	}
+	cancel()
+	scheduler.step()
+	scheduler.step()
+	if count != 3 {
+		t.Errorf("expected no runs after cancel, got %d", count)
+	}
+	if scheduler.pending() != 0 {
+		t.Errorf("cancelled task should be dropped, got %d pending", scheduler.pending())
+	}
+}
+
+func TestSchedulerRunsWhileResumed(t *testing.T) {
+	scheduler := createScheduler(time.Millisecond)
+	done := make(chan struct{})
+	scheduler.after(5*time.Millisecond, func(*UpdateBatch) { close(done) })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("task did not run")
+	}
+}
+
+func TestSchedulerStepWaitsForRunningTick(t *testing.T) {
+	scheduler := createScheduler(time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var inTick, overlaps atomic.Int32
+	scheduler.every(time.Millisecond, ctx, func(*UpdateBatch) bool {
+		if inTick.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		time.Sleep(time.Millisecond)
+		inTick.Add(-1)
+		return true
+	})
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				scheduler.step()
+			}
+		}()
+	}
+	wg.Wait()
+	if overlaps.Load() != 0 {
+		t.Errorf("ticks overlapped %d times", overlaps.Load())
+	}
+}
+
+func TestSchedulerBatchesTileUpdatesPerZone(t *testing.T) {
+	previousTick := stageTickInterval
+	defer func() { stageTickInterval = previousTick }()
+	stageTickInterval = time.Hour
+
+	walkable := Material{Walkable: true}
+	stage := createStageFromArea(Area{Name: "test-scheduler", SpawnStrategy: "none", Tiles: [][]Material{{walkable, walkable}}})
+	if stage.scheduler == nil {
+		t.Fatal("expected stage scheduler")
+	}
+	outgoing := make(chan []byte, 10)
+	zone := stage.tiles[0][0].primaryZone
+	zone.activeCameras[&Camera{outgoing: outgoing}] = struct{}{}
+
+	stage.scheduler.pause()
+	var held *UpdateBatch
+	stage.scheduler.after(time.Millisecond, func(batch *UpdateBatch) {
+		held = batch
+		stage.tiles[0][0].updateAllIn(batch, "a")
+		stage.tiles[0][1].updateAllIn(batch, "b")
+		if len(outgoing) != 0 {
+			t.Error("updates should be held until the end of the tick")
+		}
+		elsewhere := make(chan struct{})
+		go func() {
+			stage.tiles[0][1].updateAll("x") // e.g. a player moving during the tick
+			close(elsewhere)
+		}()
+		<-elsewhere
+		if len(outgoing) != 1 || string(<-outgoing) != "x" {
+			t.Error("updates not made by the tick's tasks should be sent immediately")
+		}
+	})
+	stage.scheduler.step()
+
+	if len(outgoing) != 1 {
+		t.Fatalf("expected a single batched update, got %d", len(outgoing))
+	}
+	if update := string(<-outgoing); update != "ab" {
+		t.Errorf("expected updates in order, got %q", update)
+	}
+
+	stage.tiles[0][0].updateAllIn(held, "c") // e.g. from a goroutine started by the task
+	if len(outgoing) != 1 {
+		t.Error("updates after the tick should be sent immediately")
+	}
+}
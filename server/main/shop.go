@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"sync"
+)
+
+const (
+	SHOP_BOOSTS = "boosts"
+	SHOP_POWER  = "power"
+	SHOP_HAT    = "hat"
+)
+
+var (
+	errInsufficientFunds = errors.New("not enough money")
+	errAlreadyOwned      = errors.New("already owned")
+)
+
+// Prices and stock come from ./data/shop.json when present
+type ShopItem struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Kind     string `json:"kind"` // SHOP_BOOSTS, SHOP_POWER or SHOP_HAT
+	Price    int64  `json:"price"`
+	Quantity int    `json:"quantity"` // Boosts or powers per purchase, zero defaults to one
+	Shape    string `json:"shape"`    // Key of shopShapes for SHOP_POWER
+	Hat      string `json:"hat"`      // Key of HAT_NAME_TO_TRIM for SHOP_HAT
+}
+
+type ShopCatalog struct {
+	sync.RWMutex
+	items []ShopItem
+	byId  map[string]ShopItem
+}
+
+var shopShapes = map[string][][2]int{
+	"grid3x3":   grid3x3,
+	"grid5x5":   grid5x5,
+	"grid7x7":   grid7x7,
+	"grid9x9":   grid9x9,
+	"cross":     cross(),
+	"x":         x(),
+	"jumpCross": jumpCross(),
+}
+
+var defaultShopItems = []ShopItem{
+	{Id: "boosts-10", Name: "10 Boosts", Kind: SHOP_BOOSTS, Price: 100, Quantity: 10},
+	{Id: "power-jump-cross", Name: "Power: Jump Cross", Kind: SHOP_POWER, Price: 200, Shape: "jumpCross"},
+	{Id: "power-grid5x5", Name: "Power: 5x5", Kind: SHOP_POWER, Price: 300, Shape: "grid5x5"},
+	{Id: "power-grid9x9", Name: "Power: 9x9", Kind: SHOP_POWER, Price: 900, Shape: "grid9x9"},
+	{Id: "hat-orange-trim", Name: "Hat: Orange Trim", Kind: SHOP_HAT, Price: 1_000, Hat: "orange-trim"},
+	{Id: "hat-ice-trim", Name: "Hat: Ice Trim", Kind: SHOP_HAT, Price: 2_500, Hat: "ice-trim"},
+}
+
+var shop = createShopCatalog(defaultShopItems)
+
+func createShopCatalog(list []ShopItem) *ShopCatalog {
+	catalog := &ShopCatalog{}
+	catalog.set(list)
+	return catalog
+}
+
+func (catalog *ShopCatalog) set(list []ShopItem) {
+	catalog.Lock()
+	defer catalog.Unlock()
+	catalog.items = make([]ShopItem, 0, len(list))
+	catalog.byId = make(map[string]ShopItem, len(list))
+	for _, item := range list {
+		if item.Quantity == 0 {
+			item.Quantity = 1
+		}
+		catalog.items = append(catalog.items, item)
+		catalog.byId[item.Id] = item
+	}
+}
+
+func (catalog *ShopCatalog) list() []ShopItem {
+	catalog.RLock()
+	defer catalog.RUnlock()
+	return append([]ShopItem{}, catalog.items...)
+}
+
+func (catalog *ShopCatalog) get(id string) (ShopItem, bool) {
+	catalog.RLock()
+	defer catalog.RUnlock()
+	item, ok := catalog.byId[id]
+	return item, ok
+}
+
+////////////////////////////////////////////////////////////
+// Load
+
+// Optional - The default catalog is used without ./data/shop.json
+func loadShop() {
+	jsonData, err := os.ReadFile("./data/shop.json")
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	var list []ShopItem
+	if err := json.Unmarshal(jsonData, &list); err != nil {
+		panic(err)
+	}
+	if err := validateShopItems(list); err != nil {
+		panic(err)
+	}
+	shop.set(list)
+	logger.Info().Msgf("Loaded %d shop items", len(list))
+}
+
+func validateShopItems(list []ShopItem) error {
+	seen := make(map[string]struct{}, len(list))
+	for _, item := range list {
+		if item.Id == "" || item.Name == "" {
+			return fmt.Errorf("shop item without id or name")
+		}
+		if _, ok := seen[item.Id]; ok {
+			return fmt.Errorf("duplicate shop item: %s", item.Id)
+		}
+		seen[item.Id] = struct{}{}
+		if item.Price <= 0 || item.Quantity < 0 {
+			return fmt.Errorf("shop item %s: price must be positive and quantity not negative", item.Id)
+		}
+		switch item.Kind {
+		case SHOP_BOOSTS:
+		case SHOP_POWER:
+			if _, ok := shopShapes[item.Shape]; !ok {
+				return fmt.Errorf("shop item %s: unknown shape %s", item.Id, item.Shape)
+			}
+		case SHOP_HAT:
+			if _, ok := HAT_NAME_TO_TRIM[item.Hat]; !ok {
+				return fmt.Errorf("shop item %s: unknown hat %s", item.Id, item.Hat)
+			}
+			if STATUS_HATS[item.Hat] {
+				return fmt.Errorf("shop item %s: %s cannot be sold", item.Id, item.Hat)
+			}
+		default:
+			return fmt.Errorf("shop item %s: unknown kind %s", item.Id, item.Kind)
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////
+// Transactions
+
+// Money is only taken if all of the price is available
+func (player *Player) spendMoney(amount int64) (int64, bool) {
+	for {
+		old := player.money.Load()
+		if old < amount {
+			return old, false
+		}
+		if player.money.CompareAndSwap(old, old-amount) {
+			return old - amount, true
+		}
+	}
+}
+
+// The purchase is logged and the record saved before returning
+func purchase(player *Player, item ShopItem) error {
+	// Claimed before paying so that two purchases of the same hat cannot both be charged
+	if item.Kind == SHOP_HAT && !player.inventory.unlockHat(item.Hat) {
+		return errAlreadyOwned
+	}
+	remaining, ok := player.spendMoney(item.Price)
+	if !ok {
+		if item.Kind == SHOP_HAT {
+			player.inventory.releaseHat(item.Hat)
+		}
+		return errInsufficientFunds
+	}
+	updateOne(spanMoney(remaining), player)
+
+	switch item.Kind {
+	case SHOP_BOOSTS:
+		player.addBoostsAndUpdate(item.Quantity)
+	case SHOP_POWER:
+		for i := 0; i < item.Quantity; i++ {
+			addPowerToStack(player, &PowerUp{areaOfInfluence: shopShapes[item.Shape]})
+		}
+	case SHOP_HAT:
+		player.equipHat(item.Hat)
+		player.saveInventory()
+	}
+
+	tile := player.getTileSync()
+	if err := player.world.db.savePurchaseEvent(tile, player, item.Id, item.Price); err != nil {
+		logger.Error().Err(err).Msg("Failed to save purchase by " + player.username)
+	}
+	if err := player.world.db.updateRecordForPlayer(player, tile); err != nil {
+		logger.Error().Err(err).Msg("Failed to save money for " + player.username)
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////
+// Menu
+
+func openShopMenu(p *Player) {
+	menu := Menu{
+		Name:     "shop",
+		CssClass: "",
+		InfoHtml: template.HTML(fmt.Sprintf(`<h2>Shop</h2><p class="dark-green">$ %d</p>`, p.money.Load())),
+	}
+	for _, item := range shop.list() {
+		menu.Links = append(menu.Links, MenuLink{Text: fmt.Sprintf("%s - $%d", item.Name, item.Price), eventHandler: buyAndReopen(item.Id), auth: nil})
+	}
+	menu.Links = append(menu.Links,
+		MenuLink{Text: "Back", eventHandler: openPauseMenu, auth: nil},
+		MenuLink{Text: "Close", eventHandler: turnMenuOff, auth: nil},
+	)
+	p.setMenu("shop", menu)
+	sendMenu(p, menu)
+}
+
+// Looked up again on click in case the catalog has changed
+func buyAndReopen(id string) func(*Player) {
+	return func(p *Player) {
+		item, ok := shop.get(id)
+		if !ok {
+			p.updateBottomText("No longer for sale")
+		} else if err := purchase(p, item); err != nil {
+			p.updateBottomText("@[" + err.Error() + "|red]")
+		} else {
+			sendSoundToPlayer(p, "money")
+			p.updateBottomText("Purchased " + item.Name)
+		}
+		openShopMenu(p)
+	}
+}
+
+func openShopInteraction(i *Interactable, p *Player, t *Tile) (*Interactable, bool) {
+	openShopMenu(p)
+	return nil, false
+}
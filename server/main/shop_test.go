@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSpendMoneyIsAtomic(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	player := joinAdminTestingPlayer(t, world, "spender")
+	player.money.Store(500)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	successes := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := player.spendMoney(10); ok {
+				mu.Lock()
+				successes++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if successes != 50 || player.money.Load() != 0 {
+		t.Errorf("expected exactly 50 purchases and no money left, got %d and %d", successes, player.money.Load())
+	}
+}
+
+func TestPurchaseGrantsItems(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	store := world.db.(*FileStore)
+	store.InsertPlayerRecord(PlayerRecord{Username: "buyer"})
+	player := joinAdminTestingPlayer(t, world, "buyer")
+	player.money.Store(10_000)
+
+	boosts := player.getBoostCountSync()
+	if err := purchase(player, ShopItem{Id: "b", Kind: SHOP_BOOSTS, Price: 100, Quantity: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if player.getBoostCountSync() != boosts+10 {
+		t.Error("expected ten more boosts")
+	}
+	if err := purchase(player, ShopItem{Id: "p", Kind: SHOP_POWER, Price: 100, Quantity: 2, Shape: "grid5x5"}); err != nil {
+		t.Fatal(err)
+	}
+	if player.actions.spaceStack.count() != 2 {
+		t.Error("expected two powers")
+	}
+	hat := ShopItem{Id: "h", Kind: SHOP_HAT, Price: 100, Hat: "orange-trim"}
+	if err := purchase(player, hat); err != nil {
+		t.Fatal(err)
+	}
+	if player.getHatSync() != HAT_NAME_TO_TRIM["orange-trim"] {
+		t.Error("expected the hat to be worn")
+	}
+	if record, err := world.db.getPlayerRecord("buyer"); err != nil || len(record.Inventory.Hats) != 1 || record.Inventory.ActiveHat != "orange-trim" {
+		t.Errorf("expected the bought hat to be saved and worn, got %+v %v", record.Inventory, err)
+	}
+	if err := purchase(player, hat); err != errAlreadyOwned {
+		t.Errorf("expected an owned hat not to be sold again, got %v", err)
+	}
+	if player.money.Load() != 10_000-300 {
+		t.Errorf("unexpected money %d", player.money.Load())
+	}
+	if err := purchase(player, ShopItem{Id: "h2", Kind: SHOP_HAT, Price: 1_000_000, Hat: "ice-trim"}); err != errInsufficientFunds || player.inventory.ownsHat("ice-trim") {
+		t.Errorf("an unpaid hat should not be kept, got %v", err)
+	}
+
+	purchases := 0
+	for _, event := range store.events {
+		if event.Type == EVENT_PURCHASE && event.Owner == "buyer" && event.Amount == 100 {
+			purchases++
+		}
+	}
+	if purchases != 3 {
+		t.Errorf("expected three purchase events, got %d", purchases)
+	}
+}
+
+func TestPurchaseWithoutEnoughMoney(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	player := joinAdminTestingPlayer(t, world, "broke")
+	player.money.Store(50)
+	boosts := player.getBoostCountSync()
+
+	if err := purchase(player, ShopItem{Id: "b", Kind: SHOP_BOOSTS, Price: 100, Quantity: 10}); err != errInsufficientFunds {
+		t.Errorf("expected insufficient funds, got %v", err)
+	}
+	if player.money.Load() != 50 || player.getBoostCountSync() != boosts {
+		t.Error("a failed purchase should change nothing")
+	}
+	if len(world.db.(*FileStore).events) != 0 {
+		t.Error("a failed purchase should not be logged")
+	}
+}
+
+func TestShopMenuClickBuys(t *testing.T) {
+	world := createAdminTestingWorld(t)
+	player := joinAdminTestingPlayer(t, world, "clicker")
+	player.money.Store(1_000)
+	previous := shop.list()
+	t.Cleanup(func() { shop.set(previous) })
+	shop.set([]ShopItem{{Id: "boosts", Name: "Boosts", Kind: SHOP_BOOSTS, Price: 250, Quantity: 5}})
+	boosts := player.getBoostCountSync()
+
+	openShopMenu(player)
+	menu, ok := player.getMenu("shop")
+	if !ok || len(menu.Links) != 3 {
+		t.Fatalf("expected one item with back and close, got %+v", menu.Links)
+	}
+	menu.attemptClick(player, PlayerSocketEvent{MenuName: "shop", Arg0: strconv.Itoa(0)})
+	if player.money.Load() != 750 || player.getBoostCountSync() != boosts+5 {
+		t.Errorf("expected purchase from menu, money %d", player.money.Load())
+	}
+}
+
+func TestValidateShopItems(t *testing.T) {
+	if err := validateShopItems(defaultShopItems); err != nil {
+		t.Errorf("default items should be valid: %v", err)
+	}
+	invalid := [][]ShopItem{
+		{{Id: "", Name: "x", Kind: SHOP_BOOSTS, Price: 1}},
+		{{Id: "a", Name: "x", Kind: SHOP_BOOSTS, Price: 1}, {Id: "a", Name: "y", Kind: SHOP_BOOSTS, Price: 1}},
+		{{Id: "a", Name: "x", Kind: SHOP_BOOSTS, Price: 0}},
+		{{Id: "a", Name: "x", Kind: SHOP_POWER, Price: 1, Shape: "triangle"}},
+		{{Id: "a", Name: "x", Kind: SHOP_HAT, Price: 1, Hat: "crown"}},
+		{{Id: "a", Name: "x", Kind: "pet", Price: 1}},
+	}
+	for i, list := range invalid {
+		if validateShopItems(list) == nil {
+			t.Errorf("expected case %d to be invalid", i)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	SHUTDOWN_COUNTDOWN_IN_SECONDS = 10
+	SHUTDOWN_LOGOUT_CONCURRENCY   = 8
+	SHUTDOWN_TIMEOUT              = 20 * time.Second // For saves and the http server, after the countdown
+)
+
+// World is nil when only serving the hub
+func shutdownOnSignal(server *http.Server, world *World, done chan<- struct{}) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	logger.Info().Msg("Shutting down...")
+	if world != nil {
+		world.shutdown(SHUTDOWN_COUNTDOWN_IN_SECONDS * time.Second)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Error().Err(err).Msg("Failed to shut down http server")
+	}
+	close(done)
+}
+
+// New players and spectators are turned away for the rest of the process
+func (world *World) shutdown(countdown time.Duration) {
+	world.shuttingDown.Store(true)
+	world.countdown(countdown)
+
+	logger.Info().Msg("Saving world state before shutdown...")
+	world.logoutEveryone(SHUTDOWN_LOGOUT_CONCURRENCY)
+	if !waitWithTimeout(&world.pendingSaves, SHUTDOWN_TIMEOUT) {
+		logger.Error().Msg("Timed out waiting for player records to save")
+	}
+	saveCurrentStatus(world)
+	saveStageSnapshots(world)
+	world.recorder.close()
+}
+
+func (world *World) countdown(countdown time.Duration) {
+	for remaining := countdown; remaining > 0; remaining -= time.Second {
+		seconds := int((remaining + time.Second - 1) / time.Second)
+		broadcastBottomText(world, fmt.Sprintf("Server restarting in @[%d|red] seconds", seconds))
+		if remaining < time.Second {
+			time.Sleep(remaining)
+		} else {
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// Parked players are unparked first so that their expiry can not log them out a second time
+func (world *World) logoutEveryone(concurrency int) {
+	world.parkedMutex.Lock()
+	for token, parked := range world.parkedPlayers {
+		parked.expiry.Stop()
+		delete(world.parkedPlayers, token)
+	}
+	world.parkedMutex.Unlock()
+
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, player := range world.copyOfPlayers() {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			shutdownLogout(player)
+		}()
+	}
+	wg.Wait()
+}
+
+func shutdownLogout(player *Player) {
+	player.quitting.Store(true)
+	sendUpdate(player, divLogOutResume(player, "Server restarting"))
+
+	player.tangibilityLock.Lock()
+	player.tangible = false
+	player.world.recorder.recordLeave(player)
+	removeFromTileAndStage(player)
+	player.tangibilityLock.Unlock()
+
+	completeLogout(player)
+}
+
+func waitWithTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func rejectWhileShuttingDown(world *World, w http.ResponseWriter) bool {
+	if !world.shuttingDown.Load() {
+		return false
+	}
+	http.Error(w, "Server is restarting", http.StatusServiceUnavailable)
+	return true
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createShutdownTestingWorld(t *testing.T) *World {
+	area := Area{Name: "test-shutdown", SpawnStrategy: "none", Tiles: walkableTilesForTesting(1, 3)}
+	return createWorldWithAreasForTesting(t, &Configuration{serverName: "test", resumeGrace: time.Minute}, area)
+}
+
+func joinShutdownTestingPlayer(t *testing.T, world *World, username string, x int, conn WebsocketConnection) *Player {
+	record := PlayerRecord{Username: username, Team: "fuchsia", StageName: "test-shutdown", Y: 0, X: x, Health: 100}
+	return joinPlayerForTesting(t, world, record, conn)
+}
+
+func TestShutdownLogsOutEveryone(t *testing.T) {
+	world := createShutdownTestingWorld(t)
+	conn := &CapturingConn{}
+	connected := joinShutdownTestingPlayer(t, world, "connected", 0, conn)
+	parked := joinShutdownTestingPlayer(t, world, "parked", 1, &MockConn{})
+	if !world.park(parked) {
+		t.Fatal("expected player to be parked")
+	}
+
+	world.shutdown(time.Second)
+	if !strings.Contains(conn.written(), "Server restarting in") {
+		t.Error("players should see a countdown")
+	}
+	if len(world.copyOfPlayers()) != 0 {
+		t.Error("every player should be logged out")
+	}
+	if !connected.loggedOut.Load() || !parked.loggedOut.Load() || parked.isParked() {
+		t.Error("connected and parked players should both be logged out")
+	}
+	if tile := connected.getTileSync(); tile.characterMap[connected.id] != nil {
+		t.Error("logged out player should be removed from their tile")
+	}
+
+	completeLogout(connected) // Late logout from the read loop
+	if len(world.copyOfPlayers()) != 0 {
+		t.Error("a second logout should be ignored")
+	}
+}
+
+func TestShutdownRejectsNewConnections(t *testing.T) {
+	world := createShutdownTestingWorld(t)
+	world.shutdown(0)
+
+	for _, handler := range []http.HandlerFunc{world.NewSocketConnection, world.playHandler, world.spectateHandler} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/", nil))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected service unavailable, got %d", w.Code)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Mutable state of a stage - Everything else is rebuilt from the Area definition
+type StageSnapshot struct {
+	Name  string         `bson:"name" json:"name"`
+	Tiles []TileSnapshot `bson:"tiles" json:"tiles"`
+}
+
+type TileSnapshot struct {
+	Y            int                   `bson:"y" json:"y"`
+	X            int                   `bson:"x" json:"x"`
+	Interactable *InteractableSnapshot `bson:"interactable,omitempty" json:"interactable,omitempty"`
+	Money        int                   `bson:"money,omitempty" json:"money,omitempty"`
+	Boosts       int                   `bson:"boosts,omitempty" json:"boosts,omitempty"`
+	PowerUp      [][2]int              `bson:"powerUp,omitempty" json:"powerUp,omitempty"`
+}
+
+type InteractableSnapshot struct {
+	Name           string `bson:"name" json:"name"`
+	CssClass       string `bson:"cssClass" json:"cssClass"`
+	Pushable       bool   `bson:"pushable,omitempty" json:"pushable,omitempty"`
+	Walkable       bool   `bson:"walkable,omitempty" json:"walkable,omitempty"`
+	Fragile        bool   `bson:"fragile,omitempty" json:"fragile,omitempty"`
+	RejectTeleport bool   `bson:"rejectTeleport,omitempty" json:"rejectTeleport,omitempty"`
+	Reactions      string `bson:"reactions,omitempty" json:"reactions,omitempty"`
+}
+
+type StageSnapshots struct {
+	sync.Mutex
+	snapshots map[string]*StageSnapshot
+}
+
+func createStageSnapshots() *StageSnapshots {
+	return &StageSnapshots{snapshots: make(map[string]*StageSnapshot)}
+}
+
+func (s *StageSnapshots) put(key string, snapshot *StageSnapshot) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.snapshots[key] = snapshot
+}
+
+// Snapshot is removed - the rebuilt stage becomes the owner of this state
+func (s *StageSnapshots) take(key string) *StageSnapshot {
+	if s == nil {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	snapshot := s.snapshots[key]
+	delete(s.snapshots, key)
+	return snapshot
+}
+
+func (s *StageSnapshots) get(key string) *StageSnapshot {
+	if s == nil {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+	return s.snapshots[key]
+}
+
+func (s *StageSnapshots) copyOf() map[string]*StageSnapshot {
+	out := make(map[string]*StageSnapshot)
+	if s == nil {
+		return out
+	}
+	s.Lock()
+	defer s.Unlock()
+	for key, snapshot := range s.snapshots {
+		out[key] = snapshot
+	}
+	return out
+}
+
+func (s *StageSnapshots) dropByName(names map[string]struct{}) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	for key, snapshot := range s.snapshots {
+		if _, found := names[snapshot.Name]; found {
+			delete(s.snapshots, key)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////
+// Snapshot / Restore
+
+// Tiles are locked individually - the stage should not be in use
+func snapshotStage(stage *Stage) *StageSnapshot {
+	snapshot := &StageSnapshot{Name: stage.name, Tiles: make([]TileSnapshot, 0)}
+	for y := range stage.tiles {
+		for x := range stage.tiles[y] {
+			tileSnapshot, changed := snapshotTile(stage.tiles[y][x])
+			if changed {
+				snapshot.Tiles = append(snapshot.Tiles, tileSnapshot)
+			}
+		}
+	}
+	return snapshot
+}
+
+func snapshotTile(tile *Tile) (TileSnapshot, bool) {
+	out := TileSnapshot{Y: tile.y, X: tile.x}
+
+	tile.interactableMutex.Lock()
+	if tile.interactable != nil {
+		out.Interactable = snapshotInteractable(tile.interactable)
+	}
+	tile.interactableMutex.Unlock()
+
+	tile.itemMutex.Lock()
+	out.Money = tile.money
+	out.Boosts = tile.boosts
+	if tile.powerUp != nil {
+		out.PowerUp = tile.powerUp.areaOfInfluence
+	}
+	tile.itemMutex.Unlock()
+
+	return out, out.Interactable != nil || out.Money != 0 || out.Boosts != 0 || out.PowerUp != nil
+}
+
+func snapshotInteractable(i *Interactable) *InteractableSnapshot {
+	return &InteractableSnapshot{
+		Name:           i.name,
+		CssClass:       i.cssClass,
+		Pushable:       i.pushable,
+		Walkable:       i.walkable,
+		Fragile:        i.fragile,
+		RejectTeleport: i.rejectTeleport,
+		Reactions:      i.reactionsName,
+	}
+}
+
+// Replaces the interactable layer entirely: interactables missing from the snapshot were destroyed
+func restoreStageSnapshot(stage *Stage, snapshot *StageSnapshot) {
+	if stage == nil || snapshot == nil {
+		return
+	}
+	for y := range stage.tiles {
+		for x := range stage.tiles[y] {
+			stage.tiles[y][x].interactable = nil
+		}
+	}
+	for _, tileSnapshot := range snapshot.Tiles {
+		if !validCoordinate(tileSnapshot.Y, tileSnapshot.X, stage) {
+			logger.Warn().Msgf("Snapshot for %s has invalid tile %d,%d", stage.name, tileSnapshot.Y, tileSnapshot.X)
+			continue
+		}
+		tile := stage.tiles[tileSnapshot.Y][tileSnapshot.X]
+		if tileSnapshot.Interactable != nil {
+			tile.interactable = restoreInteractable(tileSnapshot.Interactable, stage.reactions)
+		}
+		tile.money = tileSnapshot.Money
+		tile.boosts = tileSnapshot.Boosts
+		if tileSnapshot.PowerUp != nil {
+			tile.powerUp = &PowerUp{areaOfInfluence: tileSnapshot.PowerUp}
+		}
+	}
+}
+
+func restoreInteractable(snapshot *InteractableSnapshot, areaReactions map[string][]InteractableReaction) *Interactable {
+	return &Interactable{
+		name:           snapshot.Name,
+		cssClass:       snapshot.CssClass,
+		pushable:       snapshot.Pushable,
+		walkable:       snapshot.Walkable,
+		fragile:        snapshot.Fragile,
+		rejectTeleport: snapshot.RejectTeleport,
+		reactions:      reactionsByName(snapshot.Reactions, areaReactions),
+		reactionsName:  snapshot.Reactions,
+	}
+}
+
+////////////////////////////////////////////////////////////
+// Persistence
+
+// World stages are keyed by stagename, or stagename:team for team stages. Caller holds wStageMutex.
+func (world *World) registerStage(key string, stage *Stage) {
+	restoreStageSnapshot(stage, world.evictedStages.take(key))
+	if seed, ok := world.stageSeeds[key]; ok {
+		stage.reseed(seed)
+	}
+	world.worldStages[key] = stage
+	world.recorder.recordStage(key, stage)
+	if world.persistedStages != nil && world.persistedStages.get(key) == nil {
+		world.persistedStages.put(key, snapshotStage(stage))
+	}
+}
+
+// Loaded and evicted world stages which differ from what was last persisted
+func (world *World) dirtyStageSnapshots() map[string]*StageSnapshot {
+	current := world.evictedStages.copyOf()
+	world.wStageMutex.Lock()
+	stages := make(map[string]*Stage, len(world.worldStages))
+	for key, stage := range world.worldStages {
+		if stage != nil {
+			stages[key] = stage
+		}
+	}
+	world.wStageMutex.Unlock()
+	for key, stage := range stages {
+		current[key] = snapshotStage(stage)
+	}
+
+	out := make(map[string]*StageSnapshot)
+	for key, snapshot := range current {
+		if !sameSnapshot(world.persistedStages.get(key), snapshot) {
+			out[key] = snapshot
+		}
+	}
+	return out
+}
+
+func sameSnapshot(a, b *StageSnapshot) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	first, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	second, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(first) == string(second)
+}
+
+// Snapshots of an area that has since been edited are not restored
+func areaFingerprint(stagename string) string {
+	area, found := areaFromName(stagename)
+	if !found {
+		return ""
+	}
+	data, err := json.Marshal(area)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func saveStageSnapshots(world *World) {
+	if world.persistedStages == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count := 0
+	for key, snapshot := range world.dirtyStageSnapshots() {
+		record := StageSnapshotRecord{
+			ServerName: world.config.serverName,
+			Key:        key,
+			Timestamp:  time.Now(),
+			AreaHash:   areaFingerprint(snapshot.Name),
+			Snapshot:   *snapshot,
+		}
+		if err := world.db.upsertStageSnapshot(ctx, record); err != nil {
+			logger.Error().Err(err).Msg("Failed to save stage snapshot: " + key)
+			continue
+		}
+		world.persistedStages.put(key, snapshot)
+		count++
+	}
+	logger.Info().Msgf("Saved %d stage snapshots", count)
+}
+
+// Persisted stages are treated as evicted: they are restored once the stage is next fetched
+func loadStageSnapshots(world *World) {
+	if world.persistedStages == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	records, err := world.db.getStageSnapshots(ctx, world.config.serverName)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to load stage snapshots")
+		return
+	}
+	world.restoreStageSnapshotRecords(records)
+}
+
+func (world *World) restoreStageSnapshotRecords(records []StageSnapshotRecord) {
+	count := 0
+	for i := range records {
+		record := &records[i]
+		if record.AreaHash != areaFingerprint(record.Snapshot.Name) {
+			logger.Warn().Msg("Discarding stage snapshot for edited area: " + record.Key)
+			continue
+		}
+		world.evictedStages.put(record.Key, &record.Snapshot)
+		world.persistedStages.put(record.Key, &record.Snapshot)
+		count++
+	}
+	logger.Info().Msgf("Loaded %d stage snapshots", count)
+}
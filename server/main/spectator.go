@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const SPECTATOR_FOLLOW_INTERVAL_IN_MS = 100
+
+// A camera without a character - never on a tile, never tangible
+type Spectator struct {
+	sync.Mutex
+	world     *World
+	conn      WebsocketConnection
+	camera    *Camera
+	updates   chan []byte
+	stage     *Stage // Nil until a stage is chosen
+	focusY    int
+	focusX    int
+	following string // Username, empty while panning freely
+	closed    bool
+}
+
+func createSpectator(world *World, conn WebsocketConnection) *Spectator {
+	updates := make(chan []byte, UPDATE_QUEUE_SIZE)
+	camera := newCamera(updates)
+	camera.events.Store(speaksJson(conn))
+	return &Spectator{world: world, conn: conn, camera: camera, updates: updates}
+}
+
+////////////////////////////////////////////////////////////
+// Connection
+
+// Spectating uses SPECTATOR_PASSWORD so that casters do not need the admin password
+func spectatorAuthorized(token string) bool {
+	return secretMatches(token, "SPECTATOR_PASSWORD") || secretMatches(token, "ADMIN_PASSWORD")
+}
+
+// First message: {"token": <password>, "follow": <username>} or {"token": <password>, "stage": <stagename>}
+func (world *World) spectateHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectWhileShuttingDown(world, w) {
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error().Err(err).Msg("Error:")
+		return
+	}
+	defer conn.Close()
+
+	_, bytes, err := conn.ReadMessage()
+	if err != nil {
+		return
+	}
+	var request struct {
+		Token    string `json:"token"`
+		Follow   string `json:"follow"`
+		Stage    string `json:"stage"`
+		Protocol string `json:"protocol"`
+	}
+	if err := json.Unmarshal(bytes, &request); err != nil || !spectatorAuthorized(request.Token) {
+		logger.Warn().Msg("Unauthorized spectator from: " + clientIP(r))
+		sendUnableToJoinMessage(conn, "Unauthorized.")
+		return
+	}
+	if request.Follow != "" {
+		world.audit.record(clientIP(r), "spectate", request.Follow, "follow", nil)
+	} else {
+		world.audit.record(clientIP(r), "spectate", request.Stage, "stage", nil)
+	}
+	wsConn, supported := negotiateProtocol(conn, request.Protocol)
+	if !supported {
+		sendUnableToJoinMessage(conn, "Unsupported protocol.")
+		return
+	}
+
+	spectator := createSpectator(world, wsConn)
+	if !sendInitialScreen(wsConn, initialScreen(wsConn, spectator.camera.height, spectator.camera.width)) {
+		return
+	}
+	go spectator.sendUpdates()
+	ctx, cancel := context.WithCancel(context.Background())
+	go spectator.followUntilDone(ctx)
+	defer spectator.close(cancel)
+
+	if request.Follow != "" {
+		spectator.follow(request.Follow)
+	} else {
+		spectator.viewStage(request.Stage)
+	}
+	spectator.handleEvents()
+}
+
+func (spectator *Spectator) handleEvents() {
+	for {
+		spectator.conn.SetReadDeadline(time.Now().Add(MAX_IDLE_IN_SECONDS))
+		_, msg, err := spectator.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		event, success := getKeyPress(msg)
+		if !success {
+			continue
+		}
+		switch event.Name {
+		case "follow":
+			spectator.follow(event.Arg0)
+		case "stage":
+			spectator.viewStage(event.Arg0)
+		case "w":
+			spectator.pan(-1, 0)
+		case "a":
+			spectator.pan(0, -1)
+		case "s":
+			spectator.pan(1, 0)
+		case "d":
+			spectator.pan(0, 1)
+		case "W":
+			spectator.pan(-spectator.camera.height, 0)
+		case "A":
+			spectator.pan(0, -spectator.camera.width)
+		case "S":
+			spectator.pan(spectator.camera.height, 0)
+		case "D":
+			spectator.pan(0, spectator.camera.width)
+		case "f":
+			spectator.refresh()
+		}
+	}
+}
+
+// Camera is removed from its zone before updates is closed so that no zone sends on a closed channel
+func (spectator *Spectator) close(cancel context.CancelFunc) {
+	cancel()
+	spectator.Lock()
+	if spectator.stage != nil {
+		spectator.camera.drop()
+	}
+	spectator.closed = true
+	spectator.Unlock()
+	close(spectator.updates)
+}
+
+func (spectator *Spectator) sendUpdates() {
+	var buffer bytes.Buffer
+	const maxBufferSize = 10 * 256 * 1024
+
+	failed := false
+	ticker := time.NewTicker(25 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case update, ok := <-spectator.updates:
+			if !ok {
+				return
+			}
+			if failed {
+				continue
+			}
+			if buffer.Len()+len(update) < maxBufferSize {
+				buffer.Write(update)
+			} else {
+				buffer.Reset()
+				spectator.camera.backlog.requestResync()
+			}
+		case <-ticker.C:
+			resync, open := spectator.camera.collect(spectator.updates, &buffer)
+			if !open {
+				return
+			}
+			if resync && spectator.resync(&buffer) {
+				spectator.camera.backlog.resynced()
+			}
+			if failed || buffer.Len() == 0 {
+				buffer.Reset()
+				continue
+			}
+			spectator.conn.SetWriteDeadline(time.Now().Add(2000 * time.Millisecond))
+			if err := spectator.conn.WriteMessage(websocket.TextMessage, spectator.world.bandwidth.coalesce(buffer.Bytes())); err != nil {
+				failed = true
+				spectator.conn.Close() // Ends handleEvents
+			}
+			buffer.Reset()
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////
+// Camera
+
+// Only stages which are already loaded can be viewed
+func (spectator *Spectator) viewStage(stagename string) bool {
+	stage := spectator.world.loadedStage(stagename, "")
+	if stage == nil {
+		return false
+	}
+	spectator.Lock()
+	defer spectator.Unlock()
+	spectator.following = ""
+	spectator.moveLocked(stage, len(stage.tiles)/2, len(stage.tiles[0])/2)
+	return true
+}
+
+func (spectator *Spectator) follow(username string) bool {
+	player := spectator.world.getPlayerByUsername(username)
+	if player == nil {
+		return false
+	}
+	spectator.Lock()
+	defer spectator.Unlock()
+	if spectator.closed {
+		return false
+	}
+	spectator.following = username
+	spectator.trackLocked(player)
+	return true
+}
+
+func (spectator *Spectator) pan(yOff, xOff int) {
+	spectator.Lock()
+	defer spectator.Unlock()
+	if spectator.stage == nil || spectator.closed {
+		return
+	}
+	spectator.following = ""
+	y := clamp(spectator.focusY+yOff, 0, len(spectator.stage.tiles)-1)
+	x := clamp(spectator.focusX+xOff, 0, len(spectator.stage.tiles[0])-1)
+	spectator.focusY, spectator.focusX = y, x
+	spectator.camera.trackTile(spectator.stage.tiles[y][x])
+}
+
+// TryLock as the camera may be blocked sending to this goroutine
+func (spectator *Spectator) resync(buffer *bytes.Buffer) bool {
+	if !spectator.TryLock() {
+		return false
+	}
+	defer spectator.Unlock()
+	set, ok := spectator.camera.setToken()
+	if !ok {
+		return false
+	}
+	buffer.Write(set)
+	if spectator.stage != nil {
+		buffer.Write(swapsForTilesWithHighlights(spectator.stage.tiles, nil))
+	}
+	return true
+}
+
+func (spectator *Spectator) refresh() {
+	spectator.Lock()
+	defer spectator.Unlock()
+	if spectator.stage == nil || spectator.closed {
+		return
+	}
+	spectator.updates <- swapsForTilesWithHighlights(spectator.stage.tiles, nil)
+}
+
+func (spectator *Spectator) followUntilDone(ctx context.Context) {
+	ticker := time.NewTicker(SPECTATOR_FOLLOW_INTERVAL_IN_MS * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			spectator.Lock()
+			if spectator.following != "" {
+				if player := spectator.world.getPlayerByUsername(spectator.following); player != nil {
+					spectator.trackLocked(player)
+				}
+			}
+			spectator.Unlock()
+		}
+	}
+}
+
+func (spectator *Spectator) trackLocked(player *Player) {
+	tile := player.getTileSync()
+	if tile == nil || spectator.closed {
+		return
+	}
+	if tile.stage != spectator.stage {
+		spectator.moveLocked(tile.stage, tile.y, tile.x)
+		return
+	}
+	spectator.focusY, spectator.focusX = tile.y, tile.x
+	spectator.camera.trackTile(tile)
+}
+
+func (spectator *Spectator) moveLocked(stage *Stage, y, x int) {
+	if spectator.closed {
+		return
+	}
+	if spectator.stage != nil {
+		spectator.camera.drop()
+	}
+	spectator.stage, spectator.focusY, spectator.focusX = stage, y, x
+	spectator.camera.setView(y, x, stage)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func createSpectatorTestingWorld(t *testing.T) *World {
+	area := Area{Name: "test-spectate", SpawnStrategy: "none", Tiles: walkableTilesForTesting(40, 40)}
+	return createWorldWithAreasForTesting(t, &testingConfig, area)
+}
+
+// Collects everything a spectator's camera sends
+func drainSpectator(spectator *Spectator) (func() string, func()) {
+	var lock sync.Mutex
+	var received bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for update := range spectator.updates {
+			lock.Lock()
+			received.Write(update)
+			lock.Unlock()
+		}
+	}()
+	take := func() string {
+		time.Sleep(20 * time.Millisecond)
+		lock.Lock()
+		defer lock.Unlock()
+		out := received.String()
+		received.Reset()
+		return out
+	}
+	stop := func() {
+		spectator.close(func() {})
+		<-done
+	}
+	return take, stop
+}
+
+func TestSpectatorFollowsPlayerWithoutBeingOnTheStage(t *testing.T) {
+	world := createSpectatorTestingWorld(t)
+	record := PlayerRecord{Username: "followed", Team: "fuchsia", StageName: "test-spectate", Y: 20, X: 20, Health: 100}
+	player := joinPlayerForTesting(t, world, record, &MockConn{})
+
+	spectator := createSpectator(world, &MockConn{})
+	take, stop := drainSpectator(spectator)
+	if !spectator.follow("followed") {
+		t.Fatal("expected to follow an online player")
+	}
+	if !strings.Contains(take(), `id="set"`) {
+		t.Error("following should set the view")
+	}
+	stage := player.getTileSync().stage
+	if _, ok := spectator.camera.topLeft.primaryZone.activeCameras[spectator.camera]; !ok {
+		t.Error("spectator camera should be in a zone")
+	}
+	for y := range stage.tiles {
+		for x := range stage.tiles[y] {
+			if count := len(stage.tiles[y][x].characterMap); count > 0 && stage.tiles[y][x] != player.getTileSync() {
+				t.Fatalf("spectator should not occupy a tile, found %d characters at %d,%d", count, y, x)
+			}
+		}
+	}
+
+	player.handlePress(&PlayerSocketEvent{Name: "d"}, "")
+	if !strings.Contains(take(), playerBoxSpecifc(20, 21, player.getIconSync())) {
+		t.Error("spectator should receive the same swaps as players on the stage")
+	}
+
+	spectator.pan(0, -40)
+	if spectator.following != "" || spectator.focusX != 0 {
+		t.Errorf("panning should stop following, focus at %d", spectator.focusX)
+	}
+	if !strings.Contains(take(), `id="shift"`) {
+		t.Error("panning should shift the view")
+	}
+
+	zone := spectator.camera.topLeft.primaryZone
+	stop()
+	if _, ok := zone.activeCameras[spectator.camera]; ok {
+		t.Error("closed spectator should leave its zone")
+	}
+	if spectator.follow("followed") {
+		t.Error("closed spectator should not follow")
+	}
+}
+
+func TestSpectatorOnlyViewsLoadedStages(t *testing.T) {
+	world := createSpectatorTestingWorld(t)
+	spectator := createSpectator(world, &MockConn{})
+	_, stop := drainSpectator(spectator)
+	defer stop()
+
+	if spectator.viewStage("test-spectate") {
+		t.Error("viewing should not load a stage")
+	}
+	if spectator.follow("nobody") {
+		t.Error("cannot follow an offline player")
+	}
+}
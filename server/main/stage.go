@@ -2,7 +2,10 @@ package main
 
 import (
 	"log"
+	"math/rand"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Stage struct {
@@ -18,6 +21,13 @@ type Stage struct {
 	spawn              []SpawnAction
 	broadcastGroupName string
 	weather            string
+	zones              [][]*CameraZone
+	reactions          map[string][]InteractableReaction
+	lastActive         atomic.Int64 // Unix nano, used for idle eviction
+	scheduler          *Scheduler   // Nil unless stageTickInterval is set
+	seed               int64        // Recorded so that a replay draws the same outcomes
+	rng                *rand.Rand
+	rngLock            sync.Mutex
 }
 
 type CameraZone struct {
@@ -26,11 +36,11 @@ type CameraZone struct {
 }
 
 func (zone *CameraZone) updateAll(update string) {
-	updateAsBytes := []byte(update)
+	shared := newZoneUpdate([]byte(update))
 	zone.camerasLock.RLock()
 	defer zone.camerasLock.RUnlock()
 	for camera := range zone.activeCameras {
-		camera.outgoing <- updateAsBytes
+		camera.deliver(shared)
 	}
 }
 
@@ -56,6 +66,10 @@ func (zone *CameraZone) addCamera(camera *Camera) {
 
 func createStageFromArea(area Area) *Stage {
 	spawnAction := spawnActions[area.SpawnStrategy]
+	areaReactions, err := compileAreaReactions(area)
+	if err != nil {
+		panic("Invalid reactions for area " + area.Name + ": " + err.Error()) // Areas are checked as they are loaded
+	}
 	outputStage := Stage{
 		tiles:              make([][]*Tile, len(area.Tiles)),
 		playerMap:          make(map[string]*Player),
@@ -69,7 +83,9 @@ func createStageFromArea(area Area) *Stage {
 		spawn:              spawnAction,
 		broadcastGroupName: area.BroadcastGroup,
 		weather:            area.Weather,
+		reactions:          areaReactions,
 	}
+	outputStage.reseed(rand.Int63())
 
 	// Initialize camera zones
 	zones := make([][]*CameraZone, (len(area.Tiles)+VIEW_HEIGHT-1)/VIEW_HEIGHT)
@@ -83,6 +99,12 @@ func createStageFromArea(area Area) *Stage {
 		}
 	}
 
+	outputStage.zones = zones
+	outputStage.touch()
+	if stageTickInterval > 0 {
+		outputStage.scheduler = createScheduler(stageTickInterval)
+	}
+
 	for y := range outputStage.tiles {
 		outputStage.tiles[y] = make([]*Tile, len(area.Tiles[y]))
 		for x := range outputStage.tiles[y] {
@@ -106,8 +128,8 @@ func createStageFromArea(area Area) *Stage {
 			if area.Interactables != nil && y < len(area.Interactables) && x < len(area.Interactables[y]) {
 				description := area.Interactables[y][x]
 				if description != nil {
-					reaction := interactableReactions[description.Reactions]
-					outputStage.tiles[y][x].interactable = &Interactable{name: description.Name, cssClass: description.CssClass, pushable: description.Pushable, walkable: description.Walkable, fragile: description.Fragile, reactions: reaction}
+					reaction := reactionsByName(description.Reactions, areaReactions)
+					outputStage.tiles[y][x].interactable = &Interactable{name: description.Name, cssClass: description.CssClass, pushable: description.Pushable, walkable: description.Walkable, fragile: description.Fragile, reactions: reaction, reactionsName: description.Reactions}
 				}
 			}
 		}
@@ -157,6 +179,76 @@ func placePlayerOnStageAt(p *Player, stage *Stage, y, x int) {
 	p.updates <- highlightBoxesForPlayer(p, viewport)
 }
 
+///////////////////////////////////////////////////
+// Randomness
+
+// Spawns and placements on the stage draw from here, see recordStage
+func (stage *Stage) intn(n int) int {
+	stage.rngLock.Lock()
+	defer stage.rngLock.Unlock()
+	return stage.rng.Intn(n)
+}
+
+func (stage *Stage) reseed(seed int64) {
+	stage.rngLock.Lock()
+	defer stage.rngLock.Unlock()
+	stage.seed = seed
+	stage.rng = rand.New(rand.NewSource(seed))
+}
+
+///////////////////////////////////////////////////
+// Idle Eviction
+
+func (stage *Stage) touch() {
+	stage.lastActive.Store(time.Now().UnixNano())
+}
+
+func (stage *Stage) idleSince() time.Time {
+	return time.Unix(0, stage.lastActive.Load())
+}
+
+// Idle when no character occupies a tile, no camera views a zone, and no event is in progress
+func (stage *Stage) isIdle() bool {
+	if stage.scheduler != nil && stage.scheduler.pending() > 0 {
+		return false
+	}
+	for y := range stage.zones {
+		for x := range stage.zones[y] {
+			zone := stage.zones[y][x]
+			zone.camerasLock.RLock()
+			cameraCount := len(zone.activeCameras)
+			zone.camerasLock.RUnlock()
+			if cameraCount > 0 {
+				return false
+			}
+		}
+	}
+	for y := range stage.tiles {
+		for x := range stage.tiles[y] {
+			tile := stage.tiles[y][x]
+			if tile.eventsInFlight.Load() > 0 {
+				return false
+			}
+			tile.CharacterMutex.Lock()
+			characterCount := len(tile.characterMap)
+			tile.CharacterMutex.Unlock()
+			if characterCount > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Busy stages are touched so that the idle period restarts once they empty
+func (stage *Stage) evictable(now time.Time, idlePeriod time.Duration) bool {
+	if !stage.isIdle() {
+		stage.touch()
+		return false
+	}
+	return now.Sub(stage.idleSince()) >= idlePeriod
+}
+
 ///////////////////////////////////////////////////
 // Spawn Items
 
@@ -1,6 +1,9 @@
 package main
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestEnsureClinicLoads(t *testing.T) {
 	loadFromJson()
@@ -28,3 +31,85 @@ func TestEnsureClinicIsDefault(t *testing.T) {
 }
 
 // Test personal / individual load types
+
+func TestIdleStageEvictionRestoresState(t *testing.T) {
+	walkable := Material{Walkable: true}
+	area := Area{
+		Name:          "test-eviction",
+		Tiles:         [][]Material{{walkable, walkable, walkable}},
+		Interactables: [][]*InteractableDescription{{{Name: "ball", CssClass: "gold", Pushable: true, Reactions: "black-hole"}, nil, nil}},
+	}
+	config := Configuration{stageIdleEviction: time.Minute, persistIdleStages: true}
+	world := createWorldWithAreasForTesting(t, &config, area)
+	player := &Player{world: world, team: "fuchsia", playerStages: make(map[string]*Stage), evictedStages: createStageSnapshots()}
+
+	stage := player.fetchStageSync(area.Name)
+	stage.tiles[0][2].interactable = stage.tiles[0][0].interactable
+	stage.tiles[0][0].interactable = nil
+	stage.tiles[0][1].money = 50
+
+	if evicted := world.evictIdleStages(time.Now()); evicted != 0 {
+		t.Fatalf("stage evicted before idle period elapsed")
+	}
+	stage.tiles[0][1].characterMap[player.id] = player
+	if evicted := world.evictIdleStages(time.Now().Add(2 * time.Minute)); evicted != 0 {
+		t.Fatalf("occupied stage was evicted")
+	}
+	delete(stage.tiles[0][1].characterMap, player.id)
+	if evicted := world.evictIdleStages(time.Now().Add(2 * time.Minute)); evicted != 1 {
+		t.Fatalf("expected idle stage to be evicted, got %d", evicted)
+	}
+
+	rebuilt := player.fetchStageSync(area.Name)
+	if rebuilt == stage {
+		t.Fatal("expected a rebuilt stage")
+	}
+	if rebuilt.tiles[0][0].interactable != nil {
+		t.Error("moved interactable should not return to its original tile")
+	}
+	moved := rebuilt.tiles[0][2].interactable
+	if moved == nil || moved.name != "ball" || !moved.pushable || len(moved.reactions) != len(interactableReactions["black-hole"]) {
+		t.Error("interactable was not restored with its reactions")
+	}
+	if rebuilt.tiles[0][1].money != 50 {
+		t.Error("money was not restored")
+	}
+}
+
+func TestPersistedStagesOnlySaveDirtyState(t *testing.T) {
+	walkable := Material{Walkable: true}
+	area := Area{Name: "test-persistence", Tiles: [][]Material{{walkable, walkable}}}
+	config := Configuration{persistStages: true}
+	world := createWorldWithAreasForTesting(t, &config, area)
+	npc, _ := createNewNPC(world, "npc")
+
+	stage := npc.fetchStageSync(area.Name)
+	if dirty := world.dirtyStageSnapshots(); len(dirty) != 0 {
+		t.Fatalf("fresh stage should not be dirty, got %d", len(dirty))
+	}
+	stage.tiles[0][1].money = 75
+	dirty := world.dirtyStageSnapshots()
+	if len(dirty) != 1 || dirty[area.Name] == nil {
+		t.Fatalf("expected modified stage to be dirty, got %v", dirty)
+	}
+	world.persistedStages.put(area.Name, dirty[area.Name]) // As if saved
+	if dirty := world.dirtyStageSnapshots(); len(dirty) != 0 {
+		t.Fatalf("saved stage should not be dirty, got %d", len(dirty))
+	}
+
+	// Restart
+	record := StageSnapshotRecord{Key: area.Name, AreaHash: areaFingerprint(area.Name), Snapshot: *dirty[area.Name]}
+	stale := StageSnapshotRecord{Key: "clinic", AreaHash: "edited", Snapshot: StageSnapshot{Name: "clinic"}}
+	restarted := createGameWorld(nil, &config)
+	restarted.restoreStageSnapshotRecords([]StageSnapshotRecord{record, stale})
+	if restarted.evictedStages.get("clinic") != nil {
+		t.Error("snapshot of an edited area should be discarded")
+	}
+	npc, _ = createNewNPC(restarted, "npc")
+	if restored := npc.fetchStageSync(area.Name); restored.tiles[0][1].money != 75 {
+		t.Error("money was not restored after restart")
+	}
+	if dirty := restarted.dirtyStageSnapshots(); len(dirty) != 0 {
+		t.Errorf("restored stage should not be dirty, got %d", len(dirty))
+	}
+}
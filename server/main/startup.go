@@ -8,8 +8,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/sessions"
 	"github.com/joho/godotenv"
@@ -26,11 +30,15 @@ type DB struct {
 	playerRecords *mongo.Collection
 	events        *mongo.Collection
 	sessionData   *mongo.Collection
+	snapshots     *mongo.Collection // Stage snapshots
+	dailyEvents   *mongo.Collection // Rollups of expired events
+	seasons       *mongo.Collection // Archived season standings
+	bans          *mongo.Collection
 }
 
 func createDbConnection(config *Configuration) *DB {
 	mongodb := mongoClient(config).Database("bloopdb")
-	return &DB{mongodb.Collection("users"), mongodb.Collection("players"), mongodb.Collection("events"), mongodb.Collection("sessionData")}
+	return &DB{mongodb.Collection("users"), mongodb.Collection("players"), mongodb.Collection("events"), mongodb.Collection("sessionData"), mongodb.Collection("stageSnapshots"), mongodb.Collection("dailyEvents"), mongodb.Collection("seasons"), mongodb.Collection("bans")}
 }
 
 func mongoClient(config *Configuration) *mongo.Client {
@@ -74,6 +82,25 @@ type Configuration struct {
 	serverName         string
 	domainName         string
 	loadPreviousState  bool
+	stageIdleEviction  time.Duration // Zero disables eviction
+	persistIdleStages  bool
+	persistStages      bool
+	recordMatches      bool
+	stageTick          time.Duration // Zero disables stage schedulers
+	resumeGrace        time.Duration // Zero disables resuming dropped sessions
+	gameMode           string
+	auditLogPath       string // Empty keeps the admin audit log in memory only
+	metricsEnabled     bool
+	storage            string        // STORAGE_MONGO or STORAGE_FILE
+	storagePath        string        // Directory for STORAGE_FILE
+	guestRetention     time.Duration // Zero keeps inactive guests
+	eventRetention     time.Duration // Zero keeps events
+	retentionDryRun    bool
+	runsRetention      bool          // Set on one process only, the others leave retention to it
+	seasonLength       time.Duration // Zero uses DEFAULT_SEASON_LENGTH
+	roundLength        time.Duration // Zero keeps each mode's own length
+	hillTimeToWin      time.Duration // Zero uses DEFAULT_HILL_TIME_TO_WIN
+	huntingNpcs        bool          // Power up npcs chase enemies rather than wander
 	RuntimeConfiguration
 }
 
@@ -113,6 +140,25 @@ func getConfiguration() *Configuration {
 		serverName:         os.Getenv("SERVER_NAME"),
 		domainName:         os.Getenv("DOMAIN_NAME"),
 		loadPreviousState:  strings.ToUpper(os.Getenv("LOAD_PEVIOUS_STATE")) == "TRUE",
+		stageIdleEviction:  minutesFromEnv("STAGE_IDLE_EVICTION_IN_MIN"),
+		persistIdleStages:  strings.ToUpper(os.Getenv("PERSIST_EVICTED_STAGES")) != "FALSE",
+		persistStages:      strings.ToUpper(os.Getenv("PERSIST_STAGES")) == "TRUE",
+		recordMatches:      strings.ToUpper(os.Getenv("RECORD_MATCHES")) == "TRUE",
+		stageTick:          durationFromEnv("STAGE_TICK_IN_MS", time.Millisecond),
+		resumeGrace:        durationFromEnv("RESUME_GRACE_IN_SECONDS", time.Second),
+		gameMode:           os.Getenv("GAME_MODE"),
+		auditLogPath:       os.Getenv("ADMIN_AUDIT_LOG_PATH"),
+		metricsEnabled:     strings.ToUpper(os.Getenv("METRICS_ENABLED")) == "TRUE",
+		storage:            strings.ToLower(os.Getenv("STORAGE")),
+		storagePath:        os.Getenv("STORAGE_PATH"),
+		guestRetention:     durationFromEnv("GUEST_RETENTION_IN_DAYS", 24*time.Hour),
+		eventRetention:     durationFromEnv("EVENT_RETENTION_IN_DAYS", 24*time.Hour),
+		retentionDryRun:    strings.ToUpper(os.Getenv("RETENTION_DRY_RUN")) == "TRUE",
+		runsRetention:      strings.ToUpper(os.Getenv("RUN_RETENTION")) == "TRUE",
+		seasonLength:       durationFromEnv("SEASON_LENGTH_IN_DAYS", 24*time.Hour),
+		roundLength:        minutesFromEnv("ROUND_LENGTH_IN_MIN"),
+		hillTimeToWin:      durationFromEnv("HILL_SECONDS_TO_WIN", time.Second),
+		huntingNpcs:        strings.ToUpper(os.Getenv("HUNTING_NPCS")) == "TRUE",
 	}
 
 	// Runtime configuration
@@ -132,6 +178,23 @@ func getConfiguration() *Configuration {
 	return &config
 }
 
+func minutesFromEnv(name string) time.Duration {
+	return durationFromEnv(name, time.Minute)
+}
+
+func durationFromEnv(name string, unit time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		logger.Error().Msg("Invalid value for " + name + ": " + value)
+		return 0
+	}
+	return time.Duration(count) * unit
+}
+
 func (config *Configuration) getMongoCredentialString() string {
 	if config.mongoUser != "" && config.mongoPass != "" {
 		return config.mongoUser + ":" + config.mongoPass + "@"
@@ -216,20 +279,30 @@ type Transport struct {
 }
 
 type Area struct {
-	Name           string                       `json:"name"`
-	Safe           bool                         `json:"safe"`
-	Tiles          [][]Material                 `json:"tiles"`
-	Transports     []Transport                  `json:"transports"`
-	Interactables  [][]*InteractableDescription `json:"interactables"`
-	North          string                       `json:"north"`
-	South          string                       `json:"south"`
-	East           string                       `json:"east"`
-	West           string                       `json:"west"`
-	MapId          string                       `json:"mapId"`
-	LoadStrategy   string                       `json:"loadStrategy,omitempty"`
-	SpawnStrategy  string                       `json:"spawnStrategy,omitempty"`
-	BroadcastGroup string                       `json:"broadcastGroup,omitempty"`
-	Weather        string                       `json:"weather,omitempty"`
+	Name           string                           `json:"name"`
+	Safe           bool                             `json:"safe"`
+	Tiles          [][]Material                     `json:"tiles"`
+	Transports     []Transport                      `json:"transports"`
+	Interactables  [][]*InteractableDescription     `json:"interactables"`
+	North          string                           `json:"north"`
+	South          string                           `json:"south"`
+	East           string                           `json:"east"`
+	West           string                           `json:"west"`
+	MapId          string                           `json:"mapId"`
+	LoadStrategy   string                           `json:"loadStrategy,omitempty"`
+	SpawnStrategy  string                           `json:"spawnStrategy,omitempty"`
+	BroadcastGroup string                           `json:"broadcastGroup,omitempty"`
+	Weather        string                           `json:"weather,omitempty"`
+	Reactions      map[string][]ReactionDescription `json:"reactions,omitempty"`
+	Hill           *HillDescription                 `json:"hill,omitempty"` // King of the hill, at most one area
+}
+
+// Inclusive bounds
+type HillDescription struct {
+	Y0 int `json:"y0"`
+	X0 int `json:"x0"`
+	Y1 int `json:"y1"`
+	X1 int `json:"x1"`
 }
 
 type InteractableDescription struct {
@@ -244,7 +317,8 @@ type InteractableDescription struct {
 }
 
 var (
-	areas []Area
+	areas     []Area
+	areasLock sync.RWMutex // Areas may be replaced at runtime, see reloadAreas
 )
 
 func populateStructUsingFileName[T any](ptr *T, filename string) {
@@ -260,10 +334,19 @@ func populateStructUsingFileName[T any](ptr *T, filename string) {
 
 // This should return values instead of populating globals
 func loadFromJson() {
+	areasLock.Lock()
+	defer areasLock.Unlock()
 	populateStructUsingFileName(&areas, "areas")
+	for _, area := range areas {
+		if _, err := compileAreaReactions(area); err != nil {
+			panic(fmt.Errorf("area %s: %w", area.Name, err))
+		}
+	}
 }
 
 func areaFromName(s string) (area Area, success bool) {
+	areasLock.RLock()
+	defer areasLock.RUnlock()
 	for _, area := range areas {
 		if area.Name == s {
 			return area, true
@@ -272,6 +355,17 @@ func areaFromName(s string) (area Area, success bool) {
 	return Area{}, false
 }
 
+func areaNames() []string {
+	areasLock.RLock()
+	defer areasLock.RUnlock()
+	out := make([]string, 0, len(areas))
+	for _, area := range areas {
+		out = append(out, area.Name)
+	}
+	sort.Strings(out)
+	return out
+}
+
 ///////////////////////////////////////////////////////////////
 // Set global log level
 
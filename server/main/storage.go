@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// Selected with STORAGE, the embedded store keeps its files in STORAGE_PATH
+const (
+	STORAGE_MONGO        = "mongo"
+	STORAGE_FILE         = "file"
+	DEFAULT_STORAGE_PATH = "./data/store"
+)
+
+var errRecordNotFound = errors.New("record not found")
+
+var (
+	_ Storage = (*DB)(nil)
+	_ Storage = (*FileStore)(nil)
+)
+
+// Everything persisted. *DB is backed by Mongo, *FileStore by local files or memory alone.
+type Storage interface {
+	UserStore
+	PlayerStore
+	EventStore
+	SessionStore
+	RankingProvider
+	RetentionStore
+	BanStore
+}
+
+// Authorized accounts, keyed by provider identifier
+type UserStore interface {
+	getAuthorizedUserById(identifier string) *UserRecord
+	insertAuthorizedUser(user UserRecord) error
+	updateUsernameForUserWithId(identifier, username string) bool
+	// All or nothing - the guest's progress goes to the user's player, or becomes a new player named username
+	// for a user without one, and the guest record is removed. Returns the username of the linked player.
+	linkGuestToUser(identifier, guest, username string) (string, error)
+}
+
+type PlayerStore interface {
+	InsertPlayerRecord(player PlayerRecord) error
+	getPlayerRecord(username string) (PlayerRecord, error)
+	foundUsername(username string) bool
+	updateRecordForPlayer(p *Player, pTile *Tile) error
+	updateLoginForPlayer(p *Player) error
+	updatePlayerRecordOnLogout(p *Player, pTile *Tile) error
+	updateTeamForPlayer(username, team string) error
+	addAccomplishmentToPlayer(username string, key string, value Accomplishment) error
+	updateInventoryForPlayer(username string, inventory InventoryRecord) error
+}
+
+type EventStore interface {
+	saveKillEvent(tile *Tile, initiator Character, defeated *Player) error
+	saveScoreEvent(tile *Tile, initiator *Player, message string) error
+	savePurchaseEvent(tile *Tile, buyer *Player, itemId string, price int64) error
+	countEventsByTile(ctx context.Context, stageName, eventType string, from, to time.Time) ([]HeatmapCell, error)
+}
+
+// World state carried between sessions of a server
+type SessionStore interface {
+	getMostRecentSessionData(ctx context.Context, serverName string) (*SessionDataRecord, error)
+	saveGameStatus(ctx context.Context, status SessionDataRecord) error
+	getStageSnapshots(ctx context.Context, serverName string) ([]StageSnapshotRecord, error)
+	upsertStageSnapshot(ctx context.Context, record StageSnapshotRecord) error
+}
+
+// Expiry of guests and events, see runRetention
+type RetentionStore interface {
+	countInactiveGuests(ctx context.Context, before time.Time) (int64, error)
+	deleteInactiveGuests(ctx context.Context, before time.Time) (int64, error)
+	rollupEventsBefore(ctx context.Context, before time.Time) ([]DailyEventRecord, error) // Without expiring them
+	// Events are marked first so that exactly those are rolled up and deleted, whatever arrives meanwhile
+	expireEventsBefore(ctx context.Context, before time.Time) (int64, error)
+	rollupExpiredEvents(ctx context.Context) ([]DailyEventRecord, error)
+	saveDailyEvents(ctx context.Context, records []DailyEventRecord) error // Counts are added to existing days
+	deleteExpiredEvents(ctx context.Context) (int64, error)
+}
+
+// Banned usernames, loaded into the world's BanList on start
+type BanStore interface {
+	getBans(ctx context.Context) ([]BanRecord, error)
+	saveBan(ctx context.Context, ban BanRecord) error
+	deleteBan(ctx context.Context, username string) error
+}
+
+func createStorage(config *Configuration) Storage {
+	switch config.storage {
+	case "", STORAGE_MONGO:
+		return createDbConnection(config)
+	case STORAGE_FILE:
+		if config.storagePath == "" {
+			config.storagePath = DEFAULT_STORAGE_PATH
+		}
+		store, err := openFileStore(config.storagePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		logger.Info().Msg("Using embedded storage in: " + config.storagePath)
+		return store
+	}
+	log.Fatal("Unknown storage: " + config.storage)
+	return nil
+}
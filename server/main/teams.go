@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sync"
+)
+
+// Team names double as css classes, e.g. "fuchsia" and "fuchsia-t"
+type Team struct {
+	Name          string       `json:"name"`
+	DisplayName   string       `json:"displayName"`
+	Color         string       `json:"color"`    // Css class for menus and banners, defaults to name
+	Capacity      int          `json:"capacity"` // Zero defaults to CAPACITY_PER_TEAM
+	Infirmary     TeamLocation `json:"infirmary"`
+	Spawn         TeamLocation `json:"spawn"`
+	Territory     string       `json:"territory"`     // Stage prefix, e.g. "team-blue" for team-blue:0-0
+	TerritorySize int          `json:"territorySize"` // Stages per side of territory
+}
+
+// One of Xs is choosen at random
+type TeamLocation struct {
+	Stage string `json:"stage"`
+	Y     int    `json:"y"`
+	Xs    []int  `json:"xs"`
+}
+
+type TeamRegistry struct {
+	sync.RWMutex
+	teams  []Team
+	byName map[string]Team
+}
+
+// First team is the default
+var defaultTeams = []Team{
+	{
+		Name:          "sky-blue",
+		DisplayName:   "Sky-Blue",
+		Infirmary:     TeamLocation{Stage: "infirmary-flattened:0-0", Y: 50, Xs: []int{2, 18, 34, 50}}, // ( 3 * 16 ) + 2
+		Spawn:         TeamLocation{Stage: "team-blue:3-4", Y: 7, Xs: []int{7}},
+		Territory:     "team-blue",
+		TerritorySize: 8,
+	},
+	{
+		Name:          "fuchsia",
+		DisplayName:   "Fuchsia",
+		Infirmary:     TeamLocation{Stage: "infirmary-flattened:0-0", Y: 2, Xs: []int{2, 18, 34, 50}},
+		Spawn:         TeamLocation{Stage: "team-fuchsia:4-3", Y: 7, Xs: []int{7}},
+		Territory:     "team-fuchsia",
+		TerritorySize: 8,
+	},
+}
+
+var teams = createTeamRegistry(defaultTeams)
+
+func createTeamRegistry(list []Team) *TeamRegistry {
+	registry := &TeamRegistry{}
+	registry.set(list)
+	return registry
+}
+
+func (registry *TeamRegistry) set(list []Team) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.teams = make([]Team, 0, len(list))
+	registry.byName = make(map[string]Team, len(list))
+	for _, team := range list {
+		if team.Color == "" {
+			team.Color = team.Name
+		}
+		if team.DisplayName == "" {
+			team.DisplayName = team.Name
+		}
+		registry.teams = append(registry.teams, team)
+		registry.byName[team.Name] = team
+	}
+}
+
+func (registry *TeamRegistry) list() []Team {
+	registry.RLock()
+	defer registry.RUnlock()
+	return append([]Team{}, registry.teams...)
+}
+
+func (registry *TeamRegistry) get(name string) (Team, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	team, ok := registry.byName[name]
+	return team, ok
+}
+
+func (registry *TeamRegistry) names() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	out := make([]string, 0, len(registry.teams))
+	for _, team := range registry.teams {
+		out = append(out, team.Name)
+	}
+	return out
+}
+
+////////////////////////////////////////////////////////////
+// Load
+
+// Optional - The default fuchsia vs sky-blue teams are used without ./data/teams.json
+func loadTeams() {
+	jsonData, err := os.ReadFile("./data/teams.json")
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	var list []Team
+	if err := json.Unmarshal(jsonData, &list); err != nil {
+		panic(err)
+	}
+	if err := validateTeams(list); err != nil {
+		panic(err)
+	}
+	teams.set(list)
+	for _, team := range list {
+		addTeamReactions(team.Name)
+	}
+	logger.Info().Msgf("Loaded %d teams", len(list))
+}
+
+func validateTeams(list []Team) error {
+	if len(list) == 0 {
+		return fmt.Errorf("no teams")
+	}
+	seen := make(map[string]struct{}, len(list))
+	for _, team := range list {
+		if team.Name == "" {
+			return fmt.Errorf("team with empty name")
+		}
+		if _, duplicate := seen[team.Name]; duplicate {
+			return fmt.Errorf("duplicate team: %s", team.Name)
+		}
+		seen[team.Name] = struct{}{}
+		if team.Capacity < 0 {
+			return fmt.Errorf("team %s has negative capacity", team.Name)
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////
+// Lookup
+
+func validTeam(team string) bool {
+	_, ok := teams.get(team)
+	return ok
+}
+
+func defaultTeamName() string {
+	return teams.names()[0]
+}
+
+func randomTeamName() string {
+	names := teams.names()
+	return names[rand.IntN(len(names))]
+}
+
+func otherTeamNames(team string) []string {
+	out := make([]string, 0)
+	for _, name := range teams.names() {
+		if name != team {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func capacityOfTeam(name string) int {
+	team, ok := teams.get(name)
+	if !ok || team.Capacity == 0 {
+		return CAPACITY_PER_TEAM
+	}
+	return team.Capacity
+}
+
+func (location TeamLocation) coords() (int, int) {
+	if len(location.Xs) == 0 {
+		return location.Y, 0
+	}
+	return location.Y, location.Xs[rand.IntN(len(location.Xs))]
+}
+
+// Random stage in the territory of any other team
+func hidingStageForBallOf(team string, intn func(int) int) (string, bool) {
+	candidates := make([]Team, 0)
+	for _, name := range otherTeamNames(team) {
+		other, _ := teams.get(name)
+		if other.Territory != "" && other.TerritorySize > 0 {
+			candidates = append(candidates, other)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	other := candidates[intn(len(candidates))]
+	return fmt.Sprintf("%s:%d-%d", other.Territory, intn(other.TerritorySize), intn(other.TerritorySize)), true
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+)
+
+func withTestingTeams(t *testing.T, list []Team) {
+	t.Helper()
+	teams.set(list)
+	for _, team := range list {
+		addTeamReactions(team.Name)
+	}
+	t.Cleanup(func() { teams.set(defaultTeams) })
+}
+
+func TestThreeTeams(t *testing.T) {
+	withTestingTeams(t, []Team{
+		{Name: "red", Capacity: 1, Infirmary: TeamLocation{Stage: "infirmary-red", Y: 3, Xs: []int{4}}},
+		{Name: "green"},
+		{Name: "gold", Capacity: 2},
+	})
+
+	if !validTeam("gold") || validTeam("fuchsia") {
+		t.Error("registry should replace the default teams")
+	}
+	if defaultTeamName() != "red" {
+		t.Error("first team should be the default")
+	}
+	others := otherTeamNames("green")
+	if len(others) != 2 || others[0] != "red" || others[1] != "gold" {
+		t.Errorf("unexpected other teams: %v", others)
+	}
+	if capacityOfTeam("gold") != 2 || capacityOfTeam("green") != CAPACITY_PER_TEAM {
+		t.Error("capacity should default to CAPACITY_PER_TEAM")
+	}
+	if _, ok := interactableReactions["goal-gold"]; !ok {
+		t.Error("goal reactions should be registered for every team")
+	}
+
+	red := &Player{team: "red"}
+	if infirmaryStagenameForPlayer(red) != "infirmary-red" {
+		t.Error("red should use its home infirmary")
+	}
+	if y, x := infirmaryCoordsForPlayer(red); y != 3 || x != 4 {
+		t.Errorf("unexpected infirmary coords %d,%d", y, x)
+	}
+	if infirmaryStagenameForPlayer(&Player{team: "green"}) != "clinic" {
+		t.Error("teams without an infirmary should use the clinic")
+	}
+
+	status := &TeamPlayerStatus{playerCounts: map[string]int{"red": 1, "green": CAPACITY_PER_TEAM, "gold": 2}}
+	if vacancyOfLockedWorldStatus(status) {
+		t.Error("every team is at capacity")
+	}
+	status.playerCounts["gold"] = 1
+	if !vacancyOfLockedWorldStatus(status) {
+		t.Error("gold has a vacancy")
+	}
+	counts := teamCountsOfLockedWorldStatus(status)
+	if len(counts) != 3 || counts[0].Color != "red" || counts[2].Count != 1 {
+		t.Errorf("unexpected banner counts: %v", counts)
+	}
+
+	scoreboard := &Scoreboard{}
+	scoreboard.Add("gold", 4)
+	if line := scoresStartingWith(scoreboard, "gold"); line != "@[gold 4|gold] to @[red 0|red] to @[green 0|green]" {
+		t.Errorf("unexpected score line: %s", line)
+	}
+}
+
+func TestValidateTeams(t *testing.T) {
+	if validateTeams(nil) == nil {
+		t.Error("expected error for no teams")
+	}
+	if validateTeams([]Team{{Name: "a"}, {Name: "a"}}) == nil {
+		t.Error("expected error for duplicate teams")
+	}
+	if validateTeams([]Team{{Name: "a", Capacity: -1}}) == nil {
+		t.Error("expected error for negative capacity")
+	}
+}
@@ -230,13 +230,25 @@ func (tile *Tile) getACharacter() Character {
 // Updates
 
 func (tile *Tile) updateAll(update string) {
+	tile.updateAllIn(nil, update)
+}
+
+// Deferred to the end of the tick when given the batch of a scheduler task, nil sends right away
+func (tile *Tile) updateAllIn(batch *UpdateBatch, update string) {
 	// Send to zone containing this tile and neighboring zones (Only cameras in these zones can see this tile)
-	tile.primaryZone.updateAll(update)
+	tile.updateZone(batch, tile.primaryZone, update)
 	for _, section := range tile.adjacentZones {
-		section.updateAll(update)
+		tile.updateZone(batch, section, update)
 	}
 }
 
+func (tile *Tile) updateZone(batch *UpdateBatch, zone *CameraZone, update string) {
+	if batch.add(zone, update) {
+		return
+	}
+	zone.updateAll(update)
+}
+
 func (tile *Tile) updateAllWithSound(soundName string) {
 	tile.updateAll(soundTriggerByName(soundName))
 }
@@ -244,20 +256,22 @@ func (tile *Tile) updateAllWithSound(soundName string) {
 /////////////////////////////////////////////////////////////////////
 // Damage
 
-func damageAndIndicate(tiles []*Tile, initiator Character, damage int) int {
+// Batch is nil unless called from a scheduler task
+func damageAndIndicate(tiles []*Tile, initiator Character, damage int, batch *UpdateBatch) int {
 	fatalities := 0
 	color := randomFieryColor()
 	for _, tile := range tiles {
-		fatalities += tile.damageAll(damage, initiator)
+		fatalities += tile.damageAll(damage, initiator, batch)
 		destroyFragileInteractable(tile, initiator)
 		tile.eventsInFlight.Add(1)
-		tile.updateAll(weatherBox(tile, color) + soundTriggerByName("explosion"))
-		go tile.tryToNotifyAfter(100)
+		metrics.eventsInFlight.Add(1)
+		tile.updateAllIn(batch, weatherBox(tile, color)+soundTriggerByName("explosion"))
+		scheduleAfter(tile.stage, 100*time.Millisecond, tile.tryToNotify)
 	}
 	return fatalities
 }
 
-func (tile *Tile) damageAll(dmg int, initiator Character) int {
+func (tile *Tile) damageAll(dmg int, initiator Character, batch *UpdateBatch) int {
 	fatalities := 0
 	for _, character := range tile.copyOfCharacters() {
 		fatal := character.takeDamageFrom(initiator, dmg)
@@ -265,7 +279,7 @@ func (tile *Tile) damageAll(dmg int, initiator Character) int {
 			fatalities++
 		}
 	}
-	tile.updateAll(characterBox(tile))
+	tile.updateAllIn(batch, characterBox(tile))
 	return fatalities
 }
 
@@ -330,11 +344,11 @@ func safeFromDamage(tile *Tile) bool {
 ////////////////////////////////////////////////////////////////////////
 //  Notify
 
-func (tile *Tile) tryToNotifyAfter(delay int) {
-	time.Sleep(time.Millisecond * time.Duration(delay))
+func (tile *Tile) tryToNotify(batch *UpdateBatch) {
+	metrics.eventsInFlight.Add(-1)
 	if tile.eventsInFlight.Add(-1) == 0 {
 		// blue trsp20 for gloom
-		tile.updateAll(weatherBox(tile, tile.stage.weather))
+		tile.updateAllIn(batch, weatherBox(tile, tile.stage.weather))
 	}
 }
 
@@ -14,6 +14,7 @@ import (
 )
 
 const SESSION_SNAPSHOT_INTERVAL_IN_MIN = 30
+const STAGE_REAPER_INTERVAL_IN_SEC = 60
 
 // Should be in env file?
 var CAPACITY_PER_TEAM = 200 // Is modified by test => not const
@@ -26,18 +27,33 @@ type World struct {
 	teamPlayerStatus    TeamPlayerStatus
 	incomingPlayers     map[string]*LoginRequest
 	incomingPlayerMutex sync.Mutex
+	parkedPlayers       map[string]*ParkedPlayer // By resume token
+	parkedMutex         sync.Mutex
 	playersToLogout     chan *Player
 	worldStages         map[string]*Stage
 	wStageMutex         sync.Mutex
+	evictedStages       *StageSnapshots
+	stageSeeds          map[string]int64 // Replays only, by world stage key. Guarded by wStageMutex
+	persistedStages     *StageSnapshots  // Last state written to storage, nil unless persistence is enabled
+	recorder            *Recorder        // Nil unless matches are recorded
 	leaderBoard         *LeaderBoard
+	gameModes           map[string]GameMode // Every mode keeps a scoreboard
+	gameMode            GameMode
+	gameModeLock        sync.Mutex
 	sessionStats        *WorldSessionData
+	bandwidth           *BandwidthStats
+	bans                *BanList
+	audit               *AuditLog
+	shuttingDown        atomic.Bool
+	pendingSaves        sync.WaitGroup // Logout saves in flight
+	stopped             chan struct{}  // Closed by stop, ends the background goroutines
+	stopOnce            sync.Once
 }
 
 type TeamPlayerStatus struct {
 	sync.Mutex
-	lastStatusCheck    time.Time
-	fuchsiaPlayerCount int
-	skyBluePlayerCount int
+	lastStatusCheck time.Time
+	playerCounts    map[string]int
 }
 
 type LoginRequest struct {
@@ -58,7 +74,11 @@ type WorldSessionData struct {
 //////////////////////////////////////////////////////////////////
 // Create World
 
-func createGameWorld(db *DB, config *Configuration) *World {
+// Without storage everything is kept in memory
+func createGameWorld(db Storage, config *Configuration) *World {
+	if db == nil {
+		db = createMemoryStore()
+	}
 	out := &World{
 		App: App{
 			db:     db,
@@ -69,36 +89,63 @@ func createGameWorld(db *DB, config *Configuration) *World {
 		teamQuantities:      map[string]int{},
 		incomingPlayers:     make(map[string]*LoginRequest),
 		incomingPlayerMutex: sync.Mutex{},
+		parkedPlayers:       make(map[string]*ParkedPlayer),
 		playersToLogout:     make(chan *Player),
 		worldStages:         make(map[string]*Stage),
 		wStageMutex:         sync.Mutex{},
+		evictedStages:       createStageSnapshots(),
 		leaderBoard:         createLeaderBoard(),
+		gameModes:           createGameModes(config),
 		sessionStats: &WorldSessionData{
 			sessionStartTime: time.Now(),
 		},
+		bandwidth: &BandwidthStats{},
+		bans:      createBanList(db),
+		audit:     createAuditLog(config.auditLogPath),
+		stopped:   make(chan struct{}),
+	}
+	if config.gameMode == "" || !out.setGameMode(config.gameMode) {
+		if config.gameMode != "" {
+			logger.Warn().Msg("Unknown game mode: " + config.gameMode + " - Defaulting to ctf")
+		}
+		out.setGameMode("ctf")
 	}
 	if config.loadPreviousState {
 		loadPreviousState(out)
 	}
+	if config.persistStages {
+		out.persistedStages = createStageSnapshots()
+		loadStageSnapshots(out)
+	}
+	if config.recordMatches {
+		out.recorder = createRecorder(RECORDINGS_DIRECTORY, config.serverName)
+		out.recorder.rotate(out)
+	}
 	go processMostDangerous(out, &out.leaderBoard.mostDangerous)
-	go processLogouts(out.playersToLogout)
+	go processLogouts(out.playersToLogout, out.stopped)
+	go runGameMode(out)
 	return out
 }
 
+// For worlds that end before the process, such as replays. Everyone should be logged out first.
+func (world *World) stop() {
+	world.stopOnce.Do(func() { close(world.stopped) })
+}
+
 func createLeaderBoard() *LeaderBoard {
 	lb := &LeaderBoard{mostDangerous: MaxStreakHeap{items: make([]PlayerStreakRecord, 0), index: make(map[string]int), incoming: make(chan PlayerStreakRecord)}}
 	return lb
 }
 
 func loadPreviousState(world *World) {
-	lastStatus, err := getMostRecentSessionData(context.TODO(), world.db.sessionData, world.config.serverName)
+	lastStatus, err := world.db.getMostRecentSessionData(context.TODO(), world.config.serverName)
 	if err != nil {
 		logger.Error().Msg("Error: " + err.Error())
 	}
 	if lastStatus == nil {
 		return
 	}
-	world.leaderBoard.scoreboard.Import(lastStatus.Scoreboard)
+	world.importScoreboards(lastStatus)
 }
 
 ///////////////////////////////////////////////////////////////
@@ -109,6 +156,7 @@ func periodicSnapshot(world *World) {
 	defer ticker.Stop()
 	for range ticker.C {
 		saveCurrentStatus(world)
+		saveStageSnapshots(world)
 	}
 }
 
@@ -125,12 +173,14 @@ func saveCurrentStatus(world *World) {
 		TotalSessionLogins:     int(world.sessionStats.TotalSessionLogins.Load()),
 		TotalSessionLogouts:    int(world.sessionStats.TotalSessionLogouts.Load()),
 		CurrentTeamPlayerCount: CopyTeamQuantities(world),
-		Scoreboard:             world.leaderBoard.scoreboard.Export(),
+		Scoreboard:             world.getGameModeSync().getScoreboard().Export(),
+		GameMode:               world.getGameModeSync().getName(),
+		ModeScoreboards:        world.exportScoreboards(),
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := saveGameStatus(ctx, world.db.sessionData, status); err != nil {
+	if err := world.db.saveGameStatus(ctx, status); err != nil {
 		logger.Error().Msg(fmt.Sprintf("failed to save current game status: %v", err))
 	}
 }
@@ -174,6 +224,60 @@ func CopyTeamQuantities(world *World) map[string]int {
 	return newMap
 }
 
+/////////////////////////////////////////////////////
+// Idle Stages
+
+func reapIdleStages(world *World) {
+	ticker := time.NewTicker(time.Duration(STAGE_REAPER_INTERVAL_IN_SEC) * time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		evicted := world.evictIdleStages(now)
+		if evicted > 0 {
+			logger.Info().Msgf("Evicted %d idle stages", evicted)
+		}
+	}
+}
+
+func (world *World) evictIdleStages(now time.Time) int {
+	idlePeriod := world.config.stageIdleEviction
+	count := 0
+
+	world.wStageMutex.Lock()
+	for key, stage := range world.worldStages {
+		if stage == nil || !stage.evictable(now, idlePeriod) {
+			continue
+		}
+		if world.config.persistIdleStages {
+			world.evictedStages.put(key, snapshotStage(stage))
+		}
+		delete(world.worldStages, key)
+		count++
+	}
+	world.wStageMutex.Unlock()
+
+	for _, player := range world.copyOfPlayers() {
+		count += player.evictIdleStages(now, idlePeriod)
+	}
+	return count
+}
+
+func (player *Player) evictIdleStages(now time.Time, idlePeriod time.Duration) int {
+	count := 0
+	player.pStageMutex.Lock()
+	defer player.pStageMutex.Unlock()
+	for key, stage := range player.playerStages {
+		if stage == nil || !stage.evictable(now, idlePeriod) {
+			continue
+		}
+		if player.world.config.persistIdleStages {
+			player.evictedStages.put(key, snapshotStage(stage))
+		}
+		delete(player.playerStages, key)
+		count++
+	}
+	return count
+}
+
 /////////////////////////////////////////////////////
 // Add / Remove / Find Players
 
@@ -203,6 +307,16 @@ func (world *World) getPlayerById(id string) *Player {
 	return player
 }
 
+func (world *World) copyOfPlayers() []*Player {
+	world.wPlayerMutex.Lock()
+	defer world.wPlayerMutex.Unlock()
+	out := make([]*Player, 0, len(world.worldPlayers))
+	for _, player := range world.worldPlayers {
+		out = append(out, player)
+	}
+	return out
+}
+
 //////////////////////////////////////////////////
 //  Log in
 
@@ -255,6 +369,14 @@ func createRandomToken() string {
 
 func (world *World) join(incoming *LoginRequest, conn WebsocketConnection) *Player {
 	// fmt.Println("Joining " + incoming.Record.Username)
+	if parked := world.unparkByUsername(incoming.Record.Username); parked != nil {
+		return world.resume(parked, conn)
+	}
+	if world.bans.isBanned(incoming.Record.Username) {
+		sendUnableToJoinMessage(conn, "You have been banned.")
+		logger.Warn().Msg("Banned user attempting to log in: " + incoming.Record.Username)
+		return nil
+	}
 	if world.isLoggedInAlready(incoming.Record.Username) {
 		sendUnableToJoinMessage(conn, "You are already logged in.")
 		logger.Warn().Msg("User attempting to log in but is logged in already: " + incoming.Record.Username)
@@ -270,14 +392,17 @@ func (world *World) join(incoming *LoginRequest, conn WebsocketConnection) *Play
 	}
 
 	camera := newCamera(newPlayer.updates)
-	emptyScreen := emptyScreenBySize(camera.height, camera.width)
+	emptyScreen := initialScreen(conn, camera.height, camera.width)
 	if !sendInitialScreen(conn, emptyScreen) {
 		return nil
 	}
 	newPlayer.camera = camera
+	attachPlayer(conn, newPlayer)
 
 	newPlayer.updateRecordOnLogin()
 	newPlayer.conn = conn
+	newPlayer.connected.Store(true)
+	newPlayer.resumeToken = createRandomToken()
 	go newPlayer.sendUpdates()
 
 	count := world.addPlayer(newPlayer)
@@ -291,6 +416,8 @@ func (world *World) join(incoming *LoginRequest, conn WebsocketConnection) *Play
 	}
 
 	placePlayerOnStageAt(newPlayer, stage, incoming.Record.Y, incoming.Record.X)
+	world.recorder.recordJoin(newPlayer, stage.tiles[incoming.Record.Y][incoming.Record.X])
+	sendResumeToken(newPlayer)
 	return newPlayer
 }
 
@@ -315,8 +442,11 @@ const unableToJoin = `
 </div>`
 
 func sendUnableToJoinMessage(conn WebsocketConnection, description string) {
-	errorMessage := fmt.Sprintf(unableToJoin, description)
-	conn.WriteMessage(websocket.TextMessage, []byte(errorMessage))
+	errorMessage := []byte(fmt.Sprintf(unableToJoin, description))
+	if speaksJson(conn) {
+		errorMessage = eventRecord(MessageEvent{Type: "error", Text: "Unable to join. " + description})
+	}
+	conn.WriteMessage(websocket.TextMessage, errorMessage)
 }
 
 func sendInitialScreen(conn WebsocketConnection, screen []byte) bool {
@@ -337,24 +467,25 @@ func (world *World) teamAtCapacity(teamName string) bool {
 	world.wPlayerMutex.Lock()
 	defer world.wPlayerMutex.Unlock()
 	count := world.teamQuantities[teamName]
-	return count >= CAPACITY_PER_TEAM
+	return count >= capacityOfTeam(teamName)
 }
 
 func (world *World) newPlayerFromRecord(record PlayerRecord, id string) *Player {
 	// probably take this out later...
 	if record.Team == "" {
-		record.Team = "sky-blue"
+		record.Team = defaultTeamName()
 	}
 	newPlayer := &Player{
 		id:                       id,
 		username:                 record.Username,
-		updates:                  make(chan []byte),
+		updates:                  make(chan []byte, UPDATE_QUEUE_SIZE),
 		sessionTimeOutViolations: atomic.Int32{},
 		tangible:                 true,
 		tangibilityLock:          sync.Mutex{},
 		actions:                  createDefaultActions(),
 		world:                    world,
 		playerStages:             make(map[string]*Stage),
+		evictedStages:            createStageSnapshots(),
 		team:                     record.Team,
 		accomplishments:          SyncAccomplishmentList{Accomplishments: record.Accomplishments},
 		SyncMenuList: SyncMenuList{
@@ -376,6 +507,8 @@ func (world *World) newPlayerFromRecord(record PlayerRecord, id string) *Player
 	newPlayer.money.Store(record.Money)
 	storePlayerStats(&newPlayer.PlayerStats, record)
 
+	newPlayer.inventory.load(record)
+	newPlayer.wearActiveHat()
 	newPlayer.setIcon()
 	return newPlayer
 }
@@ -400,15 +533,33 @@ func (world *World) isLoggedInAlready(username string) bool {
 	return false
 }
 
+func (world *World) getPlayerByUsername(username string) *Player {
+	world.wPlayerMutex.Lock()
+	defer world.wPlayerMutex.Unlock()
+	for _, player := range world.worldPlayers {
+		if player.username == username {
+			return player
+		}
+	}
+	return nil
+}
+
 //////////////////////////////////////////////////////
 //	Logging Out
 
-func processLogouts(players chan *Player) {
+func processLogouts(players chan *Player, stopped <-chan struct{}) {
 	for {
-		player, ok := <-players
+		var player *Player
+		var ok bool
+		select {
+		case player, ok = <-players:
+		case <-stopped:
+			return
+		}
 		if !ok {
 			return
 		}
+		metrics.logoutQueue.Add(-1)
 
 		completeLogout(player)
 	}
@@ -420,13 +571,18 @@ func initiateLogout(player *Player) {
 	player.tangible = false
 
 	logger.Info().Msg("initate logout: " + player.username)
+	player.world.recorder.recordLeave(player)
 	//   Add time delay to prevent rage quit ? - Consequence of intangibility in this window?
 	removeFromTileAndStage(player)
 
+	metrics.logoutQueue.Add(1)
 	player.world.playersToLogout <- player
 }
 
 func completeLogout(player *Player) {
+	if !player.loggedOut.CompareAndSwap(false, true) {
+		return // Already logged out by shutdown
+	}
 	player.updateRecordOnLogout() // Should return error
 
 	player.world.leaderBoard.mostDangerous.incoming <- PlayerStreakRecord{id: player.id, username: player.username, killstreak: 0, team: ""}
@@ -443,6 +599,11 @@ func completeLogout(player *Player) {
 // References / Lookup
 
 func getRelativeTile(source *Tile, yOff, xOff int, character Character) *Tile {
+	return relativeTileVia(source, yOff, xOff, character.fetchStageSync)
+}
+
+// Neighboring stages are found through fetch, which may create them
+func relativeTileVia(source *Tile, yOff, xOff int, fetch func(stagename string) *Stage) *Tile {
 	destY := source.y + yOff
 	destX := source.x + xOff
 	if validCoordinate(destY, destX, source.stage) {
@@ -458,10 +619,10 @@ func getRelativeTile(source *Tile, yOff, xOff int, character Character) *Tile {
 		if escapesVertically {
 			var newStage *Stage
 			if yOff > 0 {
-				newStage = character.fetchStageSync(source.stage.south)
+				newStage = fetch(source.stage.south)
 			}
 			if yOff < 0 {
-				newStage = character.fetchStageSync(source.stage.north)
+				newStage = fetch(source.stage.north)
 			}
 
 			if newStage != nil && validCoordinate(mod(destY, len(newStage.tiles)), destX, newStage) {
@@ -471,10 +632,10 @@ func getRelativeTile(source *Tile, yOff, xOff int, character Character) *Tile {
 		if escapesHorizontally {
 			var newStage *Stage
 			if xOff > 0 {
-				newStage = character.fetchStageSync(source.stage.east)
+				newStage = fetch(source.stage.east)
 			}
 			if xOff < 0 {
-				newStage = character.fetchStageSync(source.stage.west)
+				newStage = fetch(source.stage.west)
 			}
 
 			if newStage != nil && validCoordinate(destY, mod(destX, len(newStage.tiles)), newStage) {
@@ -491,7 +652,6 @@ func getRelativeTile(source *Tile, yOff, xOff int, character Character) *Tile {
 
 type LeaderBoard struct {
 	mostDangerous MaxStreakHeap
-	scoreboard    Scoreboard
 }
 
 type Scoreboard struct {
@@ -499,11 +659,14 @@ type Scoreboard struct {
 }
 
 func (s *Scoreboard) Increment(team string) int {
+	return s.Add(team, 1)
+}
+
+func (s *Scoreboard) Add(team string, points int) int {
 	val, _ := s.data.LoadOrStore(team, &atomic.Int64{})
 	score := val.(*atomic.Int64)
 
-	score.Add(1)
-	return int(score.Load())
+	return int(score.Add(int64(points)))
 }
 
 func (s *Scoreboard) ResetAll() {
@@ -614,7 +777,13 @@ func (heap *MaxStreakHeap) Peek() PlayerStreakRecord {
 func processMostDangerous(world *World, h *MaxStreakHeap) {
 	for {
 		previousMostDangerous := h.Peek()
-		event, ok := <-h.incoming
+		var event PlayerStreakRecord
+		var ok bool
+		select {
+		case event, ok = <-h.incoming:
+		case <-world.stopped:
+			return
+		}
 		if !ok {
 			logger.Warn().Msg("Stopping Processing for High-KillStreak Heap - incoming closed")
 			break
@@ -699,12 +868,17 @@ func broadcastUpdate(world *World, message string) {
 	}
 }
 
+// Hats are set after releasing the lock, setting one may save to the db
 func awardHatByTeam(world *World, team, hatName string) {
 	world.wPlayerMutex.Lock()
-	defer world.wPlayerMutex.Unlock()
+	winners := make([]*Player, 0)
 	for _, p := range world.worldPlayers {
 		if p.getTeamNameSync() == team {
-			p.setHatByName(hatName)
+			winners = append(winners, p)
 		}
 	}
+	world.wPlayerMutex.Unlock()
+	for _, p := range winners {
+		p.setHatByName(hatName)
+	}
 }
@@ -340,7 +340,7 @@ func TestNewPlayerFromRecord(t *testing.T) {
 
 func createWorldForTesting() (*World, context.CancelFunc) {
 	loadFromJson()
-	world := createGameWorld(testdb(), &testingConfig)
+	world := createGameWorld(createMemoryStore(), &testingConfig)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go func(ctx context.Context) {
@@ -356,6 +356,50 @@ func createWorldForTesting() (*World, context.CancelFunc) {
 	return world, cancel
 }
 
+// A headless world with extra areas, removed again once the test ends
+func createWorldWithAreasForTesting(t *testing.T, config *Configuration, added ...Area) *World {
+	addAreasForTesting(t, added...)
+	return createGameWorld(nil, config)
+}
+
+func addAreasForTesting(t *testing.T, added ...Area) {
+	areasLock.RLock()
+	extended := append(append([]Area{}, areas...), added...)
+	areasLock.RUnlock()
+	replaceAreasForTesting(t, extended)
+}
+
+func replaceAreasForTesting(t *testing.T, replacement []Area) {
+	areasLock.Lock()
+	defer areasLock.Unlock()
+	previous := areas
+	areas = replacement
+	t.Cleanup(func() {
+		areasLock.Lock()
+		defer areasLock.Unlock()
+		areas = previous
+	})
+}
+
+func walkableTilesForTesting(height, width int) [][]Material {
+	tiles := make([][]Material, height)
+	for y := range tiles {
+		tiles[y] = make([]Material, width)
+		for x := range tiles[y] {
+			tiles[y][x] = Material{Walkable: true}
+		}
+	}
+	return tiles
+}
+
+func joinPlayerForTesting(t *testing.T, world *World, record PlayerRecord, conn WebsocketConnection) *Player {
+	player := world.join(createLoginRequest(record), conn)
+	if player == nil {
+		t.Fatal("failed to join " + record.Username)
+	}
+	return player
+}
+
 func loadStageByName(world *World, name string) *Stage {
 	area, success := areaFromName(name)
 	if !success {
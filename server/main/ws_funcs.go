@@ -31,12 +31,16 @@ var (
 		CheckOrigin: func(r *http.Request) bool {
 			return true
 		},
+		EnableCompression: true, // permessage-deflate when the client offers it
 	}
 )
 
 const MAX_IDLE_IN_SECONDS = 600 * time.Second
 
 func (world *World) NewSocketConnection(w http.ResponseWriter, r *http.Request) {
+	if rejectWhileShuttingDown(world, w) {
+		return
+	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		logger.Error().Err(err).Msg("Error:")
@@ -44,19 +48,31 @@ func (world *World) NewSocketConnection(w http.ResponseWriter, r *http.Request)
 	}
 	defer conn.Close()
 
-	token, success := getTokenFromFirstMessage(conn)
+	token, protocol, success := getTokenFromFirstMessage(conn)
 	if !success {
 		logger.Info().Msg("Invalid Connection")
 		return
 	}
+	metered := meterConnection(conn, world.bandwidth, compressionNegotiated(r))
+	wsConn, supported := negotiateProtocol(metered, protocol)
+	if !supported {
+		sendUnableToJoinMessage(conn, "Unsupported protocol.")
+		return
+	}
 
 	incoming := world.retreiveIncoming(token)
 	if incoming == nil {
+		if parked := world.unparkByToken(token); parked != nil {
+			if player := world.resume(parked, wsConn); player != nil {
+				handleNewPlayer(player)
+			}
+			return
+		}
 		logger.Info().Msg("player not found with token: " + token)
 		return
 	}
 
-	player := world.join(incoming, conn)
+	player := world.join(incoming, wsConn)
 	if player == nil {
 		logger.Info().Msg("Failed to join player with token: " + token)
 		return
@@ -67,17 +83,25 @@ func (world *World) NewSocketConnection(w http.ResponseWriter, r *http.Request)
 }
 
 func handleNewPlayer(player *Player) {
-	defer initiateLogout(player)
 	logger.Info().Msg("New Connection from: " + player.username)
+	err := player.readPresses()
+	if player.world.shuttingDown.Load() {
+		return // Logged out by shutdown
+	}
+	if isTimeout(err) || !player.world.park(player) {
+		sendUpdate(player, divLogOutResume(player, "Inactive. Logging out"))
+		initiateLogout(player)
+	}
+}
+
+func (player *Player) readPresses() error {
 	lastRead := time.Unix(0, 0)
 	previous := ""
 	for {
 		player.conn.SetReadDeadline(time.Now().Add(MAX_IDLE_IN_SECONDS))
 		_, msg, err := player.conn.ReadMessage()
 		if err != nil {
-			// break will initiate logout:
-			sendUpdate(player, divLogOutResume("Inactive. Logging out", player.world.config.domainName))
-			break
+			return err
 		}
 		currentRead := time.Now()
 
@@ -88,6 +112,7 @@ func handleNewPlayer(player *Player) {
 		}
 
 		if player.handlePressActive(event) {
+			player.world.recorder.recordPress(player, event)
 			lastRead = currentRead
 			time.Sleep(20 * time.Millisecond)
 			continue
@@ -99,29 +124,31 @@ func handleNewPlayer(player *Player) {
 		}
 		lastRead = currentRead
 
+		player.world.recorder.recordPress(player, event)
 		player.handlePress(event, previous)
 		player.tryTrack()
 		previous = event.Name
 	}
 }
 
-func getTokenFromFirstMessage(conn *websocket.Conn) (token string, success bool) {
+func getTokenFromFirstMessage(conn *websocket.Conn) (token, protocol string, success bool) {
 	_, bytes, err := conn.ReadMessage()
 	if err != nil {
 		logger.Error().Err(err).Msg("Error reading message from Connection: ")
-		return "", false
+		return "", "", false
 	}
 
 	var msg struct {
-		Token string `json:"token"`
+		Token    string `json:"token"`
+		Protocol string `json:"protocol"`
 	}
 	err = json.Unmarshal(bytes, &msg)
 	if err != nil {
 		logger.Error().Err(err).Msg("Error parsing JSON:")
-		return "", false
+		return "", "", false
 	}
 
-	return msg.Token, true
+	return msg.Token, msg.Protocol, true
 }
 
 func getKeyPress(input []byte) (event *PlayerSocketEvent, success bool) {
@@ -192,6 +219,16 @@ func (player *Player) handlePress(event *PlayerSocketEvent, previous string) {
 		if menu, ok := player.getMenu(event.MenuName); ok {
 			menu.attemptClick(player, *event)
 		}
+	case "chat-team":
+		player.handleChat(chatTeam, event.Arg0)
+	case "chat-stage":
+		player.handleChat(chatStage, event.Arg0)
+	case "chat-world":
+		player.handleChat(chatWorld, event.Arg0)
+	case "mute":
+		player.setMuted(event.Arg0, true)
+	case "unmute":
+		player.setMuted(event.Arg0, false)
 	default:
 		// Unrecognized input
 	}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -8,19 +9,21 @@ import (
 )
 
 type AreaDescription struct {
-	Name           string      `json:"name"`
-	Safe           bool        `json:"safe"`
-	Blueprint      *Blueprint  `json:"blueprint"`
-	Transports     []Transport `json:"transports"`
-	North          string      `json:"north,omitempty"`
-	South          string      `json:"south,omitempty"`
-	East           string      `json:"east,omitempty"`
-	West           string      `json:"west,omitempty"`
-	MapId          string      `json:"mapId"`
-	LoadStrategy   string      `json:"loadStrategy"`
-	SpawnStrategy  string      `json:"spawnStrategy"`
-	BroadcastGroup string      `json:"broadcastGroup,omitempty"`
-	Weather        string      `json:"weather,omitempty"`
+	Name           string          `json:"name"`
+	Safe           bool            `json:"safe"`
+	Blueprint      *Blueprint      `json:"blueprint"`
+	Transports     []Transport     `json:"transports"`
+	North          string          `json:"north,omitempty"`
+	South          string          `json:"south,omitempty"`
+	East           string          `json:"east,omitempty"`
+	West           string          `json:"west,omitempty"`
+	MapId          string          `json:"mapId"`
+	LoadStrategy   string          `json:"loadStrategy"`
+	SpawnStrategy  string          `json:"spawnStrategy"`
+	BroadcastGroup string          `json:"broadcastGroup,omitempty"`
+	Weather        string          `json:"weather,omitempty"`
+	Reactions      json.RawMessage `json:"reactions,omitempty"` // Passed through to server, see server ReactionDescription
+	Hill           json.RawMessage `json:"hill,omitempty"`      // Passed through to server, see server HillDescription
 }
 
 // Import from the other project instead? Or import from here. Transport too
@@ -39,6 +42,8 @@ type AreaOutput struct {
 	SpawnStrategy  string                       `json:"spawnStrategy"`
 	BroadcastGroup string                       `json:"broadcastGroup,omitempty"`
 	Weather        string                       `json:"weather,omitempty"`
+	Reactions      json.RawMessage              `json:"reactions,omitempty"`
+	Hill           json.RawMessage              `json:"hill,omitempty"`
 }
 
 type AreaEditPageData struct {
@@ -296,6 +296,8 @@ func (col Collection) areaOutputFromDescription(desc AreaDescription, mapid stri
 		SpawnStrategy:  desc.SpawnStrategy,
 		Weather:        desc.Weather,
 		BroadcastGroup: desc.BroadcastGroup,
+		Reactions:      desc.Reactions,
+		Hill:           desc.Hill,
 	}
 }
 